@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+
+	kstream "github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/kafka"
+)
+
+func baseLoad() loadConfig {
+	return loadConfig{Channels: 10, Rate: 1000, Spread: "uniform", Arrival: "constant", TextBytes: 20, Seed: 1}
+}
+
+func TestChannelRates(t *testing.T) {
+	cfg := baseLoad()
+	cfg.Spread, cfg.ZipfS = "zipf", 1
+	rates := cfg.channelRates()
+	var sum float64
+	for i, r := range rates {
+		sum += r
+		if i > 0 && r >= rates[i-1] {
+			t.Fatalf("zipf rates not decreasing: %v", rates)
+		}
+	}
+	if math.Abs(sum-cfg.Rate) > 1e-9 {
+		t.Fatalf("rates sum to %v, want %v", sum, cfg.Rate)
+	}
+	if got := rates[0] / rates[1]; math.Abs(got-2) > 1e-9 {
+		t.Fatalf("first/second channel = %v, want 2 for s=1", got)
+	}
+}
+
+// count takes every message scheduled in d.
+func count(cfg loadConfig, d time.Duration) (total int, inBurst int) {
+	s := newSchedule(cfg, d)
+	for m, ok := s.next(); ok; m, ok = s.next() {
+		total++
+		if cfg.multiplier(m.Due) > 1 {
+			inBurst++
+		}
+	}
+	return total, inBurst
+}
+
+func TestSchedule_RatesAndBursts(t *testing.T) {
+	cfg := baseLoad()
+	if n, _ := count(cfg, 10*time.Second); math.Abs(float64(n)-10000) > float64(cfg.Channels) {
+		t.Fatalf("constant arrivals: %d messages, want about 10000", n)
+	}
+
+	cfg.Arrival = "poisson"
+	if n, _ := count(cfg, 10*time.Second); math.Abs(float64(n)-10000) > 500 {
+		t.Fatalf("poisson arrivals: %d messages, want about 10000", n)
+	}
+
+	// bursts: 1s of every 4s at 5x, so 4s carry 3*1000 + 5000 messages
+	cfg.Arrival = "constant"
+	cfg.BurstEvery, cfg.BurstFor, cfg.BurstX = 4*time.Second, time.Second, 5
+	n, in := count(cfg, 8*time.Second)
+	if math.Abs(float64(n)-16000) > 200 || math.Abs(float64(in)-10000) > 200 {
+		t.Fatalf("bursts: %d messages, %d in bursts; want about 16000 and 10000", n, in)
+	}
+}
+
+func TestGenerate_StopsAtTheEnd(t *testing.T) {
+	cfg := baseLoad()
+	cfg.Rate = 200
+	s := newSchedule(cfg, 300*time.Millisecond)
+	start := time.Now()
+	last := time.Duration(-1)
+	sent, _ := generate(context.Background(), s, start, func(m message) {
+		if m.Due < last {
+			t.Errorf("message due at %v after one at %v", m.Due, last)
+		}
+		last = m.Due
+	})
+	if d := time.Since(start); d < 250*time.Millisecond || d > 2*time.Second {
+		t.Fatalf("generated for %v, want about 300ms", d)
+	}
+	if sent < 50 || sent > 70 || s.remaining() != 0 {
+		t.Fatalf("sent %d, want about 60 and nothing left", sent)
+	}
+
+	// a say slower than the schedule leaves the rest behind
+	s = newSchedule(cfg, 100*time.Millisecond)
+	sent, lag := generate(context.Background(), s, time.Now(), func(message) { time.Sleep(20 * time.Millisecond) })
+	if left := s.remaining(); left == 0 || sent+left < 15 || lag < 20*time.Millisecond {
+		t.Fatalf("slow say: sent %d, left %d, lag %v", sent, left, lag)
+	}
+}
+
+func TestBenchWriter_Report(t *testing.T) {
+	w := newBenchWriter()
+	start := time.Now()
+	msg := func(id string) kafkago.Message {
+		return kafkago.Message{Headers: []kafkago.Header{{Key: kstream.HeaderMessageID, Value: []byte(id)}}}
+	}
+	_ = w.WriteMessages(context.Background(),
+		msg(messageID(1, start)),
+		msg(messageID(2, start)),
+		msg(messageID(1, start)), // duplicate
+		msg("6f1c-not-ours"),
+		kafkago.Message{},
+	)
+	r := w.report(baseLoad(), start, time.Second, 5, 4, 1, 0)
+	if r.Written != 2 || r.Duplicates != 1 || r.OtherEvents != 2 || r.Lost != 1 || r.OfferedRate != 5 {
+		t.Fatalf("report = %+v", r)
+	}
+	if r.Latency.Max <= 0 || r.Latency.P50 > r.Latency.Max {
+		t.Fatalf("latency = %+v", r.Latency)
+	}
+
+	if _, _, ok := parseMessageID("chatgen-x-1"); ok {
+		t.Fatal("bad sequence accepted")
+	}
+	seq, sent, ok := parseMessageID(messageID(42, start))
+	if !ok || seq != 42 || !sent.Equal(time.Unix(0, start.UnixNano())) {
+		t.Fatalf("round trip = %d %v %v", seq, sent, ok)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	var ds []time.Duration
+	for i := 100; i >= 1; i-- {
+		ds = append(ds, time.Duration(i)*time.Millisecond)
+	}
+	s := summarize(ds)
+	if s.P50 != 50*time.Millisecond || s.P90 != 90*time.Millisecond || s.P99 != 99*time.Millisecond || s.Max != 100*time.Millisecond {
+		t.Fatalf("summary = %+v", s)
+	}
+	if ds[0] != 100*time.Millisecond {
+		t.Fatal("summarize reordered its input")
+	}
+}
+
+// TestBench runs a short benchmark against the real collector.
+func TestBench(t *testing.T) {
+	if testing.Short() {
+		t.Skip("end-to-end benchmark")
+	}
+	for _, k := range []string{"ACCOUNTS_PATH", "TOKENS_PATH", "CHANNELS_STORE", "CHANNELS_PATH", "TWITCH_IRC_URI", "HTTP_API_HOST", "HTTP_API_PORT"} {
+		t.Setenv(k, "") // restored after bench sets them
+	}
+	cfg := baseLoad()
+	cfg.Rate, cfg.TagBytes = 500, 100
+	r, err := bench(context.Background(), cfg, time.Second, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Sent < 400 || r.Written != r.Sent || r.Lost != 0 || r.Duplicates != 0 || r.Undelivered != 0 {
+		t.Fatalf("report = %+v", r)
+	}
+	if r.Latency.P50 <= 0 || r.Throughput <= 0 {
+		t.Fatalf("no latency or throughput: %+v", r)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// loadConfig describes the simulated chat.
+type loadConfig struct {
+	Channels int `json:"channels"`
+	// Rate is messages per second over all channels outside bursts.
+	Rate float64 `json:"rate"`
+	// Spread shares Rate out over channels: "uniform", or "zipf" where
+	// channel i gets a share proportional to 1/(i+1)^ZipfS.
+	Spread string  `json:"spread"`
+	ZipfS  float64 `json:"zipf_s,omitempty"`
+	// Arrival is "constant" (evenly spaced) or "poisson".
+	Arrival string `json:"arrival"`
+	// Every BurstEvery, for BurstFor, every channel runs at BurstX times
+	// its rate. BurstEvery 0 disables bursts.
+	BurstEvery time.Duration `json:"burst_every_ns,omitempty"`
+	BurstFor   time.Duration `json:"burst_for_ns,omitempty"`
+	BurstX     float64       `json:"burst_x,omitempty"`
+	// TagBytes of extra tag data and TextBytes of text per message.
+	TagBytes  int   `json:"tag_bytes"`
+	TextBytes int   `json:"text_bytes"`
+	Seed      int64 `json:"seed"`
+}
+
+func (c loadConfig) validate() error {
+	switch {
+	case c.Channels <= 0:
+		return fmt.Errorf("channels must be positive")
+	case c.Rate <= 0:
+		return fmt.Errorf("rate must be positive")
+	case c.Spread != "uniform" && c.Spread != "zipf":
+		return fmt.Errorf("unknown spread %q", c.Spread)
+	case c.Spread == "zipf" && c.ZipfS <= 0:
+		return fmt.Errorf("zipf exponent must be positive")
+	case c.Arrival != "constant" && c.Arrival != "poisson":
+		return fmt.Errorf("unknown arrival %q", c.Arrival)
+	case c.BurstEvery < 0 || c.BurstFor < 0 || (c.BurstEvery > 0 && (c.BurstFor <= 0 || c.BurstFor > c.BurstEvery)):
+		return fmt.Errorf("burst length must be positive and at most the burst period")
+	case c.BurstEvery > 0 && c.BurstX <= 0:
+		return fmt.Errorf("burst multiplier must be positive")
+	case c.TagBytes < 0 || c.TextBytes <= 0:
+		return fmt.Errorf("tag bytes must not be negative and text bytes must be positive")
+	}
+	return nil
+}
+
+// channelRates splits Rate over the channels.
+func (c loadConfig) channelRates() []float64 {
+	w := make([]float64, c.Channels)
+	var sum float64
+	for i := range w {
+		w[i] = 1
+		if c.Spread == "zipf" {
+			w[i] = 1 / math.Pow(float64(i+1), c.ZipfS)
+		}
+		sum += w[i]
+	}
+	for i := range w {
+		w[i] *= c.Rate / sum
+	}
+	return w
+}
+
+// multiplier is the rate factor at elapsed time into the run.
+func (c loadConfig) multiplier(elapsed time.Duration) float64 {
+	if c.BurstEvery <= 0 || elapsed%c.BurstEvery >= c.BurstFor {
+		return 1
+	}
+	return c.BurstX
+}
+
+// message is one scheduled chat line.
+type message struct {
+	Channel int
+	Due     time.Duration // since the start of the run
+}
+
+type dueHeap []message
+
+func (h dueHeap) Len() int           { return len(h) }
+func (h dueHeap) Less(i, j int) bool { return h[i].Due < h[j].Due }
+func (h dueHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *dueHeap) Push(x any)        { *h = append(*h, x.(message)) }
+func (h *dueHeap) Pop() any {
+	old := *h
+	m := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return m
+}
+
+// schedule yields the messages due before end in order of their due time.
+type schedule struct {
+	cfg   loadConfig
+	rates []float64
+	rng   *rand.Rand
+	due   dueHeap
+	end   time.Duration
+}
+
+func newSchedule(cfg loadConfig, end time.Duration) *schedule {
+	s := &schedule{cfg: cfg, rates: cfg.channelRates(), rng: rand.New(rand.NewSource(cfg.Seed)), end: end}
+	for i := range s.rates {
+		// spread the first messages out so channels don't all fire at 0
+		s.due = append(s.due, message{Channel: i, Due: time.Duration(s.rng.Float64() * float64(s.gap(i, 0)))})
+	}
+	heap.Init(&s.due)
+	return s
+}
+
+// gap is the wait before channel i's next message, given the time now.
+func (s *schedule) gap(i int, now time.Duration) time.Duration {
+	mean := 1 / (s.rates[i] * s.cfg.multiplier(now))
+	if s.cfg.Arrival == "poisson" {
+		mean *= s.rng.ExpFloat64()
+	}
+	return time.Duration(mean * float64(time.Second))
+}
+
+func (s *schedule) next() (message, bool) {
+	if len(s.due) == 0 || s.due[0].Due >= s.end {
+		return message{}, false
+	}
+	m := s.due[0]
+	s.due[0].Due += s.gap(m.Channel, m.Due)
+	heap.Fix(&s.due, 0)
+	return m, true
+}
+
+// remaining counts, and uses up, the messages not yet taken.
+func (s *schedule) remaining() int {
+	n := 0
+	for _, ok := s.next(); ok; _, ok = s.next() {
+		n++
+	}
+	return n
+}
+
+// generate sends each scheduled message through say once it is due, until
+// the schedule ends or its end has passed on the clock, and returns how
+// many it sent and the furthest it fell behind schedule. Messages still
+// due when it stops stay in s.
+func generate(ctx context.Context, s *schedule, start time.Time, say func(message)) (sent int, maxLag time.Duration) {
+	var timer *time.Timer
+	stop := start.Add(s.end)
+	for {
+		if time.Now().After(stop) {
+			return sent, maxLag
+		}
+		m, ok := s.next()
+		if !ok {
+			return sent, maxLag
+		}
+		at := start.Add(m.Due)
+		if d := time.Until(at); d > time.Millisecond {
+			if timer == nil {
+				timer = time.NewTimer(d)
+				defer timer.Stop()
+			} else {
+				timer.Reset(d)
+			}
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				return sent, maxLag
+			}
+		} else if ctx.Err() != nil {
+			return sent, maxLag
+		}
+		if lag := time.Since(at); lag > maxLag {
+			maxLag = lag
+		}
+		say(m)
+		sent++
+	}
+}
+
+// filler returns n printable bytes of chat-like text.
+func filler(rng *rand.Rand, n int) string {
+	words := []string{"pog", "gg", "lul", "kappa", "wp", "nice", "clip", "it", "that", "hype", "o7", "omg"}
+	var b strings.Builder
+	for b.Len() < n {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(words[rng.Intn(len(words))])
+	}
+	return b.String()[:n]
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/collector"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/fakeirc"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/ircmsg"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/observe"
+)
+
+// chatgen benchmarks one collector: it runs the collector in-process
+// against the fake IRC server, feeds it synthetic chat and reports
+// throughput, losses and end-to-end latency as seen by an in-memory
+// MessageWriter.
+func main() {
+	lg := observe.C("chatgen")
+
+	var (
+		cfg      loadConfig
+		duration = flag.Duration("duration", 30*time.Second, "how long to generate chat")
+		drain    = flag.Duration("drain", 10*time.Second, "how long to wait for in-flight messages afterwards")
+		asJSON   = flag.Bool("json", false, "print the report as JSON")
+	)
+	flag.IntVar(&cfg.Channels, "channels", 100, "simulated channels")
+	flag.Float64Var(&cfg.Rate, "rate", 2000, "messages per second over all channels, outside bursts")
+	flag.StringVar(&cfg.Spread, "spread", "uniform", "how the rate is shared over channels: uniform or zipf")
+	flag.Float64Var(&cfg.ZipfS, "zipf", 1.1, "zipf exponent for -spread zipf")
+	flag.StringVar(&cfg.Arrival, "arrival", "poisson", "message arrivals per channel: poisson or constant")
+	flag.DurationVar(&cfg.BurstEvery, "burst-every", 0, "start a burst this often; 0 disables bursts")
+	flag.DurationVar(&cfg.BurstFor, "burst-for", 5*time.Second, "how long each burst lasts")
+	flag.Float64Var(&cfg.BurstX, "burst-x", 5, "rate multiplier during a burst")
+	flag.IntVar(&cfg.TagBytes, "tag-bytes", 0, "extra tag bytes per message, on top of the standard PRIVMSG tags")
+	flag.IntVar(&cfg.TextBytes, "text-bytes", 40, "chat text bytes per message")
+	flag.Int64Var(&cfg.Seed, "seed", 1, "random seed")
+	flag.Parse()
+
+	if cfg.Spread != "zipf" {
+		cfg.ZipfS = 0
+	}
+	if cfg.BurstEvery == 0 {
+		cfg.BurstFor, cfg.BurstX = 0, 0
+	}
+	if err := cfg.validate(); err != nil {
+		fatal(lg, "invalid load", err)
+	}
+	if *duration <= 0 {
+		fatal(lg, "invalid -duration", errors.New("must be positive"))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	rep, err := bench(ctx, cfg, *duration, *drain)
+	if err != nil {
+		fatal(lg, "benchmark failed", err)
+	}
+	if *asJSON {
+		err = rep.writeJSON(os.Stdout)
+	} else {
+		err = rep.writeText(os.Stdout)
+	}
+	if err != nil {
+		fatal(lg, "write report", err)
+	}
+}
+
+// benchToken is the only token the fake server accepts.
+const benchToken = "chatgen"
+
+// bench runs one benchmark; ctx ending cuts generation short.
+func bench(ctx context.Context, cfg loadConfig, duration, drain time.Duration) (report, error) {
+	irc := fakeirc.New(fakeirc.Config{Token: benchToken})
+	if err := irc.Listen("127.0.0.1:0"); err != nil {
+		return report{}, err
+	}
+	defer irc.Close()
+
+	dir, err := os.MkdirTemp("", "chatgen")
+	if err != nil {
+		return report{}, err
+	}
+	defer os.RemoveAll(dir)
+	if err := collectorEnv(dir, irc.URL()); err != nil {
+		return report{}, err
+	}
+
+	w := newBenchWriter()
+	cctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- collector.Run(cctx, w) }()
+
+	if err := awaitLogin(ctx, irc, done); err != nil {
+		return report{}, err
+	}
+
+	rng := rand.New(rand.NewSource(cfg.Seed + 1))
+	channels := make([]string, cfg.Channels)
+	for i := range channels {
+		channels[i] = fmt.Sprintf("#chatgen_%04d", i)
+	}
+	logins := make([]string, 1000)
+	for i := range logins {
+		logins[i] = fmt.Sprintf("viewer_%d", i)
+	}
+	texts := make([]string, 256)
+	for i := range texts {
+		texts[i] = filler(rng, cfg.TextBytes)
+	}
+	var pad ircmsg.Tags
+	if cfg.TagBytes > 0 {
+		pad = ircmsg.Tags("chatgen-pad=" + strings.Repeat("x", cfg.TagBytes))
+	}
+
+	start := time.Now()
+	seq, undelivered := 0, 0
+	sched := newSchedule(cfg, duration)
+	sent, maxLag := generate(ctx, sched, start, func(m message) {
+		seq++
+		n := irc.Broadcast(fakeirc.Chat{
+			Channel: channels[m.Channel],
+			Login:   logins[rng.Intn(len(logins))],
+			Text:    texts[rng.Intn(len(texts))],
+			Tags:    pad,
+			ID:      messageID(seq, time.Now()),
+		})
+		if n == 0 {
+			undelivered++
+		}
+	})
+	offered := sent
+	if ctx.Err() != nil {
+		duration = time.Since(start)
+	} else {
+		offered += sched.remaining()
+	}
+
+	deadline := time.Now().Add(drain)
+	for w.written()+undelivered < sent && time.Now().Before(deadline) && ctx.Err() == nil {
+		time.Sleep(10 * time.Millisecond)
+	}
+	rep := w.report(cfg, start, duration, offered, sent, undelivered, maxLag)
+
+	cancel()
+	if err := <-done; err != nil {
+		return rep, fmt.Errorf("collector: %w", err)
+	}
+	return rep, nil
+}
+
+// collectorEnv points the collector at the fake server with an empty
+// channel set; the generator broadcasts instead of waiting out JOIN rate
+// limits. Other collector settings come from the environment as usual.
+func collectorEnv(dir, uri string) error {
+	files := map[string]string{
+		"account.json":  `{"accountname":"chatgen","username":"chatgen"}`,
+		"token.json":    `{"access_token":"` + benchToken + `"}`,
+		"channels.json": `{"schema":2,"account":"chatgen","channels":[]}`,
+	}
+	for name, body := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(body), 0o600); err != nil {
+			return err
+		}
+	}
+	port, err := freePort()
+	if err != nil {
+		return err
+	}
+	for k, v := range map[string]string{
+		"ACCOUNTS_PATH":  filepath.Join(dir, "account.json"),
+		"TOKENS_PATH":    filepath.Join(dir, "token.json"),
+		"CHANNELS_STORE": "file",
+		"CHANNELS_PATH":  filepath.Join(dir, "channels.json"),
+		"TWITCH_IRC_URI": uri,
+		"HTTP_API_HOST":  "127.0.0.1",
+		"HTTP_API_PORT":  port,
+	} {
+		if err := os.Setenv(k, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func freePort() (string, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", err
+	}
+	defer ln.Close()
+	return strconv.Itoa(ln.Addr().(*net.TCPAddr).Port), nil
+}
+
+// awaitLogin waits for the collector to finish its handshake with the
+// fake server.
+func awaitLogin(ctx context.Context, irc *fakeirc.Server, done <-chan error) error {
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		for _, l := range irc.Received() {
+			if strings.HasPrefix(l, "CAP REQ") {
+				return nil
+			}
+		}
+		select {
+		case err := <-done:
+			return fmt.Errorf("collector stopped before connecting: %w", err)
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			return errors.New("collector did not connect to the fake server")
+		}
+	}
+}
+
+func fatal(lg *slog.Logger, msg string, err error) {
+	lg.Error(msg, "err", err)
+	os.Exit(1)
+}
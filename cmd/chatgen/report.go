@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+
+	kstream "github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/kafka"
+)
+
+// idPrefix marks generated messages; the id is idPrefix<seq>-<unix nanos
+// when handed to the fake server>.
+const idPrefix = "chatgen-"
+
+func messageID(seq int, sent time.Time) string {
+	return idPrefix + strconv.Itoa(seq) + "-" + strconv.FormatInt(sent.UnixNano(), 10)
+}
+
+func parseMessageID(id string) (seq int, sent time.Time, ok bool) {
+	rest, found := strings.CutPrefix(id, idPrefix)
+	if !found {
+		return 0, time.Time{}, false
+	}
+	s, n, found := strings.Cut(rest, "-")
+	if !found {
+		return 0, time.Time{}, false
+	}
+	seq, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+	ns, err := strconv.ParseInt(n, 10, 64)
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+	return seq, time.Unix(0, ns), true
+}
+
+// benchWriter is the in-memory MessageWriter the collector produces into.
+// It times each generated message from the fake server to here.
+type benchWriter struct {
+	mu        sync.Mutex
+	seen      map[int]struct{}
+	latencies []time.Duration
+	dups      int
+	other     int // events that aren't generated chat
+	last      time.Time
+}
+
+func newBenchWriter() *benchWriter {
+	return &benchWriter{seen: make(map[int]struct{})}
+}
+
+func (w *benchWriter) WriteMessages(_ context.Context, msgs ...kafkago.Message) error {
+	now := time.Now()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, m := range msgs {
+		seq, sent, ok := parseMessageID(header(m, kstream.HeaderMessageID))
+		if !ok {
+			w.other++
+			continue
+		}
+		if _, dup := w.seen[seq]; dup {
+			w.dups++
+			continue
+		}
+		w.seen[seq] = struct{}{}
+		w.latencies = append(w.latencies, now.Sub(sent))
+		w.last = now
+	}
+	return nil
+}
+
+func (w *benchWriter) Close() error { return nil }
+
+func (w *benchWriter) written() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.seen)
+}
+
+func header(m kafkago.Message, key string) string {
+	for _, h := range m.Headers {
+		if h.Key == key {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+type latencySummary struct {
+	P50 time.Duration `json:"p50_ns"`
+	P90 time.Duration `json:"p90_ns"`
+	P99 time.Duration `json:"p99_ns"`
+	Max time.Duration `json:"max_ns"`
+}
+
+func summarize(ds []time.Duration) latencySummary {
+	if len(ds) == 0 {
+		return latencySummary{}
+	}
+	ds = slices.Clone(ds)
+	slices.Sort(ds)
+	at := func(q float64) time.Duration { return ds[int(q*float64(len(ds)-1))] }
+	return latencySummary{P50: at(0.50), P90: at(0.90), P99: at(0.99), Max: ds[len(ds)-1]}
+}
+
+type report struct {
+	Config      loadConfig    `json:"config"`
+	Duration    time.Duration `json:"duration_ns"`
+	Offered     int           `json:"offered"`     // scheduled within the duration
+	Sent        int           `json:"sent"`        // the rest fell behind past the end
+	Undelivered int           `json:"undelivered"` // no collector connected to take it
+	Written     int           `json:"written"`
+	Lost        int           `json:"lost"` // delivered but never written
+	Duplicates  int           `json:"duplicates"`
+	OtherEvents int           `json:"other_events"`
+	// OfferedRate is what the schedule asked for, SentRate what the
+	// generator managed under backpressure, and Throughput what was
+	// written, from the start until the last generated message arrived.
+	OfferedRate float64        `json:"offered_per_sec"`
+	SentRate    float64        `json:"sent_per_sec"`
+	Throughput  float64        `json:"written_per_sec"`
+	MaxLag      time.Duration  `json:"max_lag_ns"` // furthest the generator fell behind
+	Latency     latencySummary `json:"latency"`
+}
+
+func (w *benchWriter) report(cfg loadConfig, start time.Time, duration time.Duration, offered, sent, undelivered int, maxLag time.Duration) report {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	r := report{
+		Config:      cfg,
+		Duration:    duration,
+		Offered:     offered,
+		Sent:        sent,
+		Undelivered: undelivered,
+		Written:     len(w.seen),
+		Lost:        sent - undelivered - len(w.seen),
+		Duplicates:  w.dups,
+		OtherEvents: w.other,
+		OfferedRate: float64(offered) / duration.Seconds(),
+		SentRate:    float64(sent) / duration.Seconds(),
+		MaxLag:      maxLag,
+		Latency:     summarize(w.latencies),
+	}
+	if el := w.last.Sub(start); len(w.seen) > 0 && el > 0 {
+		r.Throughput = float64(len(w.seen)) / el.Seconds()
+	}
+	return r
+}
+
+func (r report) writeText(out io.Writer) error {
+	c := r.Config
+	burst := "off"
+	if c.BurstEvery > 0 {
+		burst = fmt.Sprintf("%gx for %v every %v", c.BurstX, c.BurstFor, c.BurstEvery)
+	}
+	_, err := fmt.Fprintf(out, `load        %d channels, %g msg/s %s spread, %s arrivals, bursts %s
+size        %d text bytes, %d extra tag bytes
+duration    %v
+
+offered     %d (%.0f msg/s)
+sent        %d (%.0f msg/s)
+written     %d (%.0f msg/s)
+undelivered %d
+lost        %d
+duplicates  %d
+max lag     %v
+
+latency     p50 %v  p90 %v  p99 %v  max %v
+`,
+		c.Channels, c.Rate, c.Spread, c.Arrival, burst,
+		c.TextBytes, c.TagBytes,
+		r.Duration,
+		r.Offered, r.OfferedRate,
+		r.Sent, r.SentRate,
+		r.Written, r.Throughput,
+		r.Undelivered, r.Lost, r.Duplicates,
+		r.MaxLag.Round(time.Microsecond),
+		r.Latency.P50.Round(time.Microsecond), r.Latency.P90.Round(time.Microsecond),
+		r.Latency.P99.Round(time.Microsecond), r.Latency.Max.Round(time.Microsecond))
+	return err
+}
+
+func (r report) writeJSON(out io.Writer) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
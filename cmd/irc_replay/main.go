@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/chattext"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/classifier"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/config"
+	ircevents "github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/irc_events"
+	kstream "github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/kafka"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/observe"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/rawarchive"
+)
+
+// irc_replay feeds archived raw lines back through the classifier, so
+// events can be re-derived after the classifier learns something new.
+func main() {
+	lg := observe.C("irc_replay")
+	if err := config.LoadEnv(); err != nil {
+		lg.Warn("env file not loaded", "err", err)
+	}
+
+	var (
+		dir          = flag.String("dir", "", "archive directory of raw segments (RAW_ARCHIVE_DIR); segment files may also be given as arguments")
+		inTopic      = flag.String("in-topic", "", "raw Kafka topic (RAW_ARCHIVE_TOPIC) to read instead of segments")
+		outTopic     = flag.String("out-topic", "", "Kafka topic for the events; JSON lines on stdout when empty")
+		whisperTopic = flag.String("whisper-topic", "", "Kafka topic for whispers; with -out-topic they are dropped when empty")
+		brokers      = flag.String("brokers", os.Getenv("KAFKA_BROKERS"), "comma-separated Kafka brokers")
+		speed        = flag.Float64("speed", 0, "1 replays at the original pace, 10 ten times faster, 0 as fast as possible")
+		from         = flag.String("from", "", "skip lines received before this RFC 3339 time")
+		to           = flag.String("to", "", "stop at lines received at or after this RFC 3339 time")
+		stripBypass  = flag.Bool("strip-bypass", os.Getenv("IRC_STRIP_BYPASS_CHARS") == "true", "strip duplicate-filter bypass characters, as IRC_STRIP_BYPASS_CHARS")
+	)
+	flag.Parse()
+
+	cfg := replayConfig{Speed: *speed, Text: chattext.Options{StripBypass: *stripBypass}}
+	var err error
+	if cfg.From, err = parseTime(*from); err != nil {
+		fatal(lg, "invalid -from", err)
+	}
+	if cfg.To, err = parseTime(*to); err != nil {
+		fatal(lg, "invalid -to", err)
+	}
+	if cfg.Speed < 0 {
+		fatal(lg, "invalid -speed", errors.New("must not be negative"))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	brokerList := strings.Split(*brokers, ",")
+	for i := range brokerList {
+		brokerList[i] = strings.TrimSpace(brokerList[i])
+	}
+
+	var src source
+	switch {
+	case *inTopic != "" && (*dir != "" || flag.NArg() > 0):
+		fatal(lg, "invalid input", errors.New("give -in-topic or segments, not both"))
+	case *inTopic != "":
+		srcs, err := topicSources(ctx, brokerList, *inTopic)
+		if err != nil {
+			fatal(lg, "open raw topic", err)
+		}
+		src = newMergeSource(srcs)
+	default:
+		paths := flag.Args()
+		if *dir != "" {
+			found, err := rawarchive.Segments(*dir)
+			if err != nil {
+				fatal(lg, "list segments", err)
+			}
+			paths = append(paths, found...)
+		}
+		if len(paths) == 0 {
+			fatal(lg, "invalid input", errors.New("no segments; give -dir, segment files or -in-topic"))
+		}
+		src = &segmentSource{paths: paths}
+	}
+	defer func() { _ = src.Close() }()
+
+	parseCh := make(chan ircevents.Event, 1000)
+	g, gctx := errgroup.WithContext(ctx)
+	if *outTopic != "" {
+		w := kstream.NewWriter(*brokers, *outTopic)
+		whispers := kstream.Route{Kind: "whisper"}
+		if *whisperTopic != "" {
+			ww := kstream.NewWriter(*brokers, *whisperTopic)
+			defer func() { _ = ww.Close() }()
+			whispers.Writer = ww
+		}
+		g.Go(func() error {
+			kstream.KafkaProducer(gctx, w, parseCh, nil, whispers)
+			return w.Close()
+		})
+	} else {
+		g.Go(func() error { return printEvents(os.Stdout, parseCh) })
+	}
+
+	start := time.Now()
+	var lines int
+	g.Go(func() error {
+		defer close(parseCh)
+		var err error
+		lines, err = replay(gctx, src, cfg, parseCh)
+		return err
+	})
+	if err := g.Wait(); err != nil {
+		fatal(lg, "replay failed", err)
+	}
+	lg.Info("replay complete", "lines", lines, "elapsed_s", time.Since(start).Seconds())
+}
+
+type replayConfig struct {
+	Speed    float64 // 0: as fast as possible
+	From, To time.Time
+	Text     chattext.Options
+}
+
+// replay classifies every line from src into parseCh, pacing lines by
+// their receive times when cfg.Speed > 0. It returns the number of lines
+// replayed once the classifier has handled the last of them.
+func replay(ctx context.Context, src source, cfg replayConfig, parseCh chan<- ircevents.Event) (int, error) {
+	readerCh := make(chan string, 1000)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// no control-plane sinks: nothing acts on replayed signals
+		classifier.ClassifyLine(ctx, readerCh, classifier.Config{Events: parseCh, Text: cfg.Text})
+	}()
+
+	var (
+		n     int
+		first time.Time
+		start time.Time
+		err   error
+	)
+	for {
+		var l rawarchive.Line
+		if l, err = src.Next(ctx); err != nil {
+			break
+		}
+		if !cfg.From.IsZero() && l.Received.Before(cfg.From) {
+			continue
+		}
+		if !cfg.To.IsZero() && !l.Received.Before(cfg.To) {
+			err = io.EOF
+			break
+		}
+		if cfg.Speed > 0 {
+			if first.IsZero() {
+				first, start = l.Received, time.Now()
+			}
+			due := start.Add(time.Duration(float64(l.Received.Sub(first)) / cfg.Speed))
+			if err = sleepUntil(ctx, due); err != nil {
+				break
+			}
+		}
+		select {
+		case readerCh <- l.Line:
+			n++
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+		if err != nil {
+			break
+		}
+	}
+	close(readerCh)
+	<-done
+	if err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+func sleepUntil(ctx context.Context, t time.Time) error {
+	d := time.Until(t)
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// printEvents writes each event as a JSON line: {"kind", "key", "event"}.
+func printEvents(w io.Writer, parseCh <-chan ircevents.Event) error {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for evt := range parseCh {
+		value, err := evt.Marshal()
+		if err != nil {
+			return fmt.Errorf("marshal %s: %w", evt.Kind(), err)
+		}
+		if err := enc.Encode(struct {
+			Kind  string          `json:"kind"`
+			Key   string          `json:"key"`
+			Event json.RawMessage `json:"event"`
+		}{evt.Kind(), evt.Key(), value}); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func fatal(lg *slog.Logger, msg string, err error) {
+	lg.Error(msg, "err", err)
+	os.Exit(1)
+}
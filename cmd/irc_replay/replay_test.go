@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	ircevents "github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/irc_events"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/rawarchive"
+)
+
+var t0 = time.Unix(1_700_000_000, 0).UTC()
+
+type sliceSource []rawarchive.Line
+
+func (s *sliceSource) Next(context.Context) (rawarchive.Line, error) {
+	if len(*s) == 0 {
+		return rawarchive.Line{}, io.EOF
+	}
+	l := (*s)[0]
+	*s = (*s)[1:]
+	return l, nil
+}
+
+func (s *sliceSource) Close() error { return nil }
+
+func lineAt(sec int, line string) rawarchive.Line {
+	return rawarchive.Line{Received: t0.Add(time.Duration(sec) * time.Second), ConnID: "c1", Line: line}
+}
+
+func privmsg(id, text string) string {
+	return "@id=" + id + ";room-id=1;user-id=2 :bob!bob@bob.tmi.twitch.tv PRIVMSG #chess :" + text
+}
+
+func collect(t *testing.T, src source, cfg replayConfig) ([]ircevents.Event, int) {
+	t.Helper()
+	parseCh := make(chan ircevents.Event, 100)
+	n, err := replay(context.Background(), src, cfg, parseCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(parseCh)
+	var out []ircevents.Event
+	for evt := range parseCh {
+		out = append(out, evt)
+	}
+	return out, n
+}
+
+func TestReplay_SegmentsThroughClassifier(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := rawarchive.NewSegmentSink(dir, 1<<20, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range []rawarchive.Line{
+		lineAt(0, "PING :tmi.twitch.tv"),
+		lineAt(1, privmsg("a", "\x01ACTION waves\x01")),
+		lineAt(2, "@msg-id=raid;msg-param-login=raider;msg-param-viewerCount=5;room-id=1 :tmi.twitch.tv USERNOTICE #chess"),
+		lineAt(3, privmsg("b", "late")),
+	} {
+		if err := sink.Write(context.Background(), l); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	paths, _ := rawarchive.Segments(dir)
+
+	events, n := collect(t, &segmentSource{paths: paths}, replayConfig{To: t0.Add(3 * time.Second)})
+	if n != 3 || len(events) != 2 {
+		t.Fatalf("replayed %d lines into %d events, want 3 lines and 2 events", n, len(events))
+	}
+	if pm, ok := events[0].(ircevents.PrivMsg); !ok || pm.ID != "a" || pm.Text != "waves" || !pm.IsAction {
+		t.Fatalf("first event = %#v", events[0])
+	}
+	if r, ok := events[1].(ircevents.Raid); !ok || r.FromLogin != "raider" || r.ViewerCount != 5 {
+		t.Fatalf("second event = %#v", events[1])
+	}
+}
+
+func TestReplay_Paced(t *testing.T) {
+	src := sliceSource{lineAt(0, privmsg("a", "x")), lineAt(1, privmsg("b", "y")), lineAt(3, privmsg("c", "z"))}
+	start := time.Now()
+	events, _ := collect(t, &src, replayConfig{Speed: 100, From: t0.Add(time.Second)})
+	elapsed := time.Since(start)
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2 after -from", len(events))
+	}
+	// two seconds of traffic at 100x
+	if elapsed < 15*time.Millisecond || elapsed > time.Second {
+		t.Fatalf("paced replay took %v, want about 20ms", elapsed)
+	}
+}
+
+func TestMergeSource_OrdersByReceiveTime(t *testing.T) {
+	a := sliceSource{lineAt(0, "a0"), lineAt(2, "a2"), lineAt(5, "a5")}
+	b := sliceSource{lineAt(1, "b1"), lineAt(3, "b3")}
+	m := newMergeSource([]source{&a, &b, &sliceSource{}})
+	var got []string
+	for {
+		l, err := m.Next(context.Background())
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, l.Line)
+	}
+	if strings.Join(got, " ") != "a0 b1 a2 b3 a5" {
+		t.Fatalf("merged order = %v", got)
+	}
+}
+
+func TestMergeSource_KeepsAFramesLinesInOrder(t *testing.T) {
+	// One websocket frame of three lines, spread over two partitions.
+	frame := func(seq uint64, line string) rawarchive.Line {
+		l := lineAt(0, line)
+		l.Seq = seq
+		return l
+	}
+	a := sliceSource{frame(11, "second"), lineAt(1, "later")}
+	b := sliceSource{frame(10, "first"), frame(12, "third")}
+	m := newMergeSource([]source{&a, &b})
+	var got []string
+	for {
+		l, err := m.Next(context.Background())
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, l.Line)
+	}
+	if strings.Join(got, " ") != "first second third later" {
+		t.Fatalf("merged order = %v", got)
+	}
+}
+
+func TestPrintEvents(t *testing.T) {
+	parseCh := make(chan ircevents.Event, 1)
+	parseCh <- ircevents.PrivMsg{ID: "a", ChannelID: "1", Text: "hi"}
+	close(parseCh)
+	var buf bytes.Buffer
+	if err := printEvents(&buf, parseCh); err != nil {
+		t.Fatal(err)
+	}
+	var rec struct {
+		Kind  string
+		Key   string
+		Event ircevents.PrivMsg
+	}
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("%q: %v", buf.String(), err)
+	}
+	if rec.Kind != "privmsg" || rec.Key != "1" || rec.Event.Text != "hi" {
+		t.Fatalf("printed %q", buf.String())
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	kafkago "github.com/segmentio/kafka-go"
+
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/rawarchive"
+)
+
+// source yields archived lines in the order they were received.
+type source interface {
+	Next(ctx context.Context) (rawarchive.Line, error) // io.EOF at the end
+	Close() error
+}
+
+// segmentSource reads segment files one after another.
+type segmentSource struct {
+	paths []string
+	cur   *rawarchive.SegmentReader
+}
+
+func (s *segmentSource) Next(ctx context.Context) (rawarchive.Line, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return rawarchive.Line{}, err
+		}
+		if s.cur == nil {
+			if len(s.paths) == 0 {
+				return rawarchive.Line{}, io.EOF
+			}
+			r, err := rawarchive.OpenSegment(s.paths[0])
+			if err != nil {
+				return rawarchive.Line{}, err
+			}
+			s.cur, s.paths = r, s.paths[1:]
+		}
+		l, err := s.cur.Next()
+		if err != io.EOF {
+			return l, err
+		}
+		_ = s.cur.Close()
+		s.cur = nil
+	}
+}
+
+func (s *segmentSource) Close() error {
+	if s.cur != nil {
+		return s.cur.Close()
+	}
+	return nil
+}
+
+// partitionSource reads one partition of a raw topic from its first offset
+// up to the last one present when the replay started.
+type partitionSource struct {
+	r   *kafkago.Reader
+	end int64
+}
+
+func (s *partitionSource) Next(ctx context.Context) (rawarchive.Line, error) {
+	var l rawarchive.Line
+	if s.r.Offset() >= s.end {
+		return l, io.EOF
+	}
+	m, err := s.r.ReadMessage(ctx)
+	if err != nil {
+		return l, err
+	}
+	if err := json.Unmarshal(m.Value, &l); err != nil {
+		return l, fmt.Errorf("partition %d offset %d: %w", m.Partition, m.Offset, err)
+	}
+	return l, nil
+}
+
+func (s *partitionSource) Close() error { return s.r.Close() }
+
+// topicSources opens every partition of topic.
+func topicSources(ctx context.Context, brokers []string, topic string) ([]source, error) {
+	conn, err := kafkago.DialContext(ctx, "tcp", brokers[0])
+	if err != nil {
+		return nil, err
+	}
+	parts, err := conn.ReadPartitions(topic)
+	_ = conn.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	var srcs []source
+	closeAll := func() {
+		for _, s := range srcs {
+			_ = s.Close()
+		}
+	}
+	for _, p := range parts {
+		pc, err := kafkago.DialLeader(ctx, "tcp", brokers[0], topic, p.ID)
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		first, last, err := pc.ReadOffsets()
+		_ = pc.Close()
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		r := kafkago.NewReader(kafkago.ReaderConfig{
+			Brokers:   brokers,
+			Topic:     topic,
+			Partition: p.ID,
+			MaxBytes:  10e6, // 10MB
+		})
+		if err := r.SetOffset(first); err != nil {
+			_ = r.Close()
+			closeAll()
+			return nil, err
+		}
+		srcs = append(srcs, &partitionSource{r: r, end: last})
+	}
+	if len(srcs) == 0 {
+		return nil, errors.New("topic has no partitions")
+	}
+	return srcs, nil
+}
+
+// mergeSource interleaves sources by receive time. Each source is already
+// in order, so it only has to compare their next lines.
+type mergeSource struct {
+	srcs  []source
+	heads []*rawarchive.Line // nil once a source is exhausted
+	init  bool
+}
+
+func newMergeSource(srcs []source) source {
+	if len(srcs) == 1 {
+		return srcs[0]
+	}
+	return &mergeSource{srcs: srcs, heads: make([]*rawarchive.Line, len(srcs))}
+}
+
+func (m *mergeSource) Next(ctx context.Context) (rawarchive.Line, error) {
+	if !m.init {
+		for i := range m.srcs {
+			if err := m.advance(ctx, i); err != nil {
+				return rawarchive.Line{}, err
+			}
+		}
+		m.init = true
+	}
+	best := -1
+	for i, h := range m.heads {
+		if h != nil && (best < 0 || before(h, m.heads[best])) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return rawarchive.Line{}, io.EOF
+	}
+	l := *m.heads[best]
+	return l, m.advance(ctx, best)
+}
+
+// before orders lines by receive time, and lines of one connection that
+// share a timestamp (one websocket frame) by sequence, in case they were
+// spread over partitions.
+func before(a, b *rawarchive.Line) bool {
+	if !a.Received.Equal(b.Received) {
+		return a.Received.Before(b.Received)
+	}
+	return a.ConnID == b.ConnID && a.Seq < b.Seq
+}
+
+func (m *mergeSource) advance(ctx context.Context, i int) error {
+	l, err := m.srcs[i].Next(ctx)
+	switch {
+	case err == io.EOF:
+		m.heads[i] = nil
+		return nil
+	case err != nil:
+		return err
+	}
+	m.heads[i] = &l
+	return nil
+}
+
+func (m *mergeSource) Close() error {
+	var errs []error
+	for _, s := range m.srcs {
+		errs = append(errs, s.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/config"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/dedup"
+	kstream "github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/kafka"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/observe"
+)
+
+// kafka_dedup reads the raw topic written by one or more collectors and
+// writes each Twitch message once to KAFKA_DEDUP_TOPIC.
+func main() {
+	lg := observe.C("kafka_dedup")
+
+	if err := config.LoadEnv(); err != nil {
+		lg.Warn("env file not loaded", "err", err)
+	}
+
+	brokers := require(lg, "KAFKA_BROKERS")
+	in := require(lg, "KAFKA_TOPIC")
+	out := require(lg, "KAFKA_DEDUP_TOPIC")
+	groupID := require(lg, "KAFKA_DEDUP_GROUPID")
+	if in == out {
+		lg.Error("KAFKA_DEDUP_TOPIC must differ from KAFKA_TOPIC", "topic", in)
+		os.Exit(1)
+	}
+
+	window := durationEnv(lg, "DEDUP_WINDOW", 10*time.Minute)
+	capacity := intEnv(lg, "DEDUP_CAPACITY", 500_000)
+	statsEvery := durationEnv(lg, "DEDUP_STATS_INTERVAL", 30*time.Second)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	brokerList := strings.Split(brokers, ",")
+	for i := range brokerList {
+		brokerList[i] = strings.TrimSpace(brokerList[i])
+	}
+	r := kafkago.NewReader(kafkago.ReaderConfig{
+		Brokers:  brokerList,
+		GroupID:  groupID,
+		Topic:    in,
+		MaxBytes: 10e6, // 10MB
+	})
+	defer func() {
+		if err := r.Close(); err != nil {
+			lg.Warn("kafka reader close failed", "err", err)
+		}
+	}()
+	w := kstream.NewWriter(brokers, out)
+	// Keep a channel's records in one output partition. The input is not
+	// partitioned that way (collectors spread records by load), so copies
+	// of a message can sit in any partition: the cache only sees them all
+	// when this is the only instance in its group.
+	w.Balancer = &kafkago.Hash{}
+	// Deduplicate writes batches synchronously; don't wait out the default
+	// one-second linger on each.
+	w.BatchTimeout = 10 * time.Millisecond
+	defer func() {
+		if err := w.Close(); err != nil {
+			lg.Warn("kafka writer close failed", "err", err)
+		}
+	}()
+
+	cache := dedup.New(capacity, window)
+	var counters kstream.DedupCounters
+	logStats := func(msg string) {
+		st := cache.Stats()
+		lg.Info(msg,
+			"forwarded", counters.Forwarded.Load(),
+			"duplicates_dropped", counters.Dropped.Load(),
+			"no_id", counters.NoID.Load(),
+			"cache_size", st.Size,
+			"cache_evicted", st.Evicted,
+		)
+	}
+	go func() {
+		t := time.NewTicker(statsEvery)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				logStats("dedup stats")
+			}
+		}
+	}()
+
+	lg.Info("starting", "in", in, "out", out, "group", groupID, "window_s", window.Seconds(), "capacity", capacity)
+	err := kstream.Deduplicate(ctx, r, w, cache, &counters)
+	logStats("dedup stopped")
+	if err != nil && !errors.Is(err, context.Canceled) {
+		lg.Error("dedup failed", "err", err)
+		os.Exit(1)
+	}
+}
+
+func require(lg *slog.Logger, key string) string {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		lg.Error("missing required env", "key", key)
+		os.Exit(1)
+	}
+	return v
+}
+
+func durationEnv(lg *slog.Logger, key string, def time.Duration) time.Duration {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		lg.Error("invalid duration", "key", key, "value", v)
+		os.Exit(1)
+	}
+	return d
+}
+
+func intEnv(lg *slog.Logger, key string, def int) int {
+	v := strings.TrimSpace(os.Getenv(key))
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		lg.Error("invalid count", "key", key, "value", v)
+		os.Exit(1)
+	}
+	return n
+}
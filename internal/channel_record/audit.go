@@ -0,0 +1,97 @@
+package channelrecord
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/types"
+)
+
+// auditLog is an append-only JSONL record of desired-state changes kept
+// next to the channels file.
+type auditLog struct {
+	path string
+	mu   sync.Mutex
+}
+
+func auditPathFor(channelsPath string) string {
+	ext := filepath.Ext(channelsPath)
+	return strings.TrimSuffix(channelsPath, ext) + ".audit.jsonl"
+}
+
+func (a *auditLog) append(entries []types.AuditEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	f, err := os.OpenFile(a.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("open audit log: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for i := range entries {
+		if err := enc.Encode(&entries[i]); err != nil {
+			_ = f.Close()
+			return fmt.Errorf("encode audit entry: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("write audit log: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("fsync audit log: %w", err)
+	}
+	return f.Close()
+}
+
+// read returns the newest limit entries (oldest first) matching channel,
+// or every channel when channel is empty.
+func (a *auditLog) read(channel string, limit int) ([]types.AuditEntry, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	f, err := os.Open(a.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open audit log: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var out []types.AuditEntry
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for sc.Scan() {
+		var e types.AuditEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			// a torn final line from a crash mid-append; skip it
+			continue
+		}
+		if channel != "" && e.Channel != channel {
+			continue
+		}
+		out = append(out, e)
+		if limit > 0 && len(out) > 2*limit {
+			out = append(out[:0], out[len(out)-limit:]...)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("read audit log: %w", err)
+	}
+	if limit > 0 && len(out) > limit {
+		out = out[len(out)-limit:]
+	}
+	return out, nil
+}
@@ -0,0 +1,46 @@
+package channelrecord
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	minChannelLen = 4
+	maxChannelLen = 25
+)
+
+var ErrInvalidChannel = errors.New("invalid channel")
+
+// ValidateChannel normalizes raw to "#login" and checks it against Twitch's
+// login rules: 4–25 characters of [a-z0-9_] after lowercasing. Anything
+// else, notably commas that would smuggle several JOINs into one IRC line,
+// is rejected with an error wrapping ErrInvalidChannel.
+func ValidateChannel(raw string) (string, error) {
+	s := strings.TrimSpace(raw)
+	s = strings.TrimPrefix(s, "#")
+	if s == "" {
+		return "", fmt.Errorf("%w: empty name", ErrInvalidChannel)
+	}
+	if strings.ContainsRune(s, ',') {
+		return "", fmt.Errorf("%w: %q contains a comma; send one channel per request", ErrInvalidChannel, raw)
+	}
+	if len(s) < minChannelLen || len(s) > maxChannelLen {
+		return "", fmt.Errorf("%w: %q must be %d-%d characters", ErrInvalidChannel, raw, minChannelLen, maxChannelLen)
+	}
+
+	b := make([]byte, 0, len(s)+1)
+	b = append(b, '#')
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		if ch >= 'A' && ch <= 'Z' {
+			ch = ch - 'A' + 'a'
+		}
+		if !(ch >= 'a' && ch <= 'z' || ch >= '0' && ch <= '9' || ch == '_') {
+			return "", fmt.Errorf("%w: %q may only contain letters, digits and underscores", ErrInvalidChannel, raw)
+		}
+		b = append(b, ch)
+	}
+	return string(b), nil
+}
@@ -0,0 +1,29 @@
+package channelrecord
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidateChannel(t *testing.T) {
+	ok := map[string]string{
+		"chess":                     "#chess",
+		"#Chess":                    "#chess",
+		"  xQc_42 ":                 "#xqc_42",
+		"abcd":                      "#abcd",
+		"abcdefghijklmnopqrstuvwxy": "#abcdefghijklmnopqrstuvwxy",
+	}
+	for in, want := range ok {
+		got, err := ValidateChannel(in)
+		if err != nil || got != want {
+			t.Fatalf("ValidateChannel(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+
+	bad := []string{"", "#", "abc", "abcdefghijklmnopqrstuvwxyz", "ch ess", "a,bcde", "#chess,#speedrun", "schön", "chess\r\nQUIT", "ch-ess"}
+	for _, in := range bad {
+		if got, err := ValidateChannel(in); !errors.Is(err, ErrInvalidChannel) {
+			t.Fatalf("ValidateChannel(%q) = %q, %v; want ErrInvalidChannel", in, got, err)
+		}
+	}
+}
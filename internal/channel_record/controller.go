@@ -2,12 +2,10 @@ package channelrecord
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"os"
-	"path/filepath"
 	"sort"
 	"sync"
 	"time"
@@ -17,14 +15,15 @@ import (
 )
 
 type Controller struct {
-	path            string // path to channels.json
+	store           Store
 	account         string // validated account name
-	schema          int    // schema version
 	controlCh       <-chan types.IRCCommand
 	updatesCh       chan struct{}
 	mu              sync.RWMutex
 	snap            snapshot // immutable view for readers
 	writeDebounceMs int      // debounce window
+	reload          ReloadPolicy
+	clk             Clock
 	lg              *slog.Logger
 }
 
@@ -32,48 +31,74 @@ type snapshot struct {
 	Version   uint64
 	Account   string
 	UpdatedAt time.Time
-	Channels  []string
+	Channels  []types.ChannelEntry // sorted by name
+	Active    []string             // names whose schedule is open, sorted
 }
 
+// saveAttempts bounds how often persist reloads and retries a save that
+// lost a race with another writer (ErrStoreConflict).
+const saveAttempts = 3
+
+// clockCheckInterval is how often Run looks for expired entries and
+// schedule windows opening or closing.
+const clockCheckInterval = time.Second
+
+// NewController keeps the desired set in the JSON file at path.
 func NewController(path string, expectedAccount string, controlCh <-chan types.IRCCommand) (*Controller, error) {
+	store, err := NewFileStore(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewControllerWithStore(store, expectedAccount, controlCh)
+}
+
+// NewControllerWithStore is NewController for an arbitrary Store. The
+// controller does not close the store.
+func NewControllerWithStore(store Store, expectedAccount string, controlCh <-chan types.IRCCommand) (*Controller, error) {
+	if store == nil {
+		return nil, errors.New("channelrecord: nil store")
+	}
 	lg := observe.
 		C("channelrecord").
-		With("account", expectedAccount, "path", path)
+		With("account", expectedAccount, "store", store.String())
 
-	if path == "" {
-		return nil, errors.New("channelrecord: empty path")
-	}
 	if expectedAccount == "" {
 		return nil, errors.New("channelrecord: empty expectedAccount")
 	}
 
 	c := &Controller{
-		path:            path,
+		store:           store,
 		account:         expectedAccount,
-		schema:          1,
 		controlCh:       controlCh,
 		updatesCh:       make(chan struct{}, 1),
 		writeDebounceMs: 150,
+		reload:          ReloadMerge,
+		clk:             realClock{},
 		lg:              lg,
 	}
 
-	onDisk, err := loadFile(path)
+	onDisk, err := store.Load()
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
-		return nil, fmt.Errorf("channelrecord: load channels file %q: %w", path, err)
+		return nil, fmt.Errorf("channelrecord: load channels from %s: %w", store, err)
 	}
 
-	var desired map[string]struct{}
+	var desired map[string]types.ChannelEntry
+	migrate := false
 	if err == nil {
 		if onDisk.Account != "" && onDisk.Account != expectedAccount {
-			return nil, fmt.Errorf("channelrecord: channels file account %q != expected %q",
+			return nil, fmt.Errorf("channelrecord: stored account %q != expected %q",
 				onDisk.Account, expectedAccount)
 		}
-		desired = sliceToSet(onDisk.Channels)
-		c.schema = onDisk.Schema
-		lg.Debug("loaded channels file", "schema", c.schema, "channels", len(desired))
+		if onDisk.Schema > types.ChannelsSchema {
+			return nil, fmt.Errorf("channelrecord: stored schema %d is newer than supported %d",
+				onDisk.Schema, types.ChannelsSchema)
+		}
+		desired = c.entriesToSet(onDisk.Channels)
+		migrate = onDisk.Schema < types.ChannelsSchema
+		lg.Debug("loaded channels", "schema", onDisk.Schema, "channels", len(desired))
 	} else {
-		desired = make(map[string]struct{})
-		lg.Debug("no existing channels file; will initialize")
+		desired = make(map[string]types.ChannelEntry)
+		lg.Debug("no stored channels; will initialize")
 	}
 
 	// Build initial immutable snapshot
@@ -83,13 +108,19 @@ func NewController(path string, expectedAccount string, controlCh <-chan types.I
 		Account:   expectedAccount,
 		UpdatedAt: time.Now().UTC(),
 		Channels:  chans,
+		Active:    activeNames(chans, c.clk.Now()),
 	}
 
 	if errors.Is(err, os.ErrNotExist) {
-		if err := c.writeFile(c.snap); err != nil {
-			return nil, fmt.Errorf("channelrecord: initialize channels file %q: %w", path, err)
+		if err := c.save(c.snap); err != nil {
+			return nil, fmt.Errorf("channelrecord: initialize %s: %w", store, err)
+		}
+		lg.Info("initialized channels", "channels", len(chans))
+	} else if migrate {
+		if err := c.save(c.snap); err != nil {
+			return nil, fmt.Errorf("channelrecord: migrate %s: %w", store, err)
 		}
-		lg.Info("initialized channels file", "channels", len(chans))
+		lg.Info("migrated channels", "from_schema", onDisk.Schema, "to_schema", types.ChannelsSchema, "channels", len(chans))
 	}
 
 	lg.Info("controller ready",
@@ -100,11 +131,158 @@ func NewController(path string, expectedAccount string, controlCh <-chan types.I
 func (c *Controller) Run(ctx context.Context) error {
 	lg := c.lg
 
-	desired := sliceToSet(c.readSnap().Channels)
+	desired := c.entriesToSet(c.readSnap().Channels)
 	version := c.readSnap().Version
 
 	dirty := false
 	var debounce <-chan time.Time
+	clockTick := time.NewTicker(clockCheckInterval)
+	defer clockTick.Stop()
+	var pending []types.AuditEntry // changes awaiting the next version
+
+	// absorb folds edits made to the store behind our back into desired
+	// according to the reload policy, marking them pending like any other
+	// change. It reports whether the store changed and whether it must be
+	// rewritten from local state.
+	detector, watch := c.store.(ExternalChangeDetector)
+	absorb := func() (changed, restore bool) {
+		if !watch || c.reload == ReloadOff {
+			return false, false
+		}
+		changed, err := detector.ChangedExternally()
+		if err != nil {
+			lg.Warn("check store for external changes failed", "err", err)
+			return false, false
+		}
+		if !changed {
+			return false, false
+		}
+		if c.reload == ReloadLocal {
+			lg.Warn("store changed externally; restoring local state", "policy", c.reload)
+			return true, true
+		}
+
+		v, err := c.store.Load()
+		if errors.Is(err, os.ErrNotExist) {
+			lg.Warn("stored channels removed externally; restoring local state")
+			return true, true
+		}
+		var next map[string]types.ChannelEntry
+		if err == nil {
+			next, err = c.validateStored(v)
+		}
+		if err != nil {
+			// Put local state back now: leaving the bad edit in place would
+			// report it again on every check and lose it to the next save
+			// without a word.
+			lg.Error("rejected external change to stored channels; restoring local state", "err", err, "policy", c.reload)
+			return true, true
+		}
+		if c.reload == ReloadMerge {
+			// channels changed here since the last save keep their local state
+			for _, e := range pending {
+				if local, ok := desired[e.Channel]; ok {
+					next[e.Channel] = local
+				} else {
+					delete(next, e.Channel)
+				}
+			}
+		}
+		changes := c.replaceAll(desired, next, types.IRCCommand{Op: "RELOAD", Source: types.SourceFile})
+		lg.Info("reloaded external change", "policy", c.reload, "changes", len(changes))
+		if len(changes) > 0 {
+			dirty = true
+			pending = append(pending, auditEntries(types.IRCCommand{Op: "RELOAD", Source: types.SourceFile}, changes)...)
+		}
+		return true, false
+	}
+
+	// restore rewrites the store from the last published snapshot, first
+	// adopting the stored version it replaces.
+	restore := func() error {
+		_, _ = c.store.Load()
+		return c.save(c.readSnap())
+	}
+
+	persist := func() error {
+		var newSnap snapshot
+		for attempt := 1; ; attempt++ {
+			// An edit that landed since the last clock tick must be merged
+			// now, or this save would overwrite it and a conditional write
+			// would be judged against a version that predates it.
+			_, overwrite := absorb()
+			if !dirty {
+				if overwrite {
+					return restore()
+				}
+				return nil
+			}
+			if overwrite {
+				_, _ = c.store.Load() // local state wins; adopt the stored version only to replace it
+			}
+			chans := setToSortedSlice(desired)
+			newSnap = snapshot{
+				Version:   version + 1,
+				Account:   c.account,
+				UpdatedAt: time.Now().UTC(),
+				Channels:  chans,
+				Active:    activeNames(chans, c.clk.Now()),
+			}
+			err := c.save(newSnap)
+			if err == nil {
+				break
+			}
+			if !errors.Is(err, ErrStoreConflict) || attempt == saveAttempts {
+				return err
+			}
+			lg.Warn("store changed while saving; reloading", "attempt", attempt, "policy", c.reload)
+			if c.reload == ReloadLocal || c.reload == ReloadOff {
+				// local state wins; adopt the stored version only to replace it
+				_, _ = c.store.Load()
+			}
+		}
+		version = newSnap.Version
+
+		// Windows that opened or closed alongside this write still deserve
+		// their own audit line unless the channel was edited anyway.
+		touched := make(map[string]bool, len(pending))
+		for _, e := range pending {
+			touched[e.Channel] = true
+		}
+		for _, ch := range windowChanges(c.readSnap().Active, newSnap.Active) {
+			if !touched[ch.channel] {
+				pending = append(pending, auditEntries(types.IRCCommand{Op: "SCHEDULE", Source: types.SourceSchedule}, []change{ch})...)
+			}
+		}
+
+		for i := range pending {
+			pending[i].Version = version
+		}
+		if err := c.store.AppendAudit(pending); err != nil {
+			// the channel set is authoritative; a lost audit line is not fatal
+			lg.Error("audit log append failed", "err", err, "entries", len(pending), "version", version)
+		}
+		pending = pending[:0]
+		c.writeSnap(newSnap)
+		c.nonBlockingNotify()
+		lg.Info("persisted snapshot", "version", version, "channels", len(newSnap.Channels))
+		dirty = false
+		return nil
+	}
+
+	// reload picks up external edits on the clock tick, giving them a new
+	// version. Only failing to write the store back is fatal.
+	reload := func() error {
+		changed, overwrite := absorb()
+		if overwrite {
+			return restore()
+		}
+		if !changed {
+			return nil
+		}
+		debounce = nil
+		return persist()
+	}
 
 	for {
 		select {
@@ -114,72 +292,314 @@ func (c *Controller) Run(ctx context.Context) error {
 				"reason", "context_canceled",
 				"version", s.Version,
 				"channels_count", len(s.Channels),
-				"path", c.path,
+				"store", c.store.String(),
 				"account", c.account,
 			)
 
 			return ctx.Err()
 
 		case cmd := <-c.controlCh:
-			ch, ok := normalizeChannel(cmd.Channel)
-			if !ok {
-				lg.Debug("dropping invalid command", "op", cmd.Op, "raw_channel", cmd.Channel)
+			if cmd.ExpectedVersion != 0 {
+				// Conditional writes are judged against everything applied so
+				// far, so flush pending changes first and persist the result
+				// immediately so the caller learns the version it produced.
+				if err := persist(); err != nil {
+					reply(cmd, types.CommandResult{Version: version, Err: err})
+					return err
+				}
+				debounce = nil
+				if cmd.ExpectedVersion != version {
+					lg.Info("version conflict",
+						"op", cmd.Op, "channel", cmd.Channel,
+						"expected_version", cmd.ExpectedVersion, "version", version)
+					reply(cmd, types.CommandResult{Version: version, Conflict: true})
+					continue
+				}
+			}
+
+			changes, err := c.apply(desired, cmd)
+			if err != nil {
+				lg.Debug("dropping invalid command", "op", cmd.Op, "raw_channel", cmd.Channel, "err", err)
+				reply(cmd, types.CommandResult{Version: version, Err: err})
 				continue
 			}
+			if len(changes) > 0 {
+				dirty = true
+				pending = append(pending, auditEntries(cmd, changes)...)
+			}
 
-			switch cmd.Op {
-			case "JOIN":
-				if _, exists := desired[ch]; !exists {
-					desired[ch] = struct{}{}
-					dirty = true
-					lg.Info("desired add", "channel", ch)
-					if debounce == nil {
-						debounce = time.After(time.Duration(c.writeDebounceMs) * time.Millisecond)
-					}
-				}
-			case "PART":
-				if _, exists := desired[ch]; exists {
-					delete(desired, ch)
-					dirty = true
-					lg.Info("desired remove", "channel", ch)
-					if debounce == nil {
-						debounce = time.After(time.Duration(c.writeDebounceMs) * time.Millisecond)
-					}
+			if cmd.ExpectedVersion != 0 {
+				if err := persist(); err != nil {
+					reply(cmd, types.CommandResult{Version: version, Err: err})
+					return err
 				}
-			default:
-				lg.Debug("unknown op", "op", cmd.Op)
+			} else if dirty && debounce == nil {
+				debounce = time.After(time.Duration(c.writeDebounceMs) * time.Millisecond)
 			}
+			reply(cmd, types.CommandResult{Version: version})
 
-		case <-debounce:
-			if dirty {
-				version++
-				newSnap := snapshot{
-					Version:   version,
-					Account:   c.account,
-					UpdatedAt: time.Now().UTC(),
-					Channels:  setToSortedSlice(desired),
+		case <-clockTick.C:
+			if err := reload(); err != nil {
+				return err
+			}
+			now := c.clk.Now()
+			if changes := expire(desired, now); len(changes) > 0 {
+				for _, ch := range changes {
+					lg.Info("desired remove", "channel", ch.channel, "source", types.SourceExpiry)
 				}
-
-				if err := c.writeFile(newSnap); err != nil {
-					return err
+				dirty = true
+				pending = append(pending, auditEntries(types.IRCCommand{Op: "EXPIRE", Source: types.SourceExpiry}, changes)...)
+				if debounce == nil {
+					debounce = time.After(time.Duration(c.writeDebounceMs) * time.Millisecond)
 				}
-				c.writeSnap(newSnap)
-				c.nonBlockingNotify()
-				lg.Info("persisted snapshot", "version", version, "channels", len(newSnap.Channels))
 			}
-			dirty = false
+			if dirty {
+				continue // the pending persist recomputes the active set
+			}
+
+			// Schedule windows change what the rectifier should join without
+			// changing the stored set, so publish a new version in memory only.
+			cur := c.readSnap()
+			active := activeNames(cur.Channels, now)
+			changes := windowChanges(cur.Active, active)
+			if len(changes) == 0 {
+				continue
+			}
+			version++
+			next := cur
+			next.Version = version
+			next.UpdatedAt = now.UTC()
+			next.Active = active
+			c.writeSnap(next)
+			c.nonBlockingNotify()
+			entries := auditEntries(types.IRCCommand{Op: "SCHEDULE", Source: types.SourceSchedule}, changes)
+			for i := range entries {
+				entries[i].Version = version
+				lg.Info("schedule window "+entries[i].Op, "channel", entries[i].Channel, "version", version)
+			}
+			if err := c.store.AppendAudit(entries); err != nil {
+				lg.Error("audit log append failed", "err", err, "entries", len(entries), "version", version)
+			}
+
+		case <-debounce:
+			if err := persist(); err != nil {
+				return err
+			}
 			debounce = nil
 		}
 	}
 }
 
+type change struct {
+	op      string // "add", "update", "remove", "activate" or "deactivate"
+	channel string
+}
+
+func activeNames(entries []types.ChannelEntry, now time.Time) []string {
+	out := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if ActiveAt(e, now) {
+			out = append(out, e.Name)
+		}
+	}
+	return out
+}
+
+// windowChanges diffs two sorted active lists.
+func windowChanges(prev, next []string) []change {
+	var changes []change
+	i, j := 0, 0
+	for i < len(prev) || j < len(next) {
+		switch {
+		case j == len(next) || (i < len(prev) && prev[i] < next[j]):
+			changes = append(changes, change{"deactivate", prev[i]})
+			i++
+		case i == len(prev) || next[j] < prev[i]:
+			changes = append(changes, change{"activate", next[j]})
+			j++
+		default:
+			i++
+			j++
+		}
+	}
+	return changes
+}
+
+// apply mutates desired according to cmd and returns what changed.
+func (c *Controller) apply(desired map[string]types.ChannelEntry, cmd types.IRCCommand) ([]change, error) {
+	switch cmd.Op {
+	case "JOIN", "PART":
+		ch, err := ValidateChannel(cmd.Channel)
+		if err != nil {
+			return nil, err
+		}
+		cur, exists := desired[ch]
+		if cmd.Op == "PART" {
+			if !exists {
+				return nil, nil
+			}
+			delete(desired, ch)
+			c.lg.Info("desired remove", "channel", ch, "source", cmd.Source, "principal", cmd.Principal)
+			return []change{{"remove", ch}}, nil
+		}
+
+		next := types.ChannelEntry{Name: ch}
+		if cmd.Meta != nil {
+			meta, err := normalizeMeta(*cmd.Meta, c.clk.Now())
+			if err != nil {
+				return nil, err
+			}
+			next.ChannelMeta = meta
+		} else if exists {
+			return nil, nil // plain re-join keeps existing metadata
+		}
+		if exists && metaEqual(cur.ChannelMeta, next.ChannelMeta) {
+			return nil, nil
+		}
+		desired[ch] = next
+		if exists {
+			c.lg.Info("desired update", "channel", ch, "source", cmd.Source, "principal", cmd.Principal)
+			return []change{{"update", ch}}, nil
+		}
+		c.lg.Info("desired add", "channel", ch, "source", cmd.Source, "principal", cmd.Principal)
+		return []change{{"add", ch}}, nil
+
+	case "REPLACE":
+		now := c.clk.Now()
+		next := make(map[string]types.ChannelEntry, len(cmd.Entries))
+		for _, e := range cmd.Entries {
+			ch, err := ValidateChannel(e.Name)
+			if err != nil {
+				return nil, err
+			}
+			meta, err := normalizeMeta(e.ChannelMeta, now)
+			if err != nil {
+				return nil, fmt.Errorf("channel %s: %w", ch, err)
+			}
+			next[ch] = types.ChannelEntry{Name: ch, ChannelMeta: meta}
+		}
+		return c.replaceAll(desired, next, cmd), nil
+
+	default:
+		return nil, fmt.Errorf("unknown op %q", cmd.Op)
+	}
+}
+
+// replaceAll makes desired equal to next and returns what changed.
+func (c *Controller) replaceAll(desired, next map[string]types.ChannelEntry, cmd types.IRCCommand) []change {
+	var changes []change
+	for _, e := range setToSortedSlice(desired) {
+		if _, keep := next[e.Name]; !keep {
+			delete(desired, e.Name)
+			c.lg.Info("desired remove", "channel", e.Name, "source", cmd.Source, "principal", cmd.Principal)
+			changes = append(changes, change{"remove", e.Name})
+		}
+	}
+	for _, e := range setToSortedSlice(next) {
+		cur, exists := desired[e.Name]
+		switch {
+		case !exists:
+			c.lg.Info("desired add", "channel", e.Name, "source", cmd.Source, "principal", cmd.Principal)
+			changes = append(changes, change{"add", e.Name})
+		case !metaEqual(cur.ChannelMeta, e.ChannelMeta):
+			c.lg.Info("desired update", "channel", e.Name, "source", cmd.Source, "principal", cmd.Principal)
+			changes = append(changes, change{"update", e.Name})
+		default:
+			continue
+		}
+		desired[e.Name] = e
+	}
+	return changes
+}
+
+// expire removes entries whose ExpiresAt is at or before now.
+func expire(desired map[string]types.ChannelEntry, now time.Time) []change {
+	var changes []change
+	for _, e := range setToSortedSlice(desired) {
+		if e.ExpiresAt != nil && !now.Before(*e.ExpiresAt) {
+			delete(desired, e.Name)
+			changes = append(changes, change{"remove", e.Name})
+		}
+	}
+	return changes
+}
+
+func auditEntries(cmd types.IRCCommand, changes []change) []types.AuditEntry {
+	source := cmd.Source
+	if source == "" {
+		source = types.SourceAPI
+	}
+	now := time.Now().UTC()
+	out := make([]types.AuditEntry, 0, len(changes))
+	for _, ch := range changes {
+		out = append(out, types.AuditEntry{
+			Time:      now,
+			Principal: cmd.Principal,
+			Source:    source,
+			Command:   cmd.Op,
+			Op:        ch.op,
+			Channel:   ch.channel,
+		})
+	}
+	return out
+}
+
+func reply(cmd types.IRCCommand, res types.CommandResult) {
+	if cmd.Result == nil {
+		return
+	}
+	select {
+	case cmd.Result <- res:
+	default:
+		// caller must provide a buffered channel; never block the controller
+	}
+}
+
+// Snapshot returns the channels that should be joined right now: every
+// desired channel whose schedule window is open.
 func (c *Controller) Snapshot() (version uint64, channels []string, updatedAt time.Time, account string) {
 	s := c.readSnap()
-	cp := make([]string, len(s.Channels))
+	cp := make([]string, len(s.Active))
+	copy(cp, s.Active)
+	return s.Version, cp, s.UpdatedAt, s.Account
+}
+
+// Entries returns every configured channel with its metadata, including
+// ones whose schedule is currently closed, sorted by name.
+func (c *Controller) Entries() (version uint64, entries []types.ChannelEntry, updatedAt time.Time, account string) {
+	s := c.readSnap()
+	cp := make([]types.ChannelEntry, len(s.Channels))
 	copy(cp, s.Channels)
 	return s.Version, cp, s.UpdatedAt, s.Account
 }
 
+// ActiveEntries is Entries restricted to the channels Snapshot reports.
+func (c *Controller) ActiveEntries() (version uint64, entries []types.ChannelEntry, updatedAt time.Time, account string) {
+	s := c.readSnap()
+	out := make([]types.ChannelEntry, 0, len(s.Active))
+	i := 0
+	for _, e := range s.Channels {
+		if i < len(s.Active) && s.Active[i] == e.Name {
+			out = append(out, e)
+			i++
+		}
+	}
+	return s.Version, out, s.UpdatedAt, s.Account
+}
+
+// History returns up to limit audit entries for channel (all channels when
+// empty), oldest first. Entries only appear once their version is persisted.
+func (c *Controller) History(channel string, limit int) ([]types.AuditEntry, error) {
+	if channel != "" {
+		ch, err := ValidateChannel(channel)
+		if err != nil {
+			return nil, err
+		}
+		channel = ch
+	}
+	return c.store.ReadAudit(channel, limit)
+}
+
 func (c *Controller) Updates() <-chan struct{} {
 	return c.updatesCh
 }
@@ -204,98 +624,40 @@ func (c *Controller) nonBlockingNotify() {
 	}
 }
 
-func normalizeChannel(raw string) (string, bool) {
-	if raw == "" {
-		return "", false
-	}
-	var s string
-	for i := 0; i < len(raw); i++ {
-		if raw[i] != ' ' && raw[i] != '\t' && raw[i] != '\n' && raw[i] != '\r' {
-			s = raw[i:]
-			break
-		}
-	}
-	if s == "" {
-		return "", false
-	}
-
-	b := make([]byte, 0, len(s)+1)
-	for i := 0; i < len(s); i++ {
-		ch := s[i]
-		if ch >= 'A' && ch <= 'Z' {
-			ch = ch - 'A' + 'a'
-		}
-		b = append(b, ch)
-	}
-	if b[0] != '#' {
-		b = append([]byte{'#'}, b...)
-	}
-	return string(b), true
-}
-
-func sliceToSet(xs []string) map[string]struct{} {
-	m := make(map[string]struct{}, len(xs))
+// entriesToSet indexes entries by normalized name, dropping (and logging)
+// any that fail validation.
+func (c *Controller) entriesToSet(xs []types.ChannelEntry) map[string]types.ChannelEntry {
+	m := make(map[string]types.ChannelEntry, len(xs))
 	for _, x := range xs {
-		if ch, ok := normalizeChannel(x); ok {
-			m[ch] = struct{}{}
+		ch, err := ValidateChannel(x.Name)
+		if err != nil {
+			c.lg.Warn("ignoring invalid stored channel", "raw_channel", x.Name, "err", err)
+			continue
 		}
+		x.Name = ch
+		m[ch] = compileSchedule(x)
 	}
 	return m
 }
 
-func setToSortedSlice(m map[string]struct{}) []string {
-	out := make([]string, 0, len(m))
-	for k := range m {
-		out = append(out, k)
+// Now is the controller's clock, which decides schedule windows.
+func (c *Controller) Now() time.Time { return c.clk.Now() }
+
+func setToSortedSlice(m map[string]types.ChannelEntry) []types.ChannelEntry {
+	out := make([]types.ChannelEntry, 0, len(m))
+	for _, e := range m {
+		out = append(out, e)
 	}
-	sort.Strings(out)
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
 	return out
 }
 
-func (c *Controller) writeFile(s snapshot) error {
-	dir := filepath.Dir(c.path)
-	if err := os.MkdirAll(dir, 0o700); err != nil {
-		return fmt.Errorf("mkdir %s: %w", dir, err)
-	}
-	tmp := c.path + ".tmp"
-
-	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
-	if err != nil {
-		return fmt.Errorf("open tmp: %w", err)
-	}
-	enc := json.NewEncoder(f)
-	enc.SetIndent("", "  ")
-	onDisk := types.Channels{
-		Schema:    c.schema,
+// save writes s to the store.
+func (c *Controller) save(s snapshot) error {
+	return c.store.Save(types.Channels{
+		Schema:    types.ChannelsSchema,
 		Account:   c.account,
 		UpdatedAt: s.UpdatedAt,
 		Channels:  s.Channels,
-	}
-	if err := enc.Encode(&onDisk); err != nil {
-		_ = f.Close()
-		return fmt.Errorf("encode json: %w", err)
-	}
-	if err := f.Sync(); err != nil {
-		_ = f.Close()
-		return fmt.Errorf("fsync tmp: %w", err)
-	}
-	if err := f.Close(); err != nil {
-		return fmt.Errorf("close tmp: %w", err)
-	}
-	if err := os.Rename(tmp, c.path); err != nil {
-		return fmt.Errorf("rename tmp→final: %w", err)
-	}
-	return nil
-}
-
-func loadFile(path string) (types.Channels, error) {
-	var v types.Channels
-	b, err := os.ReadFile(path)
-	if err != nil {
-		return v, err
-	}
-	if err := json.Unmarshal(b, &v); err != nil {
-		return v, fmt.Errorf("decode %s: %w", path, err)
-	}
-	return v, nil
+	})
 }
@@ -0,0 +1,329 @@
+package channelrecord
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/observe"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/types"
+)
+
+func TestController_ExpectedVersion(t *testing.T) {
+	controlCh := make(chan types.IRCCommand)
+	c, err := NewController(filepath.Join(t.TempDir(), "channels.json"), "me", controlCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = c.Run(ctx) }()
+
+	send := func(cmd types.IRCCommand) types.CommandResult {
+		res := make(chan types.CommandResult, 1)
+		cmd.Result = res
+		controlCh <- cmd
+		select {
+		case out := <-res:
+			return out
+		case <-time.After(time.Second):
+			t.Fatal("no result from controller")
+			return types.CommandResult{}
+		}
+	}
+
+	out := send(types.IRCCommand{Op: "JOIN", Channel: "#chess", ExpectedVersion: 1})
+	if out.Conflict || out.Err != nil || out.Version != 2 {
+		t.Fatalf("first conditional join = %+v, want version 2", out)
+	}
+	if v, chans, _, _ := c.Snapshot(); v != 2 || len(chans) != 1 {
+		t.Fatalf("snapshot = v%d %v, want v2 [#chess]", v, chans)
+	}
+
+	// A second writer still holding version 1 must be refused.
+	out = send(types.IRCCommand{Op: "PART", Channel: "#chess", ExpectedVersion: 1})
+	if !out.Conflict || out.Version != 2 {
+		t.Fatalf("stale part = %+v, want conflict at version 2", out)
+	}
+
+	out = send(types.IRCCommand{Op: "REPLACE", Entries: []types.ChannelEntry{{Name: "#a_b_c"}, {Name: "#speedrun"}}, ExpectedVersion: 2})
+	if out.Conflict || out.Version != 3 {
+		t.Fatalf("replace = %+v, want version 3", out)
+	}
+	if _, chans, _, _ := c.Snapshot(); len(chans) != 2 || chans[0] != "#a_b_c" || chans[1] != "#speedrun" {
+		t.Fatalf("channels after replace = %v", chans)
+	}
+}
+
+func TestController_AuditHistory(t *testing.T) {
+	controlCh := make(chan types.IRCCommand)
+	c, err := NewController(filepath.Join(t.TempDir(), "channels.json"), "me", controlCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = c.Run(ctx) }()
+
+	send := func(cmd types.IRCCommand) {
+		res := make(chan types.CommandResult, 1)
+		cmd.Result = res
+		cmd.ExpectedVersion, _, _, _ = c.Snapshot()
+		controlCh <- cmd
+		if out := <-res; out.Err != nil || out.Conflict {
+			t.Fatalf("command %+v failed: %+v", cmd, out)
+		}
+	}
+
+	send(types.IRCCommand{Op: "JOIN", Channel: "#chess", Source: types.SourceHTTP, Principal: "alice"})
+	send(types.IRCCommand{Op: "JOIN", Channel: "#speedrun"})
+	send(types.IRCCommand{Op: "PART", Channel: "#chess", Source: types.SourceHTTP, Principal: "bob"})
+
+	all, err := c.History("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("history has %d entries, want 3: %+v", len(all), all)
+	}
+
+	chess, err := c.History("CHESS", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chess) != 2 {
+		t.Fatalf("chess history has %d entries, want 2", len(chess))
+	}
+	last := chess[1]
+	if last.Op != "remove" || last.Principal != "bob" || last.Source != types.SourceHTTP || last.Version != 4 {
+		t.Fatalf("last chess entry = %+v, want remove by bob at v4", last)
+	}
+	if all[1].Source != types.SourceAPI {
+		t.Fatalf("unattributed command source = %q, want %q", all[1].Source, types.SourceAPI)
+	}
+
+	if latest, _ := c.History("", 1); len(latest) != 1 || latest[0].Channel != "#chess" {
+		t.Fatalf("limit=1 = %+v, want newest entry only", latest)
+	}
+}
+
+func TestController_MigratesSchemaV1(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "channels.json")
+	v1 := `{"schema":1,"account":"me","updated_at":"2025-11-13T20:48:31Z","channels":["#Chess","speedrun","#bad,name"]}`
+	if err := os.WriteFile(path, []byte(v1), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewController(path, "me", make(chan types.IRCCommand))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, entries, _, _ := c.Entries()
+	if len(entries) != 2 || entries[0].Name != "#chess" || entries[1].Name != "#speedrun" {
+		t.Fatalf("entries = %+v, want #chess and #speedrun", entries)
+	}
+
+	onDisk, err := loadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if onDisk.Schema != types.ChannelsSchema || len(onDisk.Channels) != 2 {
+		t.Fatalf("file after migration = %+v, want schema %d with 2 channels", onDisk, types.ChannelsSchema)
+	}
+}
+
+func TestController_JoinMetadataAndExpiry(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+	c := &Controller{clk: newFakeClock(start), lg: observe.C("controller_test")}
+	desired := map[string]types.ChannelEntry{}
+
+	exp := start.Add(time.Hour)
+	changes, err := c.apply(desired, types.IRCCommand{Op: "JOIN", Channel: "#chess",
+		Meta: &types.ChannelMeta{Tags: []string{"Tier1", "esports", "tier1"}, Priority: 5, ExpiresAt: &exp}})
+	if err != nil || len(changes) != 1 || changes[0].op != "add" {
+		t.Fatalf("join = %+v, %v; want one add", changes, err)
+	}
+	if got := desired["#chess"].Tags; len(got) != 2 || got[0] != "esports" || got[1] != "tier1" {
+		t.Fatalf("tags = %v, want [esports tier1]", got)
+	}
+
+	// A plain re-join keeps metadata; a join with new metadata updates it.
+	if changes, _ := c.apply(desired, types.IRCCommand{Op: "JOIN", Channel: "#chess"}); len(changes) != 0 {
+		t.Fatalf("plain re-join changed state: %+v", changes)
+	}
+	changes, _ = c.apply(desired, types.IRCCommand{Op: "JOIN", Channel: "#chess", Meta: &types.ChannelMeta{Priority: 9}})
+	if len(changes) != 1 || changes[0].op != "update" || desired["#chess"].ExpiresAt != nil {
+		t.Fatalf("metadata update = %+v, entry %+v", changes, desired["#chess"])
+	}
+
+	past := start.Add(-time.Second)
+	if _, err := c.apply(desired, types.IRCCommand{Op: "JOIN", Channel: "#speedrun",
+		Meta: &types.ChannelMeta{ExpiresAt: &past}}); err == nil {
+		t.Fatal("expected error for expiry in the past")
+	}
+
+	soon := start.Add(time.Minute)
+	desired["#speedrun"] = types.ChannelEntry{Name: "#speedrun", ChannelMeta: types.ChannelMeta{ExpiresAt: &soon}}
+	if got := expire(desired, start); len(got) != 0 {
+		t.Fatalf("expired too early: %+v", got)
+	}
+	if got := expire(desired, soon); len(got) != 1 || got[0].channel != "#speedrun" {
+		t.Fatalf("expire = %+v, want #speedrun removed", got)
+	}
+	if _, ok := desired["#chess"]; !ok {
+		t.Fatal("#chess has no expiry and must stay")
+	}
+}
+
+func TestController_ReloadsExternalEdit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "channels.json")
+	controlCh := make(chan types.IRCCommand)
+	c, err := NewController(path, "me", controlCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = c.Run(ctx) }()
+
+	res := make(chan types.CommandResult, 1)
+	controlCh <- types.IRCCommand{Op: "JOIN", Channel: "#chess", ExpectedVersion: 1, Result: res}
+	if out := <-res; out.Version != 2 {
+		t.Fatalf("join = %+v, want version 2", out)
+	}
+	<-c.Updates()
+
+	edit := `{"schema":2,"account":"me","channels":[{"name":"#chess","priority":4},"#Speedrun"]}`
+	if err := os.WriteFile(path, []byte(edit), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-c.Updates():
+	case <-time.After(3 * clockCheckInterval):
+		t.Fatal("external edit not picked up")
+	}
+	v, entries, _, _ := c.Entries()
+	if v != 3 || len(entries) != 2 || entries[0].Priority != 4 || entries[1].Name != "#speedrun" {
+		t.Fatalf("after reload v%d %+v", v, entries)
+	}
+	hist, _ := c.History("#speedrun", 0)
+	if len(hist) != 1 || hist[0].Source != types.SourceFile || hist[0].Version != 3 {
+		t.Fatalf("reload audit = %+v", hist)
+	}
+
+	// The file is rewritten in canonical form.
+	onDisk, err := loadFile(path)
+	if err != nil || len(onDisk.Channels) != 2 || onDisk.Channels[1].Name != "#speedrun" {
+		t.Fatalf("file after reload = %+v, %v", onDisk, err)
+	}
+}
+
+func TestController_MergesEditBeforeSave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "channels.json")
+	controlCh := make(chan types.IRCCommand)
+	c, err := NewController(path, "me", controlCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = c.Run(ctx) }()
+
+	// A hand edit followed at once by an API change, well inside one
+	// clock tick: the edit is merged first and takes a version of its own,
+	// so a writer that has not seen it is refused.
+	edit := `{"schema":2,"account":"me","channels":["#handedit"]}`
+	if err := os.WriteFile(path, []byte(edit), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	send := func(cmd types.IRCCommand) types.CommandResult {
+		res := make(chan types.CommandResult, 1)
+		cmd.Result = res
+		controlCh <- cmd
+		return <-res
+	}
+	if out := send(types.IRCCommand{Op: "JOIN", Channel: "#apijoin", ExpectedVersion: 1}); !out.Conflict || out.Version != 2 {
+		t.Fatalf("stale join = %+v, want conflict at version 2", out)
+	}
+	if out := send(types.IRCCommand{Op: "JOIN", Channel: "#apijoin", ExpectedVersion: 2}); out.Err != nil || out.Conflict || out.Version != 3 {
+		t.Fatalf("join = %+v, want version 3", out)
+	}
+
+	onDisk, err := loadFile(path)
+	if err != nil || len(onDisk.Channels) != 2 || onDisk.Channels[0].Name != "#apijoin" || onDisk.Channels[1].Name != "#handedit" {
+		t.Fatalf("file after join = %+v, %v", onDisk, err)
+	}
+	if _, entries, _, _ := c.Entries(); len(entries) != 2 {
+		t.Fatalf("entries = %+v", entries)
+	}
+	if hist, _ := c.History("#handedit", 0); len(hist) != 1 || hist[0].Source != types.SourceFile || hist[0].Version != 2 {
+		t.Fatalf("edit audit = %+v", hist)
+	}
+}
+
+func TestController_RestoresRejectedEdit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "channels.json")
+	controlCh := make(chan types.IRCCommand)
+	c, err := NewController(path, "me", controlCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = c.Run(ctx) }()
+
+	res := make(chan types.CommandResult, 1)
+	controlCh <- types.IRCCommand{Op: "JOIN", Channel: "#chess", ExpectedVersion: 1, Result: res}
+	if out := <-res; out.Version != 2 {
+		t.Fatalf("join = %+v, want version 2", out)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"schema":2,"account":"me","channels":["#no"]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(3 * clockCheckInterval)
+	for {
+		onDisk, err := loadFile(path)
+		if err == nil && len(onDisk.Channels) == 1 && onDisk.Channels[0].Name == "#chess" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("rejected edit not replaced: %+v, %v", onDisk, err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if v, entries, _, _ := c.Entries(); v != 2 || len(entries) != 1 {
+		t.Fatalf("after rejected edit v%d %+v, want v2 [#chess]", v, entries)
+	}
+}
+
+func TestController_ValidateStoredRejectsWholeEdit(t *testing.T) {
+	c := &Controller{account: "me", lg: observe.C("controller_test")}
+	for _, v := range []types.Channels{
+		{Account: "someone_else"},
+		{Schema: types.ChannelsSchema + 1},
+		{Channels: []types.ChannelEntry{{Name: "#chess"}, {Name: "#no"}}},
+		{Channels: []types.ChannelEntry{{Name: "#chess", ChannelMeta: types.ChannelMeta{Tags: []string{"bad tag"}}}}},
+	} {
+		if _, err := c.validateStored(v); err == nil {
+			t.Errorf("validateStored(%+v) accepted", v)
+		}
+	}
+	past := time.Unix(1, 0)
+	got, err := c.validateStored(types.Channels{Channels: []types.ChannelEntry{{Name: "Chess", ChannelMeta: types.ChannelMeta{ExpiresAt: &past}}}})
+	if err != nil || got["#chess"].ExpiresAt == nil {
+		t.Fatalf("expired entry should be accepted for the sweep: %+v, %v", got, err)
+	}
+}
+
+func loadFile(path string) (types.Channels, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return types.Channels{}, err
+	}
+	return decodeChannels(path, b)
+}
@@ -0,0 +1,157 @@
+package channelrecord
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/observe"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/types"
+)
+
+// AutoDiscoveredTag marks channels added by the discovery policy.
+const AutoDiscoveredTag = "auto-discovered"
+
+// DesiredCatalog is the full configured set, as served by Controller.Entries.
+type DesiredCatalog interface {
+	Entries() (version uint64, entries []types.ChannelEntry, updatedAt time.Time, account string)
+}
+
+type DiscoveryConfig struct {
+	TTL      time.Duration // how long a discovered channel stays desired
+	MaxAuto  int           // global cap on auto-discovered channels
+	Priority int           // priority given to discovered channels
+	Follow   []string      // raid kinds to act on: "raid", "host"
+}
+
+func NewDefaultDiscoveryConfig() DiscoveryConfig {
+	return DiscoveryConfig{
+		TTL:      2 * time.Hour,
+		MaxAuto:  20,
+		Priority: -1, // behind anything an operator added
+		Follow:   []string{"raid", "host"},
+	}
+}
+
+// RunDiscovery follows tracked channels out: when a tracked channel raids
+// or hosts an untracked one, the target is added to the desired set, tagged
+// AutoDiscoveredTag with an expiry of cfg.TTL. Following again into an
+// already auto-discovered channel refreshes its expiry; channels an
+// operator added are never modified.
+//
+// Outgoing raids come from EventSub (see package eventsub), since IRC only
+// reports a raid in the channel being raided; hosts come from HOSTTARGET in
+// the hosting channel. A raid into a tracked channel never adds the raider.
+func RunDiscovery(ctx context.Context, catalog DesiredCatalog, raids <-chan types.RaidEvent, controlCh chan<- types.IRCCommand, cfg DiscoveryConfig) error {
+	d := &discoverer{
+		catalog:  catalog,
+		cfg:      cfg,
+		clk:      realClock{},
+		inflight: make(map[string]time.Time),
+		lg: observe.C("discovery").With(
+			"ttl_s", cfg.TTL.Seconds(), "max_auto", cfg.MaxAuto, "follow", cfg.Follow),
+	}
+	d.lg.Info("discovery starting")
+	for {
+		select {
+		case <-ctx.Done():
+			d.lg.Info("discovery stopping", "reason", "context_canceled")
+			return ctx.Err()
+		case evt := <-raids:
+			if cmd, ok := d.decide(evt); ok {
+				select {
+				case controlCh <- cmd:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		}
+	}
+}
+
+// inflightTTL bounds how long an emitted add counts against the cap before
+// the controller's snapshot is expected to show it.
+const inflightTTL = 10 * time.Second
+
+type discoverer struct {
+	catalog  DesiredCatalog
+	cfg      DiscoveryConfig
+	clk      Clock
+	inflight map[string]time.Time // adds sent but maybe not yet in the snapshot
+	lg       *slog.Logger
+}
+
+func (d *discoverer) decide(evt types.RaidEvent) (types.IRCCommand, bool) {
+	if !d.follows(evt.Kind) {
+		return types.IRCCommand{}, false
+	}
+	from, errFrom := ValidateChannel(evt.From)
+	to, errTo := ValidateChannel(evt.To)
+	if errFrom != nil || errTo != nil || from == to {
+		d.lg.Debug("ignoring raid with invalid channels", "from", evt.From, "to", evt.To)
+		return types.IRCCommand{}, false
+	}
+
+	now := d.clk.Now()
+	_, entries, _, _ := d.catalog.Entries()
+	byName := make(map[string]types.ChannelEntry, len(entries))
+	auto := 0
+	for _, e := range entries {
+		byName[e.Name] = e
+		if e.HasTag(AutoDiscoveredTag) {
+			auto++
+		}
+	}
+	for name, at := range d.inflight {
+		if _, seen := byName[name]; seen || now.Sub(at) > inflightTTL {
+			delete(d.inflight, name)
+		}
+	}
+	auto += len(d.inflight)
+
+	if _, fromTracked := byName[from]; !fromTracked {
+		return types.IRCCommand{}, false // only raids out of a tracked channel are followed
+	}
+	if cur, toTracked := byName[to]; toTracked {
+		if cur.HasTag(AutoDiscoveredTag) {
+			return d.join(to, evt, now), true // refresh its expiry
+		}
+		return types.IRCCommand{}, false
+	}
+	target := to
+
+	if _, pending := d.inflight[target]; pending {
+		return types.IRCCommand{}, false
+	}
+	if auto >= d.cfg.MaxAuto {
+		d.lg.Info("discovery cap reached; not adding", "channel", target, "kind", evt.Kind, "auto_channels", auto)
+		return types.IRCCommand{}, false
+	}
+	d.inflight[target] = now
+	d.lg.Info("discovered channel", "channel", target, "kind", evt.Kind, "from", from, "to", to, "viewers", evt.Viewers)
+	return d.join(target, evt, now), true
+}
+
+func (d *discoverer) join(ch string, evt types.RaidEvent, now time.Time) types.IRCCommand {
+	exp := now.Add(d.cfg.TTL)
+	return types.IRCCommand{
+		Op:      "JOIN",
+		Channel: ch,
+		Meta: &types.ChannelMeta{
+			Tags:      []string{AutoDiscoveredTag, "via:" + evt.Kind},
+			Priority:  d.cfg.Priority,
+			Owner:     "discovery",
+			ExpiresAt: &exp,
+		},
+		Source: types.SourceDiscovery,
+	}
+}
+
+func (d *discoverer) follows(kind string) bool {
+	for _, k := range d.cfg.Follow {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
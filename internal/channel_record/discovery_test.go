@@ -0,0 +1,69 @@
+package channelrecord
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/observe"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/types"
+)
+
+type catalogStub struct{ entries []types.ChannelEntry }
+
+func (c *catalogStub) Entries() (uint64, []types.ChannelEntry, time.Time, string) {
+	return 1, c.entries, time.Time{}, "me"
+}
+
+func TestDiscovery_FollowsOutgoingRaidsWithinCap(t *testing.T) {
+	clk := newFakeClock(time.Unix(1_700_000_000, 0))
+	cat := &catalogStub{entries: []types.ChannelEntry{{Name: "#chess"}}}
+
+	cfg := NewDefaultDiscoveryConfig()
+	cfg.MaxAuto = 1
+	d := &discoverer{
+		catalog:  cat,
+		cfg:      cfg,
+		clk:      clk,
+		inflight: make(map[string]time.Time),
+		lg:       observe.C("discovery_test"),
+	}
+
+	// A raid into a tracked channel never adds the raider.
+	if cmd, ok := d.decide(types.RaidEvent{Kind: "raid", From: "#alice", To: "#chess", Viewers: 50}); ok {
+		t.Fatalf("incoming raid added %s", cmd.Channel)
+	}
+
+	cmd, ok := d.decide(types.RaidEvent{Kind: "host", From: "#chess", To: "#alice", Viewers: 50})
+	if !ok {
+		t.Fatal("expected the target of a tracked channel to be discovered")
+	}
+	if cmd.Op != "JOIN" || cmd.Channel != "#alice" || cmd.Source != types.SourceDiscovery {
+		t.Fatalf("cmd = %+v, want discovery JOIN #alice", cmd)
+	}
+	if !cmd.Meta.HasTag(AutoDiscoveredTag) || !cmd.Meta.HasTag("via:host") || cmd.Meta.ExpiresAt == nil || !cmd.Meta.ExpiresAt.Equal(clk.Now().Add(cfg.TTL)) {
+		t.Fatalf("meta = %+v, want auto-discovered tag and TTL expiry", cmd.Meta)
+	}
+
+	// The add is still in flight, so the cap of one is already used.
+	if _, ok := d.decide(types.RaidEvent{Kind: "raid", From: "#chess", To: "#bobby"}); ok {
+		t.Fatal("cap of 1 auto channel exceeded")
+	}
+
+	// Once the snapshot shows it, following #chess into #alice again only
+	// refreshes the expiry; a raid out of #alice back into #chess does not.
+	cat.entries = append(cat.entries, types.ChannelEntry{Name: "#alice",
+		ChannelMeta: types.ChannelMeta{Tags: []string{AutoDiscoveredTag}}})
+	clk.Advance(time.Minute)
+	cmd, ok = d.decide(types.RaidEvent{Kind: "raid", From: "#chess", To: "#alice"})
+	if !ok || cmd.Channel != "#alice" || !cmd.Meta.ExpiresAt.Equal(clk.Now().Add(cfg.TTL)) {
+		t.Fatalf("refresh = %+v, %v; want #alice with a fresh expiry", cmd, ok)
+	}
+	if cmd, ok := d.decide(types.RaidEvent{Kind: "raid", From: "#alice", To: "#chess"}); ok {
+		t.Fatalf("raid into an operator channel changed %s", cmd.Channel)
+	}
+
+	// Raids that don't touch a tracked channel are ignored.
+	if _, ok := d.decide(types.RaidEvent{Kind: "raid", From: "#xxxx", To: "#yyyy"}); ok {
+		t.Fatal("raid between untracked channels should be ignored")
+	}
+}
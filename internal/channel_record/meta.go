@@ -0,0 +1,94 @@
+package channelrecord
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/types"
+)
+
+const (
+	maxTags   = 16
+	maxTagLen = 32
+)
+
+// normalizeMeta lowercases, dedupes and sorts tags and rejects metadata the
+// controller cannot honour.
+func normalizeMeta(m types.ChannelMeta, now time.Time) (types.ChannelMeta, error) {
+	out := types.ChannelMeta{
+		Priority: m.Priority,
+		Owner:    strings.TrimSpace(m.Owner),
+	}
+	for _, raw := range m.Tags {
+		tag, err := normalizeTag(raw)
+		if err != nil {
+			return types.ChannelMeta{}, err
+		}
+		if !slices.Contains(out.Tags, tag) {
+			out.Tags = append(out.Tags, tag)
+		}
+	}
+	if len(out.Tags) > maxTags {
+		return types.ChannelMeta{}, fmt.Errorf("at most %d tags allowed", maxTags)
+	}
+	slices.Sort(out.Tags)
+
+	if m.ExpiresAt != nil {
+		if !m.ExpiresAt.After(now) {
+			return types.ChannelMeta{}, errors.New("expires_at is in the past")
+		}
+		t := m.ExpiresAt.UTC()
+		out.ExpiresAt = &t
+	}
+	if m.Schedule != nil {
+		sched, err := normalizeSchedule(*m.Schedule)
+		if err != nil {
+			return types.ChannelMeta{}, err
+		}
+		out.Schedule = sched
+	}
+	return out, nil
+}
+
+// normalizeTag accepts 1–32 characters of [a-z0-9_:-] after lowercasing.
+func normalizeTag(raw string) (string, error) {
+	tag := strings.ToLower(strings.TrimSpace(raw))
+	if tag == "" || len(tag) > maxTagLen {
+		return "", fmt.Errorf("tag %q must be 1-%d characters", raw, maxTagLen)
+	}
+	for i := 0; i < len(tag); i++ {
+		ch := tag[i]
+		if !(ch >= 'a' && ch <= 'z' || ch >= '0' && ch <= '9' || ch == '_' || ch == '-' || ch == ':') {
+			return "", fmt.Errorf("tag %q may only contain letters, digits, '_', '-' and ':'", raw)
+		}
+	}
+	return tag, nil
+}
+
+func metaEqual(a, b types.ChannelMeta) bool {
+	if a.Priority != b.Priority || a.Owner != b.Owner || !slices.Equal(a.Tags, b.Tags) {
+		return false
+	}
+	if !timePtrEqual(a.ExpiresAt, b.ExpiresAt) {
+		return false
+	}
+	return scheduleEqual(a.Schedule, b.Schedule)
+}
+
+func scheduleEqual(a, b *types.Schedule) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return timePtrEqual(a.Start, b.Start) && timePtrEqual(a.End, b.End) &&
+		a.Cron == b.Cron && a.Duration == b.Duration && a.TZ == b.TZ
+}
+
+func timePtrEqual(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
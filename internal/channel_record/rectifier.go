@@ -2,6 +2,7 @@ package channelrecord
 
 import (
 	"context"
+	"sort"
 	"strings"
 	"time"
 
@@ -16,6 +17,20 @@ type DesiredSnapshot interface {
 	Updates() <-chan struct{}
 }
 
+// DesiredEntries is optionally implemented by a DesiredSnapshot to expose
+// metadata for the channels Snapshot reports; the rectifier uses it to
+// spend join tokens on higher priority channels first.
+type DesiredEntries interface {
+	ActiveEntries() (version uint64, entries []types.ChannelEntry, updatedAt time.Time, account string)
+}
+
+// Gate switches the rectifier on and off as a whole; while inactive it
+// treats the desired set as empty. Used for active/standby replicas.
+type Gate interface {
+	Active() bool
+	Changes() <-chan struct{}
+}
+
 type Config struct {
 	TokensPerSecond float64
 	Burst           int
@@ -23,6 +38,11 @@ type Config struct {
 	BackoffMin      time.Duration
 	BackoffMax      time.Duration
 	Tick            time.Duration
+
+	// Status, when set, receives every phase transition.
+	Status *StatusBoard
+	// Gate, when set, must be active for any channel to be joined.
+	Gate Gate
 }
 
 func NewDefaultConfig() Config {
@@ -58,6 +78,7 @@ func Run(ctx context.Context, desired DesiredSnapshot, events <-chan types.Membe
 		lastDesiredV: 0,
 		lg:           lg,
 		clk:          realClock{},
+		status:       cfg.Status,
 	}
 
 	lg.Info("rectifier starting")
@@ -101,10 +122,13 @@ type chanState struct {
 	want      bool
 	have      bool
 	phase     phase
+	priority  int
 	lastTry   time.Time
 	deadline  time.Time
 	backoff   time.Duration
 	nextTryAt time.Time
+	reason    string // why the last Error happened
+	terminal  bool   // Twitch refused the channel; no retries until cleared
 }
 
 type reconciler struct {
@@ -115,8 +139,10 @@ type reconciler struct {
 	state        map[string]*chanState
 	tokenBucket  *bucket
 	lastDesiredV uint64
+	lastActive   bool
 	lg           *slog.Logger
 	clk          Clock
+	status       *StatusBoard
 }
 
 func (r *reconciler) loop(ctx context.Context) error {
@@ -124,6 +150,10 @@ func (r *reconciler) loop(ctx context.Context) error {
 	defer tick.Stop()
 
 	updates := r.desired.Updates()
+	var gateCh <-chan struct{}
+	if r.cfg.Gate != nil {
+		gateCh = r.cfg.Gate.Changes()
+	}
 
 	for {
 		select {
@@ -140,6 +170,11 @@ func (r *reconciler) loop(ctx context.Context) error {
 			r.observeDesired()
 			r.reconcile(r.clk.Now())
 
+		case <-gateCh:
+			r.lg.Info("gate changed", "active", r.cfg.Gate.Active())
+			r.observeDesired()
+			r.reconcile(r.clk.Now())
+
 		case evt := <-r.events:
 			r.lg.Debug("membership event", "op", evt.Op, "channel", evt.Channel)
 			r.observeEvent(evt)
@@ -149,20 +184,43 @@ func (r *reconciler) loop(ctx context.Context) error {
 }
 
 func (r *reconciler) observeDesired() {
-	v, chans, _, _ := r.desired.Snapshot()
-	if v == r.lastDesiredV {
+	var (
+		v       uint64
+		entries []types.ChannelEntry
+	)
+	if de, ok := r.desired.(DesiredEntries); ok {
+		v, entries, _, _ = de.ActiveEntries()
+	} else {
+		var chans []string
+		v, chans, _, _ = r.desired.Snapshot()
+		for _, ch := range chans {
+			entries = append(entries, types.ChannelEntry{Name: ch})
+		}
+	}
+	active := r.cfg.Gate == nil || r.cfg.Gate.Active()
+	if v == r.lastDesiredV && active == r.lastActive {
 		return
 	}
-	r.lg.Info("desired set changed", "version", v, "channels", len(chans))
-	for name, s := range r.state {
+	if !active {
+		entries = nil
+	}
+	r.lg.Info("desired set changed", "version", v, "channels", len(entries), "active", active)
+	for _, s := range r.state {
 		s.want = false
-		_ = name
 	}
-	for _, ch := range chans {
-		s := r.ensure(ch)
+	for _, e := range entries {
+		s := r.ensure(e.Name)
 		s.want = true
+		s.priority = e.Priority
+	}
+	for ch, s := range r.state {
+		if !s.want && s.terminal {
+			// dropping a refused channel from the desired set clears it
+			r.clearTerminal(ch, s)
+		}
 	}
 	r.lastDesiredV = v
+	r.lastActive = active
 }
 
 func (r *reconciler) observeEvent(evt types.MembershipEvent) {
@@ -175,7 +233,7 @@ func (r *reconciler) observeEvent(evt types.MembershipEvent) {
 		s := r.ensure(ch)
 		if !s.have {
 			s.have = true
-			s.phase = Joined
+			r.setPhase(ch, s, Joined)
 			r.lg.Info("join confirmed", "channel", ch)
 		}
 	case "PART":
@@ -186,17 +244,59 @@ func (r *reconciler) observeEvent(evt types.MembershipEvent) {
 		s := r.ensure(ch)
 		if s.have {
 			s.have = false
-			s.phase = Idle
+			r.setPhase(ch, s, Idle)
 			r.lg.Info("part confirmed", "channel", ch)
 		}
+	case "NOTICE":
+		ch := strings.ToLower(evt.Channel)
+		if !strings.HasPrefix(ch, "#") {
+			ch = "#" + ch
+		}
+		s, ok := r.state[ch]
+		if !ok || !terminalNotice(evt.Reason) {
+			return
+		}
+		// The refusal may land after the join already timed out.
+		if s.phase != Joining && (s.phase != Error || s.terminal || s.have) {
+			return
+		}
+		s.terminal = true
+		s.reason = evt.Reason
+		r.setPhase(ch, s, Error)
+		r.lg.Warn("join refused; not retrying until cleared", "channel", ch, "reason", evt.Reason)
+	case "CLEAR":
+		ch := strings.ToLower(evt.Channel)
+		if !strings.HasPrefix(ch, "#") {
+			ch = "#" + ch
+		}
+		if s, ok := r.state[ch]; ok && s.terminal {
+			r.clearTerminal(ch, s)
+			r.lg.Info("terminal error cleared", "channel", ch)
+		}
+	case "RESET":
+		// A new connection starts with no channels joined. Refused channels
+		// stay refused.
+		n := 0
+		for ch, s := range r.state {
+			if !s.have && s.phase != Joining && s.phase != Parting {
+				continue
+			}
+			s.have = false
+			s.backoff = r.cfg.BackoffMin
+			r.setPhase(ch, s, Idle)
+			n++
+		}
+		r.lg.Info("connection reset; membership cleared", "channels", n)
 	default:
 		// ignore
 	}
 }
 
 func (r *reconciler) reconcile(now time.Time) {
+	names := r.byPriority()
 
-	for name, s := range r.state {
+	for _, name := range names {
+		s := r.state[name]
 		if s.want {
 			continue
 		}
@@ -207,23 +307,41 @@ func (r *reconciler) reconcile(now time.Time) {
 			}
 		}
 
-		r.maybeTimeout(now, s)
+		r.maybeTimeout(now, name, s)
 	}
 
-	for name, s := range r.state {
+	for _, name := range names {
+		s := r.state[name]
 		if !s.want {
 			continue
 		}
-		if !s.have && (s.phase == Idle || s.phase == Error && now.After(s.nextTryAt)) {
+		if !s.have && (s.phase == Idle || s.phase == Error && !s.terminal && now.After(s.nextTryAt)) {
 			r.lg.Debug("trying JOIN", "channel", name, "phase", s.phase.String())
 			if r.trySend(now, "JOIN", name, s) {
 				continue
 			}
 		}
-		r.maybeTimeout(now, s)
+		r.maybeTimeout(now, name, s)
 	}
 }
 
+// byPriority lists tracked channels by descending priority, then name, so
+// that when the token bucket runs dry the important channels went first.
+func (r *reconciler) byPriority() []string {
+	names := make([]string, 0, len(r.state))
+	for name := range r.state {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		pi, pj := r.state[names[i]].priority, r.state[names[j]].priority
+		if pi != pj {
+			return pi > pj
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
 func (r *reconciler) trySend(now time.Time, op string, channel string, s *chanState) bool {
 	if !r.tokenBucket.take(now) {
 		r.lg.Debug("rate-limited; skipping for now", "op", op, "channel", channel)
@@ -235,12 +353,12 @@ func (r *reconciler) trySend(now time.Time, op string, channel string, s *chanSt
 		s.lastTry = now
 		s.deadline = now.Add(r.cfg.JoinTimeout)
 		if op == "JOIN" {
-			s.phase = Joining
+			r.setPhase(channel, s, Joining)
 			if s.backoff == 0 {
 				s.backoff = r.cfg.BackoffMin
 			}
 		} else {
-			s.phase = Parting
+			r.setPhase(channel, s, Parting)
 			if s.backoff == 0 {
 				s.backoff = r.cfg.BackoffMin
 			}
@@ -254,14 +372,16 @@ func (r *reconciler) trySend(now time.Time, op string, channel string, s *chanSt
 	}
 }
 
-func (r *reconciler) maybeTimeout(now time.Time, s *chanState) {
+func (r *reconciler) maybeTimeout(now time.Time, channel string, s *chanState) {
 	if (s.phase == Joining || s.phase == Parting) && now.After(s.deadline) {
 		op := s.phase.String()
 
-		s.phase = Error
+		s.reason = "timeout"
+		r.setPhase(channel, s, Error)
 		s.nextTryAt = now.Add(s.backoff)
 
 		r.lg.Info("operation timed out; scheduling retry",
+			"channel", channel,
 			"phase", op,
 			"next_try_in_s", s.backoff.Seconds(),
 		)
@@ -273,6 +393,32 @@ func (r *reconciler) maybeTimeout(now time.Time, s *chanState) {
 	}
 }
 
+func (r *reconciler) setPhase(channel string, s *chanState, p phase) {
+	s.phase = p
+	if p != Error {
+		s.reason = ""
+		s.terminal = false
+	}
+	r.status.set(channel, p, s.reason, s.terminal)
+}
+
+func (r *reconciler) clearTerminal(channel string, s *chanState) {
+	s.backoff = r.cfg.BackoffMin
+	r.setPhase(channel, s, Idle)
+}
+
+// terminalNotice reports NOTICE msg-ids that answer a JOIN with a refusal
+// retrying will not change.
+func terminalNotice(msgID string) bool {
+	switch msgID {
+	case "msg_channel_suspended", // suspended or does not exist
+		"msg_banned", // banned from the channel
+		"tos_ban":    // channel closed for a terms of service violation
+		return true
+	}
+	return false
+}
+
 func (r *reconciler) ensure(ch string) *chanState {
 	if st, ok := r.state[ch]; ok {
 		return st
@@ -166,3 +166,243 @@ func TestRectifier_PartConfirmResetsHave(t *testing.T) {
 		t.Fatalf("expected have=false after PART confirm, got %+v", st)
 	}
 }
+
+type entriesStub struct {
+	*desiredStub
+	entries []types.ChannelEntry
+}
+
+func (d entriesStub) ActiveEntries() (uint64, []types.ChannelEntry, time.Time, string) {
+	return d.v, d.entries, d.t, d.acct
+}
+
+func TestRectifier_JoinsHighestPriorityFirst(t *testing.T) {
+	clk := newFakeClock(time.Unix(1_700_000_000, 0))
+
+	cfg := NewDefaultConfig()
+	cfg.TokensPerSecond = 0.001
+	cfg.Burst = 1
+
+	ds := entriesStub{
+		desiredStub: newDesiredStub("me", nil, clk.Now()),
+		entries: []types.ChannelEntry{
+			{Name: "#aaaa"},
+			{Name: "#bbbb", ChannelMeta: types.ChannelMeta{Priority: 10}},
+			{Name: "#cccc", ChannelMeta: types.ChannelMeta{Priority: 5}},
+		},
+	}
+	out := make(chan types.IRCCommand, 4)
+	r := &reconciler{
+		desired:     ds,
+		out:         out,
+		cfg:         cfg,
+		state:       make(map[string]*chanState),
+		tokenBucket: newBucket(cfg.TokensPerSecond, cfg.Burst, clk),
+		lg:          observe.C("rectifier_test"),
+		clk:         clk,
+	}
+
+	r.observeDesired()
+	r.reconcile(clk.Now())
+
+	if len(out) != 1 {
+		t.Fatalf("emitted %d commands with one token, want 1", len(out))
+	}
+	if cmd := <-out; cmd.Channel != "#bbbb" {
+		t.Fatalf("first JOIN went to %s, want highest priority #bbbb", cmd.Channel)
+	}
+}
+
+type gateStub struct{ active bool }
+
+func (g *gateStub) Active() bool             { return g.active }
+func (g *gateStub) Changes() <-chan struct{} { return nil }
+
+func TestRectifier_StandbyGateHoldsJoins(t *testing.T) {
+	clk := newFakeClock(time.Unix(1_700_000_000, 0))
+
+	gate := &gateStub{}
+	cfg := NewDefaultConfig()
+	cfg.TokensPerSecond = 100
+	cfg.Burst = 10
+	cfg.Gate = gate
+
+	out := make(chan types.IRCCommand, 4)
+	r := &reconciler{
+		desired:     newDesiredStub("me", []string{"#chess"}, clk.Now()),
+		out:         out,
+		cfg:         cfg,
+		state:       make(map[string]*chanState),
+		tokenBucket: newBucket(cfg.TokensPerSecond, cfg.Burst, clk),
+		lg:          observe.C("rectifier_test"),
+		clk:         clk,
+	}
+
+	r.observeDesired()
+	r.reconcile(clk.Now())
+	if len(out) != 0 {
+		t.Fatalf("standby emitted %d commands", len(out))
+	}
+
+	gate.active = true
+	r.observeDesired()
+	r.reconcile(clk.Now())
+	if len(out) != 1 {
+		t.Fatalf("leader emitted %d commands, want JOIN", len(out))
+	}
+	if cmd := <-out; cmd.Op != "JOIN" || cmd.Channel != "#chess" {
+		t.Fatalf("got %+v, want JOIN #chess", cmd)
+	}
+	r.observeEvent(types.MembershipEvent{Op: "JOIN", Channel: "#chess"})
+
+	// Losing leadership parts everything.
+	gate.active = false
+	r.observeDesired()
+	r.reconcile(clk.Now())
+	if cmd := <-out; cmd.Op != "PART" || cmd.Channel != "#chess" {
+		t.Fatalf("got %+v, want PART #chess", cmd)
+	}
+}
+
+func TestRectifier_ResetRejoins(t *testing.T) {
+	clk := newFakeClock(time.Unix(1_700_000_000, 0))
+	cfg := NewDefaultConfig()
+	cfg.TokensPerSecond = 100
+	cfg.Burst = 10
+
+	ds := newDesiredStub("me", []string{"#chess"}, clk.Now())
+	out := make(chan types.IRCCommand, 4)
+	r := &reconciler{
+		desired:     ds,
+		out:         out,
+		cfg:         cfg,
+		state:       make(map[string]*chanState),
+		tokenBucket: newBucket(cfg.TokensPerSecond, cfg.Burst, clk),
+		lg:          observe.C("rectifier_test"),
+		clk:         clk,
+	}
+	r.observeDesired()
+	r.reconcile(clk.Now())
+	<-out
+	r.observeEvent(types.MembershipEvent{Op: "JOIN", Channel: "#chess"})
+	r.reconcile(clk.Now())
+	if len(out) != 0 {
+		t.Fatalf("joined channel re-sent: %+v", <-out)
+	}
+
+	r.observeEvent(types.MembershipEvent{Op: "RESET"})
+	if st := r.state["#chess"]; st.have || st.phase != Idle {
+		t.Fatalf("after reset: %+v", st)
+	}
+	r.reconcile(clk.Now())
+	select {
+	case cmd := <-out:
+		if cmd.Op != "JOIN" || cmd.Channel != "#chess" {
+			t.Fatalf("expected JOIN #chess, got %+v", cmd)
+		}
+	default:
+		t.Fatal("expected a rejoin after reset")
+	}
+}
+
+func TestRectifier_TerminalNoticeStopsRetries(t *testing.T) {
+	clk := newFakeClock(time.Unix(1_700_000_000, 0))
+	cfg := NewDefaultConfig()
+	cfg.TokensPerSecond = 100
+	cfg.Burst = 10
+	cfg.JoinTimeout = 2 * time.Second
+	cfg.BackoffMin = time.Second
+
+	ds := newDesiredStub("me", []string{"#gone", "#chess"}, clk.Now())
+	out := make(chan types.IRCCommand, 4)
+	board := newStatusBoard(clk)
+	r := &reconciler{
+		desired:     ds,
+		out:         out,
+		cfg:         cfg,
+		state:       make(map[string]*chanState),
+		tokenBucket: newBucket(cfg.TokensPerSecond, cfg.Burst, clk),
+		lg:          observe.C("rectifier_test"),
+		clk:         clk,
+		status:      board,
+	}
+	r.observeDesired()
+	r.reconcile(clk.Now())
+	<-out
+	<-out
+
+	// not terminal: left to the join timeout
+	r.observeEvent(types.MembershipEvent{Op: "NOTICE", Channel: "#chess", Reason: "msg_ratelimit"})
+	if st := board.Get("#chess"); st.Phase != "Joining" {
+		t.Fatalf("non-terminal notice changed phase: %+v", st)
+	}
+
+	r.observeEvent(types.MembershipEvent{Op: "NOTICE", Channel: "#gone", Reason: "msg_channel_suspended"})
+	st := board.Get("#gone")
+	if st.Phase != "Error" || !st.Terminal || st.Reason != "msg_channel_suspended" {
+		t.Fatalf("status after refusal = %+v", st)
+	}
+
+	// well past any backoff, and across a reconnect, only #chess is retried
+	clk.Advance(10 * time.Minute)
+	r.observeEvent(types.MembershipEvent{Op: "RESET"})
+	r.reconcile(clk.Now())
+	if cmd := <-out; cmd.Channel != "#chess" {
+		t.Fatalf("retried %+v", cmd)
+	}
+	if len(out) != 0 {
+		t.Fatalf("refused channel retried: %+v", <-out)
+	}
+
+	r.observeEvent(types.MembershipEvent{Op: "CLEAR", Channel: "#gone"})
+	if st := board.Get("#gone"); st.Phase != "Idle" || st.Terminal || st.Reason != "" {
+		t.Fatalf("status after clear = %+v", st)
+	}
+	r.reconcile(clk.Now())
+	if cmd := <-out; cmd.Op != "JOIN" || cmd.Channel != "#gone" {
+		t.Fatalf("expected JOIN #gone after clear, got %+v", cmd)
+	}
+}
+
+func TestRectifier_LateTerminalNotice(t *testing.T) {
+	clk := newFakeClock(time.Unix(1_700_000_000, 0))
+	cfg := NewDefaultConfig()
+	cfg.TokensPerSecond = 100
+	cfg.Burst = 10
+	cfg.JoinTimeout = 2 * time.Second
+	cfg.BackoffMin = time.Second
+
+	ds := newDesiredStub("me", []string{"#gone"}, clk.Now())
+	out := make(chan types.IRCCommand, 4)
+	board := newStatusBoard(clk)
+	r := &reconciler{
+		desired:     ds,
+		out:         out,
+		cfg:         cfg,
+		state:       make(map[string]*chanState),
+		tokenBucket: newBucket(cfg.TokensPerSecond, cfg.Burst, clk),
+		lg:          observe.C("rectifier_test"),
+		clk:         clk,
+		status:      board,
+	}
+	r.observeDesired()
+	r.reconcile(clk.Now())
+	<-out
+
+	// The join times out before Twitch's refusal arrives.
+	clk.Advance(3 * time.Second)
+	r.reconcile(clk.Now())
+	if st := board.Get("#gone"); st.Phase != "Error" || st.Terminal {
+		t.Fatalf("status after timeout = %+v", st)
+	}
+	r.observeEvent(types.MembershipEvent{Op: "NOTICE", Channel: "#gone", Reason: "msg_channel_suspended"})
+	if st := board.Get("#gone"); st.Phase != "Error" || !st.Terminal || st.Reason != "msg_channel_suspended" {
+		t.Fatalf("status after late refusal = %+v", st)
+	}
+
+	clk.Advance(10 * time.Minute)
+	r.reconcile(clk.Now())
+	if len(out) != 0 {
+		t.Fatalf("refused channel retried: %+v", <-out)
+	}
+}
@@ -0,0 +1,70 @@
+package channelrecord
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/types"
+)
+
+// ReloadPolicy decides what the Controller does when its store is changed
+// by someone else (a hand edit of channels.json, config management, or a
+// replica sharing a SQLite set).
+type ReloadPolicy string
+
+const (
+	// ReloadMerge adopts the external set, except for channels changed
+	// through the controller since its last save, which keep their local
+	// state. This is the default.
+	ReloadMerge ReloadPolicy = "merge"
+	// ReloadExternal adopts the external set as is, discarding unsaved
+	// local changes.
+	ReloadExternal ReloadPolicy = "external"
+	// ReloadLocal ignores the external change and rewrites the store from
+	// memory.
+	ReloadLocal ReloadPolicy = "local"
+	// ReloadOff disables watching; the next save overwrites external edits.
+	ReloadOff ReloadPolicy = "off"
+)
+
+func ParseReloadPolicy(s string) (ReloadPolicy, error) {
+	switch p := ReloadPolicy(s); p {
+	case "":
+		return ReloadMerge, nil
+	case ReloadMerge, ReloadExternal, ReloadLocal, ReloadOff:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown reload policy %q", s)
+	}
+}
+
+// SetReloadPolicy must be called before Run.
+func (c *Controller) SetReloadPolicy(p ReloadPolicy) {
+	c.reload = p
+}
+
+// validateStored checks an externally written set. Unlike startup, where
+// bad entries are skipped, any problem rejects the whole edit so a typo
+// cannot silently drop channels.
+func (c *Controller) validateStored(v types.Channels) (map[string]types.ChannelEntry, error) {
+	if v.Account != "" && v.Account != c.account {
+		return nil, fmt.Errorf("account %q != expected %q", v.Account, c.account)
+	}
+	if v.Schema > types.ChannelsSchema {
+		return nil, fmt.Errorf("schema %d is newer than supported %d", v.Schema, types.ChannelsSchema)
+	}
+	out := make(map[string]types.ChannelEntry, len(v.Channels))
+	for _, e := range v.Channels {
+		ch, err := ValidateChannel(e.Name)
+		if err != nil {
+			return nil, err
+		}
+		// already-expired entries are accepted and left to the expiry sweep
+		meta, err := normalizeMeta(e.ChannelMeta, time.Time{})
+		if err != nil {
+			return nil, fmt.Errorf("channel %s: %w", ch, err)
+		}
+		out[ch] = types.ChannelEntry{Name: ch, ChannelMeta: meta}
+	}
+	return out, nil
+}
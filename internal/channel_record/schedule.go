@@ -0,0 +1,244 @@
+package channelrecord
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/types"
+)
+
+// maxWindow bounds recurring windows so finding the latest cron match
+// never scans further back than a week.
+const maxWindow = 7 * 24 * time.Hour
+
+// ActiveAt reports whether e should be joined at t. Entries without a
+// schedule are always active.
+func ActiveAt(e types.ChannelEntry, t time.Time) bool {
+	s := e.Schedule
+	if s == nil {
+		return true
+	}
+	if s.Start != nil && t.Before(*s.Start) {
+		return false
+	}
+	if s.End != nil && !t.Before(*s.End) {
+		return false
+	}
+	if s.Cron == "" {
+		return true
+	}
+	w := s.Window
+	if w == nil { // not admitted through the controller
+		w = compileWindow(s)
+	}
+	return w.Open(t)
+}
+
+type window struct {
+	spec   *cronSpec
+	length time.Duration
+	loc    *time.Location
+}
+
+func (w window) Open(t time.Time) bool {
+	fire, ok := w.spec.prev(t.In(w.loc), w.length)
+	return ok && t.Before(fire.Add(w.length))
+}
+
+// closedWindow stands in for a schedule that fails to parse.
+type closedWindow struct{}
+
+func (closedWindow) Open(time.Time) bool { return false }
+
+func compileWindow(s *types.Schedule) types.ScheduleWindow {
+	w, err := parseWindow(s)
+	if err != nil {
+		return closedWindow{} // rejected at admission; treat a bad file entry as off
+	}
+	return w
+}
+
+// compileSchedule returns e with its cron window compiled.
+func compileSchedule(e types.ChannelEntry) types.ChannelEntry {
+	if e.Schedule == nil || e.Schedule.Cron == "" || e.Schedule.Window != nil {
+		return e
+	}
+	s := *e.Schedule
+	s.Window = compileWindow(&s)
+	e.Schedule = &s
+	return e
+}
+
+func parseWindow(s *types.Schedule) (window, error) {
+	spec, err := parseCron(s.Cron)
+	if err != nil {
+		return window{}, err
+	}
+	length, err := time.ParseDuration(s.Duration)
+	if err != nil || length <= 0 {
+		return window{}, fmt.Errorf("schedule duration %q must be a positive duration", s.Duration)
+	}
+	if length > maxWindow {
+		return window{}, fmt.Errorf("schedule duration %s exceeds %s", length, maxWindow)
+	}
+	loc := time.UTC
+	if s.TZ != "" {
+		if loc, err = time.LoadLocation(s.TZ); err != nil {
+			return window{}, fmt.Errorf("schedule tz %q: %w", s.TZ, err)
+		}
+	}
+	return window{spec: spec, length: length, loc: loc}, nil
+}
+
+// normalizeSchedule validates s and returns a copy with times in UTC.
+func normalizeSchedule(s types.Schedule) (*types.Schedule, error) {
+	out := types.Schedule{
+		Cron:     strings.Join(strings.Fields(s.Cron), " "),
+		Duration: strings.TrimSpace(s.Duration),
+		TZ:       strings.TrimSpace(s.TZ),
+	}
+	if s.Start != nil {
+		t := s.Start.UTC()
+		out.Start = &t
+	}
+	if s.End != nil {
+		t := s.End.UTC()
+		out.End = &t
+	}
+	if out.Start != nil && out.End != nil && !out.End.After(*out.Start) {
+		return nil, errors.New("schedule end must be after start")
+	}
+	switch {
+	case out.Cron != "":
+		w, err := parseWindow(&out)
+		if err != nil {
+			return nil, err
+		}
+		out.Window = w
+	case out.Duration != "" || out.TZ != "":
+		return nil, errors.New("schedule duration and tz need a cron expression")
+	case out.Start == nil && out.End == nil:
+		return nil, errors.New("schedule needs start, end or cron")
+	}
+	return &out, nil
+}
+
+// cronSpec is a parsed 5-field cron expression as bitsets.
+type cronSpec struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+func parseCron(expr string) (*cronSpec, error) {
+	f := strings.Fields(expr)
+	if len(f) != 5 {
+		return nil, fmt.Errorf("cron %q: want 5 fields (min hour dom month dow)", expr)
+	}
+	var c cronSpec
+	var err error
+	if c.minute, err = parseCronField(f[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("cron %q minute: %w", expr, err)
+	}
+	if c.hour, err = parseCronField(f[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("cron %q hour: %w", expr, err)
+	}
+	if c.dom, err = parseCronField(f[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("cron %q day of month: %w", expr, err)
+	}
+	if c.month, err = parseCronField(f[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("cron %q month: %w", expr, err)
+	}
+	if c.dow, err = parseCronField(f[4], 0, 7); err != nil {
+		return nil, fmt.Errorf("cron %q day of week: %w", expr, err)
+	}
+	if c.dow&(1<<7) != 0 { // 7 is Sunday too
+		c.dow |= 1
+	}
+	c.domAny = f[2] == "*"
+	c.dowAny = f[4] == "*"
+	return &c, nil
+}
+
+// parseCronField handles "*", "n", "a-b", "*/s", "a-b/s" and comma lists.
+func parseCronField(field string, lo, hi int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("bad step %q", part)
+			}
+			step = n
+		}
+		from, to := lo, hi
+		if rng != "*" {
+			a, b, isRange := strings.Cut(rng, "-")
+			var err error
+			if from, err = strconv.Atoi(a); err != nil {
+				return 0, fmt.Errorf("bad value %q", part)
+			}
+			to = from
+			if isRange {
+				if to, err = strconv.Atoi(b); err != nil {
+					return 0, fmt.Errorf("bad value %q", part)
+				}
+			} else if hasStep {
+				to = hi
+			}
+		}
+		if from < lo || to > hi || from > to {
+			return 0, fmt.Errorf("%q out of range %d-%d", part, lo, hi)
+		}
+		for v := from; v <= to; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (c *cronSpec) dayMatches(t time.Time) bool {
+	if c.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	domOK := c.dom&(1<<uint(t.Day())) != 0
+	dowOK := c.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dowOK
+	case c.dowAny:
+		return domOK
+	default:
+		return domOK || dowOK // classic cron: either restriction matches
+	}
+}
+
+// prev returns the latest match at or before t, looking back at most
+// lookback. It skips whole days and hours that cannot match.
+func (c *cronSpec) prev(t time.Time, lookback time.Duration) (time.Time, bool) {
+	floor := t.Add(-lookback)
+	cur := t.Truncate(time.Minute)
+	for !cur.Before(floor) {
+		if !c.dayMatches(cur) {
+			y, m, d := cur.Date()
+			cur = time.Date(y, m, d, 0, 0, 0, 0, cur.Location()).Add(-time.Minute)
+			continue
+		}
+		if c.hour&(1<<uint(cur.Hour())) == 0 {
+			cur = cur.Add(-time.Duration(cur.Minute()+1) * time.Minute)
+			continue
+		}
+		if c.minute&(1<<uint(cur.Minute())) == 0 {
+			cur = cur.Add(-time.Minute)
+			continue
+		}
+		return cur, true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,103 @@
+package channelrecord
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/types"
+)
+
+func TestActiveAt_OneShotWindow(t *testing.T) {
+	start := time.Date(2025, 6, 1, 18, 0, 0, 0, time.UTC)
+	end := start.Add(3 * time.Hour)
+	e := types.ChannelEntry{Name: "#esl_csgo", ChannelMeta: types.ChannelMeta{
+		Schedule: &types.Schedule{Start: &start, End: &end},
+	}}
+
+	for at, want := range map[time.Time]bool{
+		start.Add(-time.Second): false,
+		start:                   true,
+		end.Add(-time.Second):   true,
+		end:                     false,
+	} {
+		if got := ActiveAt(e, at); got != want {
+			t.Fatalf("ActiveAt(%s) = %v, want %v", at, got, want)
+		}
+	}
+}
+
+func TestActiveAt_RecurringWindow(t *testing.T) {
+	// Weeknights 20:00–22:00 New York time.
+	sched, err := normalizeSchedule(types.Schedule{Cron: "0 20 * * 1-5", Duration: "2h", TZ: "America/New_York"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := types.ChannelEntry{Name: "#chess", ChannelMeta: types.ChannelMeta{Schedule: sched}}
+
+	ny, _ := time.LoadLocation("America/New_York")
+	cases := map[time.Time]bool{
+		time.Date(2025, 6, 2, 19, 59, 0, 0, ny): false, // Monday, just before
+		time.Date(2025, 6, 2, 20, 0, 0, 0, ny):  true,
+		time.Date(2025, 6, 2, 21, 59, 0, 0, ny): true,
+		time.Date(2025, 6, 2, 22, 0, 0, 0, ny):  false,
+		time.Date(2025, 6, 7, 21, 0, 0, 0, ny):  false, // Saturday
+	}
+	for at, want := range cases {
+		if got := ActiveAt(e, at.UTC()); got != want {
+			t.Fatalf("ActiveAt(%s) = %v, want %v", at, got, want)
+		}
+	}
+}
+
+func TestCompileSchedule(t *testing.T) {
+	// as loaded from a store: no compiled window yet
+	raw := &types.Schedule{Cron: "0 20 * * *", Duration: "2h", TZ: "America/New_York"}
+	e := compileSchedule(types.ChannelEntry{Name: "#chess", ChannelMeta: types.ChannelMeta{Schedule: raw}})
+	if e.Schedule.Window == nil || raw.Window != nil {
+		t.Fatalf("compiled = %v, stored = %v; want a window on a copy only", e.Schedule.Window, raw.Window)
+	}
+	ny, _ := time.LoadLocation("America/New_York")
+	at := time.Date(2025, 6, 2, 21, 0, 0, 0, ny)
+	if !ActiveAt(e, at) || ActiveAt(e, at.Add(2*time.Hour)) {
+		t.Fatal("compiled window disagrees with the schedule")
+	}
+	if b, _ := json.Marshal(e); strings.Contains(string(b), "Window") {
+		t.Fatalf("window leaked into JSON: %s", b)
+	}
+
+	bad := compileSchedule(types.ChannelEntry{Name: "#x", ChannelMeta: types.ChannelMeta{
+		Schedule: &types.Schedule{Cron: "0 20 * * *", Duration: "2h", TZ: "Mars/Olympus"},
+	}})
+	if ActiveAt(bad, at) {
+		t.Fatal("unparseable schedule treated as open")
+	}
+}
+
+func TestNormalizeSchedule_Rejects(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+	bad := []types.Schedule{
+		{},
+		{Start: &start, End: &start},
+		{Cron: "0 20 * *", Duration: "1h"},
+		{Cron: "61 * * * *", Duration: "1h"},
+		{Cron: "0 20 * * *"},
+		{Cron: "0 20 * * *", Duration: "200h"},
+		{Cron: "0 20 * * *", Duration: "1h", TZ: "Mars/Olympus"},
+		{Duration: "1h"},
+	}
+	for _, s := range bad {
+		if _, err := normalizeSchedule(s); err == nil {
+			t.Fatalf("normalizeSchedule(%+v) accepted an invalid schedule", s)
+		}
+	}
+}
+
+func TestWindowChanges(t *testing.T) {
+	got := windowChanges([]string{"#aaaa", "#cccc"}, []string{"#bbbb", "#cccc"})
+	want := []change{{"deactivate", "#aaaa"}, {"activate", "#bbbb"}}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("windowChanges = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,255 @@
+package channelrecord
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
+
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/types"
+)
+
+// SQLiteStore keeps desired sets in a SQLite database. Each set is keyed by
+// name, so replicas pointing at the same database either share a set (same
+// name) or partition the database between them (distinct names).
+type SQLiteStore struct {
+	db   *sql.DB
+	path string
+	set  string
+	seen string // updated_at after our last Load or Save
+}
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS channel_sets (
+	set_name   TEXT PRIMARY KEY,
+	schema     INTEGER NOT NULL,
+	account    TEXT NOT NULL,
+	updated_at TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS channels (
+	set_name TEXT NOT NULL REFERENCES channel_sets(set_name) ON DELETE CASCADE,
+	name     TEXT NOT NULL,
+	meta     TEXT NOT NULL,
+	PRIMARY KEY (set_name, name)
+);
+CREATE TABLE IF NOT EXISTS audit (
+	id       INTEGER PRIMARY KEY AUTOINCREMENT,
+	set_name TEXT NOT NULL,
+	channel  TEXT NOT NULL,
+	entry    TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS audit_by_channel ON audit (set_name, channel, id);
+`
+
+// OpenSQLiteStore opens (creating if needed) the database at path and
+// selects the named set.
+func OpenSQLiteStore(path, set string) (*SQLiteStore, error) {
+	if path == "" {
+		return nil, errors.New("channelrecord: empty sqlite path")
+	}
+	if set == "" {
+		return nil, errors.New("channelrecord: empty sqlite set name")
+	}
+	q := url.Values{}
+	q.Add("_pragma", "busy_timeout(5000)")
+	q.Add("_pragma", "journal_mode(WAL)")
+	q.Add("_pragma", "foreign_keys(1)")
+	db, err := sql.Open("sqlite", "file:"+path+"?"+q.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("channelrecord: open sqlite %q: %w", path, err)
+	}
+	// A single connection serializes this process's writers; other
+	// processes are handled by busy_timeout.
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("channelrecord: init sqlite schema %q: %w", path, err)
+	}
+	return &SQLiteStore{db: db, path: path, set: set}, nil
+}
+
+func (s *SQLiteStore) Load() (types.Channels, error) {
+	var v types.Channels
+	var updated string
+	err := s.db.QueryRow(
+		`SELECT schema, account, updated_at FROM channel_sets WHERE set_name = ?`, s.set,
+	).Scan(&v.Schema, &v.Account, &updated)
+	if errors.Is(err, sql.ErrNoRows) {
+		return v, fmt.Errorf("set %q: %w", s.set, os.ErrNotExist)
+	}
+	if err != nil {
+		return v, fmt.Errorf("read set %q: %w", s.set, err)
+	}
+	s.seen = updated
+	if v.UpdatedAt, err = time.Parse(time.RFC3339Nano, updated); err != nil {
+		return v, fmt.Errorf("set %q: bad updated_at %q: %w", s.set, updated, err)
+	}
+
+	rows, err := s.db.Query(`SELECT name, meta FROM channels WHERE set_name = ? ORDER BY name`, s.set)
+	if err != nil {
+		return v, fmt.Errorf("read channels of %q: %w", s.set, err)
+	}
+	defer func() { _ = rows.Close() }()
+	for rows.Next() {
+		var e types.ChannelEntry
+		var meta string
+		if err := rows.Scan(&e.Name, &meta); err != nil {
+			return v, fmt.Errorf("scan channel: %w", err)
+		}
+		if err := json.Unmarshal([]byte(meta), &e.ChannelMeta); err != nil {
+			return v, fmt.Errorf("channel %s: decode meta: %w", e.Name, err)
+		}
+		v.Channels = append(v.Channels, e)
+	}
+	if err := rows.Err(); err != nil {
+		return v, fmt.Errorf("read channels of %q: %w", s.set, err)
+	}
+	return v, nil
+}
+
+func (s *SQLiteStore) Save(v types.Channels) error {
+	updated := v.UpdatedAt.UTC().Format(time.RFC3339Nano)
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// Only replace the version we last saw; a replica sharing the set may
+	// have saved since.
+	res, err := tx.Exec(`
+		UPDATE channel_sets SET schema = ?, account = ?, updated_at = ?
+		WHERE set_name = ? AND updated_at = ?`,
+		v.Schema, v.Account, updated, s.set, s.seen,
+	)
+	if err != nil {
+		return fmt.Errorf("update set %q: %w", s.set, err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return fmt.Errorf("update set %q: %w", s.set, err)
+	} else if n == 0 {
+		res, err := tx.Exec(`
+			INSERT INTO channel_sets (set_name, schema, account, updated_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT (set_name) DO NOTHING`,
+			s.set, v.Schema, v.Account, updated,
+		)
+		if err != nil {
+			return fmt.Errorf("insert set %q: %w", s.set, err)
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return fmt.Errorf("insert set %q: %w", s.set, err)
+		} else if n == 0 {
+			return fmt.Errorf("set %q: %w", s.set, ErrStoreConflict)
+		}
+	}
+	if _, err := tx.Exec(`DELETE FROM channels WHERE set_name = ?`, s.set); err != nil {
+		return fmt.Errorf("clear channels of %q: %w", s.set, err)
+	}
+	stmt, err := tx.Prepare(`INSERT INTO channels (set_name, name, meta) VALUES (?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("prepare insert: %w", err)
+	}
+	defer func() { _ = stmt.Close() }()
+	for _, e := range v.Channels {
+		meta, err := json.Marshal(e.ChannelMeta)
+		if err != nil {
+			return fmt.Errorf("channel %s: encode meta: %w", e.Name, err)
+		}
+		if _, err := stmt.Exec(s.set, e.Name, string(meta)); err != nil {
+			return fmt.Errorf("insert channel %s: %w", e.Name, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	s.seen = updated
+	return nil
+}
+
+// ChangedExternally reports whether another writer (for example a replica
+// sharing the set) saved it since our last Load or Save.
+func (s *SQLiteStore) ChangedExternally() (bool, error) {
+	var updated string
+	err := s.db.QueryRow(`SELECT updated_at FROM channel_sets WHERE set_name = ?`, s.set).Scan(&updated)
+	if errors.Is(err, sql.ErrNoRows) {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("read set %q: %w", s.set, err)
+	}
+	return updated != s.seen, nil
+}
+
+func (s *SQLiteStore) AppendAudit(entries []types.AuditEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	for i := range entries {
+		b, err := json.Marshal(&entries[i])
+		if err != nil {
+			return fmt.Errorf("encode audit entry: %w", err)
+		}
+		if _, err := tx.Exec(`INSERT INTO audit (set_name, channel, entry) VALUES (?, ?, ?)`,
+			s.set, entries[i].Channel, string(b)); err != nil {
+			return fmt.Errorf("insert audit entry: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) ReadAudit(channel string, limit int) ([]types.AuditEntry, error) {
+	query := `SELECT entry FROM audit WHERE set_name = ?`
+	args := []any{s.set}
+	if channel != "" {
+		query += ` AND channel = ?`
+		args = append(args, channel)
+	}
+	query += ` ORDER BY id DESC`
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("read audit: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var out []types.AuditEntry
+	for rows.Next() {
+		var raw string
+		if err := rows.Scan(&raw); err != nil {
+			return nil, fmt.Errorf("scan audit: %w", err)
+		}
+		var e types.AuditEntry
+		if err := json.Unmarshal([]byte(raw), &e); err != nil {
+			return nil, fmt.Errorf("decode audit entry: %w", err)
+		}
+		out = append(out, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("read audit: %w", err)
+	}
+	// newest first from the query; callers want oldest first
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out, nil
+}
+
+func (s *SQLiteStore) Close() error { return s.db.Close() }
+
+func (s *SQLiteStore) String() string { return "sqlite:" + s.path + "#" + s.set }
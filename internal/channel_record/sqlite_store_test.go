@@ -0,0 +1,174 @@
+package channelrecord
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/types"
+)
+
+func TestSQLiteStore_ControllerRoundTrip(t *testing.T) {
+	db := filepath.Join(t.TempDir(), "channels.db")
+	store, err := OpenSQLiteStore(db, "me")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = store.Close() }()
+
+	controlCh := make(chan types.IRCCommand)
+	c, err := NewControllerWithStore(store, "me", controlCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = c.Run(ctx) }()
+
+	send := func(cmd types.IRCCommand) {
+		res := make(chan types.CommandResult, 1)
+		cmd.Result = res
+		cmd.ExpectedVersion, _, _, _ = c.Snapshot()
+		controlCh <- cmd
+		if out := <-res; out.Err != nil || out.Conflict {
+			t.Fatalf("command %+v failed: %+v", cmd, out)
+		}
+	}
+	send(types.IRCCommand{Op: "JOIN", Channel: "#chess", Meta: &types.ChannelMeta{Tags: []string{"games"}, Priority: 3}})
+	send(types.IRCCommand{Op: "JOIN", Channel: "#speedrun"})
+	send(types.IRCCommand{Op: "PART", Channel: "#speedrun"})
+
+	hist, err := c.History("", 0)
+	if err != nil || len(hist) != 3 || hist[0].Op != "add" || hist[2].Op != "remove" {
+		t.Fatalf("history = %+v, %v", hist, err)
+	}
+	if hist, _ := c.History("#chess", 1); len(hist) != 1 || hist[0].Channel != "#chess" {
+		t.Fatalf("chess history = %+v", hist)
+	}
+
+	// A second set in the same database is independent.
+	other, err := OpenSQLiteStore(db, "someone_else")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = other.Close() }()
+	if _, err := NewControllerWithStore(other, "someone_else", make(chan types.IRCCommand)); err != nil {
+		t.Fatal(err)
+	}
+
+	// A fresh controller over the same set sees what the first one saved.
+	reopened, err := NewControllerWithStore(store, "me", make(chan types.IRCCommand))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, entries, _, _ := reopened.Entries()
+	if len(entries) != 1 || entries[0].Name != "#chess" || entries[0].Priority != 3 || !entries[0].HasTag("games") {
+		t.Fatalf("reloaded entries = %+v", entries)
+	}
+
+	if _, err := NewControllerWithStore(store, "impostor", make(chan types.IRCCommand)); err == nil {
+		t.Fatal("expected account mismatch error")
+	}
+}
+
+func TestSQLiteStore_SaveRefusesStaleWrite(t *testing.T) {
+	db := filepath.Join(t.TempDir(), "channels.db")
+	a, err := OpenSQLiteStore(db, "me")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = a.Close() }()
+	b, err := OpenSQLiteStore(db, "me")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = b.Close() }()
+
+	set := func(names ...string) types.Channels {
+		v := types.Channels{Schema: types.ChannelsSchema, Account: "me", UpdatedAt: time.Now()}
+		for _, n := range names {
+			v.Channels = append(v.Channels, types.ChannelEntry{Name: n})
+		}
+		return v
+	}
+	if err := a.Save(set("#chess")); err != nil {
+		t.Fatal(err)
+	}
+	// b never saw a's write, so it may neither create nor replace the set.
+	if err := b.Save(set("#speedrun")); !errors.Is(err, ErrStoreConflict) {
+		t.Fatalf("stale save = %v, want ErrStoreConflict", err)
+	}
+	if _, err := b.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Save(set("#chess", "#speedrun")); err != nil {
+		t.Fatalf("save after reload = %v", err)
+	}
+	if err := a.Save(set()); !errors.Is(err, ErrStoreConflict) {
+		t.Fatalf("stale save = %v, want ErrStoreConflict", err)
+	}
+	if v, err := a.Load(); err != nil || len(v.Channels) != 2 {
+		t.Fatalf("stored set = %+v, %v", v, err)
+	}
+}
+
+// blindStore hides external changes from the first few checks, so the
+// controller only learns of them when its save is refused.
+type blindStore struct {
+	*SQLiteStore
+	blind int
+}
+
+func (s *blindStore) ChangedExternally() (bool, error) {
+	if s.blind > 0 {
+		s.blind--
+		return false, nil
+	}
+	return s.SQLiteStore.ChangedExternally()
+}
+
+func TestSQLiteStore_ControllerMergesOnConflict(t *testing.T) {
+	db := filepath.Join(t.TempDir(), "channels.db")
+	store, err := OpenSQLiteStore(db, "me")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = store.Close() }()
+	controlCh := make(chan types.IRCCommand)
+	c, err := NewControllerWithStore(&blindStore{SQLiteStore: store, blind: 1}, "me", controlCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A replica sharing the set adds #replica.
+	replica, err := OpenSQLiteStore(db, "me")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = replica.Close() }()
+	v, err := replica.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.Channels = append(v.Channels, types.ChannelEntry{Name: "#replica"})
+	v.UpdatedAt = time.Now()
+	if err := replica.Save(v); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = c.Run(ctx) }()
+	res := make(chan types.CommandResult, 1)
+	controlCh <- types.IRCCommand{Op: "JOIN", Channel: "#local", ExpectedVersion: 1, Result: res}
+	if out := <-res; out.Err != nil || out.Conflict || out.Version != 2 {
+		t.Fatalf("join = %+v", out)
+	}
+
+	got, err := replica.Load()
+	if err != nil || len(got.Channels) != 2 || got.Channels[0].Name != "#local" || got.Channels[1].Name != "#replica" {
+		t.Fatalf("stored set = %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,106 @@
+package channelrecord
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/types"
+)
+
+// StatusBoard publishes the rectifier's per-channel phase so other
+// goroutines (the HTTP API) can read it or wait for a transition.
+type StatusBoard struct {
+	mu      sync.Mutex
+	clk     Clock
+	seq     uint64
+	byChan  map[string]types.ChannelStatus
+	changed chan struct{} // closed and replaced on every update
+}
+
+func NewStatusBoard() *StatusBoard {
+	return newStatusBoard(realClock{})
+}
+
+func newStatusBoard(clk Clock) *StatusBoard {
+	return &StatusBoard{
+		clk:     clk,
+		byChan:  make(map[string]types.ChannelStatus),
+		changed: make(chan struct{}),
+	}
+}
+
+func (b *StatusBoard) set(channel string, p phase, reason string, terminal bool) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if cur, ok := b.byChan[channel]; ok && cur.Phase == p.String() && cur.Reason == reason && cur.Terminal == terminal {
+		return
+	}
+	b.seq++
+	b.byChan[channel] = types.ChannelStatus{
+		Channel:   channel,
+		Phase:     p.String(),
+		Reason:    reason,
+		Terminal:  terminal,
+		UpdatedAt: b.clk.Now().UTC(),
+		Seq:       b.seq,
+	}
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// Seq returns the sequence number of the most recent change.
+func (b *StatusBoard) Seq() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.seq
+}
+
+// Get returns the status for channel; unknown channels report Idle.
+func (b *StatusBoard) Get(channel string) types.ChannelStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.get(channel)
+}
+
+func (b *StatusBoard) get(channel string) types.ChannelStatus {
+	if st, ok := b.byChan[channel]; ok {
+		return st
+	}
+	return types.ChannelStatus{Channel: channel, Phase: Idle.String()}
+}
+
+// List returns every known channel status sorted by channel.
+func (b *StatusBoard) List() []types.ChannelStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	out := make([]types.ChannelStatus, 0, len(b.byChan))
+	for _, st := range b.byChan {
+		out = append(out, st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Channel < out[j].Channel })
+	return out
+}
+
+// Await blocks until done reports true for channel's status or ctx ends,
+// returning the last status seen either way.
+func (b *StatusBoard) Await(ctx context.Context, channel string, done func(types.ChannelStatus) bool) (types.ChannelStatus, error) {
+	for {
+		b.mu.Lock()
+		st := b.get(channel)
+		changed := b.changed
+		b.mu.Unlock()
+
+		if done(st) {
+			return st, nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return st, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package channelrecord
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/types"
+)
+
+func TestStatusBoard_AwaitSeesTransition(t *testing.T) {
+	clk := newFakeClock(time.Unix(1_700_000_000, 0))
+	b := newStatusBoard(clk)
+
+	b.set("#chess", Error, "timeout", false)
+	since := b.Seq()
+
+	done := make(chan types.ChannelStatus, 1)
+	go func() {
+		st, _ := b.Await(context.Background(), "#chess", func(st types.ChannelStatus) bool {
+			return st.Phase == "Joined" || (st.Phase == "Error" && st.Seq > since)
+		})
+		done <- st
+	}()
+
+	select {
+	case st := <-done:
+		t.Fatalf("stale Error should not satisfy the wait, got %+v", st)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	b.set("#chess", Joining, "", false)
+	b.set("#chess", Joined, "", false)
+
+	select {
+	case st := <-done:
+		if st.Phase != "Joined" {
+			t.Fatalf("phase = %s, want Joined", st.Phase)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Await did not return after Joined")
+	}
+}
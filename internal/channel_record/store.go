@@ -0,0 +1,162 @@
+package channelrecord
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/types"
+)
+
+// Store persists the desired channel set and its audit history. The
+// Controller is the only writer for its account; Save replaces the whole
+// stored set.
+type Store interface {
+	// Load returns the stored set, or an error wrapping os.ErrNotExist
+	// when nothing has been saved yet.
+	Load() (types.Channels, error)
+	// Save may fail with ErrStoreConflict when the store can tell that
+	// someone else saved since our last Load or Save.
+	Save(v types.Channels) error
+
+	AppendAudit(entries []types.AuditEntry) error
+	// ReadAudit returns the newest limit entries (oldest first) matching
+	// channel, or every channel when channel is empty.
+	ReadAudit(channel string, limit int) ([]types.AuditEntry, error)
+
+	Close() error
+	String() string // for logs
+}
+
+// ErrStoreConflict is returned by Save when the stored set was changed by
+// another writer; the caller should Load and merge before saving again.
+var ErrStoreConflict = errors.New("channelrecord: stored set changed by another writer")
+
+// ExternalChangeDetector is implemented by stores that can tell when the
+// stored set was modified by someone other than this process since the last
+// Load or Save. The Controller polls it from its own goroutine.
+type ExternalChangeDetector interface {
+	ChangedExternally() (bool, error)
+}
+
+// FileStore keeps the set in a JSON file (channels.json) with a JSONL audit
+// log beside it.
+type FileStore struct {
+	path  string
+	audit *auditLog
+
+	// what the file looked like after our last Load or Save
+	seenMod  time.Time
+	seenSize int64
+	seenSum  [sha256.Size]byte
+}
+
+func NewFileStore(path string) (*FileStore, error) {
+	if path == "" {
+		return nil, errors.New("channelrecord: empty path")
+	}
+	return &FileStore{path: path, audit: &auditLog{path: auditPathFor(path)}}, nil
+}
+
+func (s *FileStore) Load() (types.Channels, error) {
+	b, err := os.ReadFile(s.path)
+	if err != nil {
+		return types.Channels{}, err
+	}
+	s.remember(b)
+	return decodeChannels(s.path, b)
+}
+
+func (s *FileStore) Save(v types.Channels) error {
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("mkdir %s: %w", dir, err)
+	}
+	tmp := s.path + ".tmp"
+
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("open tmp: %w", err)
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(&v); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("encode json: %w", err)
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("write tmp: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return fmt.Errorf("fsync tmp: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close tmp: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("rename tmp→final: %w", err)
+	}
+	s.remember(buf.Bytes())
+	return nil
+}
+
+// ChangedExternally reports whether the file differs from what this store
+// last read or wrote. A missing file counts as changed.
+func (s *FileStore) ChangedExternally() (bool, error) {
+	fi, err := os.Stat(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if fi.ModTime().Equal(s.seenMod) && fi.Size() == s.seenSize {
+		return false, nil
+	}
+	b, err := os.ReadFile(s.path)
+	if err != nil {
+		return false, err
+	}
+	if sha256.Sum256(b) == s.seenSum {
+		// touched but not edited
+		s.seenMod, s.seenSize = fi.ModTime(), fi.Size()
+		return false, nil
+	}
+	return true, nil
+}
+
+func (s *FileStore) remember(b []byte) {
+	s.seenSum = sha256.Sum256(b)
+	s.seenSize = int64(len(b))
+	if fi, err := os.Stat(s.path); err == nil {
+		s.seenMod = fi.ModTime()
+	}
+}
+
+func (s *FileStore) AppendAudit(entries []types.AuditEntry) error {
+	return s.audit.append(entries)
+}
+
+func (s *FileStore) ReadAudit(channel string, limit int) ([]types.AuditEntry, error) {
+	return s.audit.read(channel, limit)
+}
+
+func (s *FileStore) Close() error { return nil }
+
+func (s *FileStore) String() string { return "file:" + s.path }
+
+func decodeChannels(path string, b []byte) (types.Channels, error) {
+	var v types.Channels
+	if err := json.Unmarshal(b, &v); err != nil {
+		return v, fmt.Errorf("decode %s: %w", path, err)
+	}
+	return v, nil
+}
@@ -0,0 +1,137 @@
+// Package chattext turns the raw trailing of a Twitch PRIVMSG into text
+// fit for downstream consumers: CTCP ACTION unwrapped, control bytes
+// removed, NFC-normalized, and optionally with emotes masked out.
+package chattext
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// EmoteMask replaces each emote in Text.Masked.
+const EmoteMask = "<emote>"
+
+// Options control Clean.
+type Options struct {
+	// StripBypass removes the invisible characters that chat clients
+	// append to get around Twitch's duplicate-message filter.
+	StripBypass bool
+}
+
+// Text is a cleaned message.
+type Text struct {
+	Text     string
+	Masked   string // Text with every emote from the emotes tag replaced by EmoteMask
+	IsAction bool   // sent with /me
+}
+
+// Clean processes raw, the PRIVMSG trailing, using emotes, the message's
+// emotes tag ("25:0-4,12-16/1902:6-10"), whose ranges are inclusive rune
+// offsets into the message after any ACTION wrapper is removed.
+func Clean(raw, emotes string, opt Options) Text {
+	var t Text
+	body := raw
+	if s, ok := unwrapAction(raw); ok {
+		body = s
+		t.IsAction = true
+	}
+	t.Text = normalize(body, opt)
+	t.Masked = normalize(mask(body, emotes), opt)
+	return t
+}
+
+// unwrapAction strips "\x01ACTION ...\x01". Some clients omit the closing
+// \x01.
+func unwrapAction(s string) (string, bool) {
+	const prefix = "\x01ACTION"
+	if !strings.HasPrefix(s, prefix) {
+		return s, false
+	}
+	s = strings.TrimPrefix(s[len(prefix):], " ")
+	return strings.TrimSuffix(s, "\x01"), true
+}
+
+func normalize(s string, opt Options) string {
+	s = strings.Map(func(r rune) rune {
+		switch {
+		case r == '\t' || r == '\r' || r == '\n':
+			return ' ' // a line break in a single message is spacing
+		case unicode.IsControl(r):
+			return -1
+		case opt.StripBypass && isBypass(r):
+			return -1
+		}
+		return r
+	}, s)
+	s = norm.NFC.String(s)
+	if opt.StripBypass {
+		// the bypass character is usually sent after a space
+		s = strings.TrimRight(s, " ")
+	}
+	return s
+}
+
+// isBypass reports characters that render as nothing and are used only to
+// make a repeated message look different.
+func isBypass(r rune) bool {
+	switch r {
+	case '\U000E0000', // TAG SPACE, used by 7TV and Chatterino
+		'\u034f',                     // COMBINING GRAPHEME JOINER, used by BTTV
+		'\u200b', '\u200c', '\u200d', // zero-width space and (non-)joiners
+		'\u2060', '\ufeff': // word joiner, BOM
+		return true
+	}
+	return false
+}
+
+type span struct{ start, end int } // inclusive rune offsets
+
+// mask replaces the emote ranges of s with EmoteMask. Malformed or out of
+// range positions are ignored rather than guessed at.
+func mask(s, emotes string) string {
+	if emotes == "" {
+		return s
+	}
+	var spans []span
+	for _, emote := range strings.Split(emotes, "/") {
+		_, ranges, ok := strings.Cut(emote, ":")
+		if !ok {
+			continue
+		}
+		for _, r := range strings.Split(ranges, ",") {
+			a, b, ok := strings.Cut(r, "-")
+			if !ok {
+				continue
+			}
+			start, err1 := strconv.Atoi(a)
+			end, err2 := strconv.Atoi(b)
+			if err1 != nil || err2 != nil || start < 0 || end < start {
+				continue
+			}
+			spans = append(spans, span{start, end})
+		}
+	}
+	if len(spans) == 0 {
+		return s
+	}
+	sort.Slice(spans, func(i, j int) bool { return spans[i].start < spans[j].start })
+
+	runes := []rune(s)
+	var b strings.Builder
+	b.Grow(len(s))
+	next := 0
+	for _, sp := range spans {
+		if sp.start < next || sp.end >= len(runes) {
+			continue // overlapping or beyond the text
+		}
+		b.WriteString(string(runes[next:sp.start]))
+		b.WriteString(EmoteMask)
+		next = sp.end + 1
+	}
+	b.WriteString(string(runes[next:]))
+	return b.String()
+}
@@ -0,0 +1,70 @@
+package chattext
+
+import "testing"
+
+func TestClean(t *testing.T) {
+	cases := []struct {
+		name   string
+		raw    string
+		emotes string
+		opt    Options
+		want   Text
+	}{
+		{
+			name: "plain",
+			raw:  "hello chat",
+			want: Text{Text: "hello chat", Masked: "hello chat"},
+		},
+		{
+			name:   "action",
+			raw:    "\x01ACTION waves Kappa\x01",
+			emotes: "25:6-10",
+			want:   Text{Text: "waves Kappa", Masked: "waves <emote>", IsAction: true},
+		},
+		{
+			name: "action without closing byte",
+			raw:  "\x01ACTION dances",
+			want: Text{Text: "dances", Masked: "dances", IsAction: true},
+		},
+		{
+			name: "control bytes",
+			raw:  "bold\x02 text\x1f\ttab",
+			want: Text{Text: "bold text tab", Masked: "bold text tab"},
+		},
+		{
+			name: "nfc",
+			raw:  "cafe\u0301",
+			want: Text{Text: "caf\u00e9", Masked: "caf\u00e9"},
+		},
+		{
+			name: "bypass kept by default",
+			raw:  "same again \U000E0000",
+			want: Text{Text: "same again \U000E0000", Masked: "same again \U000E0000"},
+		},
+		{
+			name: "bypass stripped",
+			raw:  "same again \U000E0000",
+			opt:  Options{StripBypass: true},
+			want: Text{Text: "same again", Masked: "same again"},
+		},
+		{
+			name:   "emotes by rune offset",
+			raw:    "héé Kappa PogChamp Kappa",
+			emotes: "25:4-8,19-23/88:10-17",
+			want:   Text{Text: "héé Kappa PogChamp Kappa", Masked: "héé <emote> <emote> <emote>"},
+		},
+		{
+			name:   "bad emote ranges ignored",
+			raw:    "Kappa",
+			emotes: "25:0-4,3-9/x:y/1:9-20",
+			want:   Text{Text: "Kappa", Masked: "<emote>"},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Clean(tc.raw, tc.emotes, tc.opt); got != tc.want {
+				t.Fatalf("Clean(%q, %q) = %#v, want %#v", tc.raw, tc.emotes, got, tc.want)
+			}
+		})
+	}
+}
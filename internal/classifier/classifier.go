@@ -0,0 +1,398 @@
+// Package classifier turns raw IRC lines into pipeline events and the
+// control-plane signals the collector's other stages act on.
+package classifier
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/chattext"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/deadletter"
+	ircevents "github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/irc_events"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/ircmsg"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/observe"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/types"
+)
+
+// Config says where ClassifyLine sends what it finds. Only Events is
+// required; sinks left nil are skipped.
+type Config struct {
+	Events     chan<- ircevents.Event       // data events for Kafka
+	Membership chan<- types.MembershipEvent // our JOIN/PART and NOTICE refusals, for the rectifier
+	Raids      chan<- types.RaidEvent       // raids and hosts, for auto-discovery
+	Roles      chan<- types.UserState       // our role per channel, for the outbound limiter
+	Chat       chan<- types.ChatSignal      // chat confirmations and room state, for the scheduler
+
+	Self string // our login, lower case
+	Text chattext.Options
+	Dead *deadletter.Box // lines that cannot be handled
+}
+
+// ClassifyLine parses each line from readerCh and hands it to the handler
+// for its command, which reports to the sinks in cfg.
+func ClassifyLine(ctx context.Context, readerCh <-chan string, cfg Config) {
+	c := &classifier{
+		parseCh:      cfg.Events,
+		membershipCh: cfg.Membership,
+		raidCh:       cfg.Raids,
+		roleCh:       cfg.Roles,
+		chatCh:       cfg.Chat,
+		self:         cfg.Self,
+		text:         cfg.Text,
+		states:       make(map[string]string),
+		dead:         cfg.Dead,
+		lg:           observe.C("classifier"),
+	}
+	var m ircmsg.Message // reused; handlers must not keep it
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case line, ok := <-readerCh:
+			if !ok { // channel closed
+				c.lg.Info("reader channel closed")
+				return
+			}
+			c.line = line
+			if err := ircmsg.ParseInto(&m, line); err != nil {
+				c.drop(err.Error())
+				continue
+			}
+			c.lg.Debug("parsed line", "command", m.Command, "params_len", len(m.Params))
+
+			switch m.Command {
+			case "PRIVMSG":
+				c.privmsg(ctx, &m)
+			case "JOIN", "PART":
+				c.membership(ctx, &m)
+			case "USERNOTICE":
+				c.usernotice(ctx, &m)
+			case "HOSTTARGET":
+				c.hosttarget(ctx, &m)
+			case "USERSTATE":
+				c.userstate(ctx, &m)
+			case "GLOBALUSERSTATE":
+				c.globaluserstate(ctx, &m)
+			case "WHISPER":
+				c.whisper(ctx, &m)
+			case "ROOMSTATE":
+				c.roomstate(ctx, &m)
+			case "NOTICE":
+				c.notice(ctx, &m)
+			default:
+				// numerics, CAP, CLEARCHAT, etc
+			}
+		}
+	}
+}
+
+type classifier struct {
+	parseCh      chan<- ircevents.Event
+	membershipCh chan<- types.MembershipEvent
+	raidCh       chan<- types.RaidEvent
+	roleCh       chan<- types.UserState
+	chatCh       chan<- types.ChatSignal
+	self         string
+	text         chattext.Options
+	states       map[string]string // channel -> last USERSTATE emitted, see userstate
+	dead         *deadletter.Box
+	line         string // the raw line being handled
+	lg           *slog.Logger
+}
+
+// drop discards the current line, keeping a sample in the dead-letter sink.
+func (c *classifier) drop(reason string) {
+	c.lg.Debug("skip malformed", "reason", reason)
+	c.dead.Drop("classifier", reason, c.line)
+}
+
+func (c *classifier) emit(ctx context.Context, evt ircevents.Event) {
+	select {
+	case c.parseCh <- evt:
+	case <-ctx.Done():
+	}
+}
+
+func (c *classifier) privmsg(ctx context.Context, m *ircmsg.Message) {
+	if len(m.Params) < 2 || m.Trailing() == "" {
+		c.drop("malformed PRIVMSG")
+		return
+	}
+
+	// From tags (authoritative when present)
+	userID := m.Tags.Value("user-id")    // stable numeric id (string of digits)
+	channelID := m.Tags.Value("room-id") // stable numeric id (string of digits)
+
+	// From source/params (logins)
+	userLogin := strings.ToLower(m.Source.Nick) // mutable username/login
+	chanLogin := strings.TrimPrefix(strings.ToLower(m.Params[0]), "#")
+
+	if channelID == "" && chanLogin == "" {
+		c.drop("PRIVMSG without channel id or login")
+		return
+	}
+
+	text := chattext.Clean(m.Trailing(), m.Tags.Value("emotes"), c.text)
+	c.emit(ctx, ircevents.PrivMsg{
+		ID:           m.Tags.Value("id"), // unique per message; used for dedup
+		UserID:       userID,             // may be empty if tags missing
+		UserLogin:    userLogin,          // may be empty if source absent
+		ChannelID:    channelID,          // may be empty if tags missing
+		ChannelLogin: chanLogin,          // fallback identity for channel
+		Text:         text.Text,
+		MaskedText:   text.Masked,
+		IsAction:     text.IsAction,
+	})
+}
+
+// membership reports our own JOIN/PART as confirmations to the rectifier.
+func (c *classifier) membership(ctx context.Context, m *ircmsg.Message) {
+	if len(m.Params) == 0 {
+		c.drop(m.Command + " missing channel")
+		return
+	}
+	if c.membershipCh == nil || strings.ToLower(m.Source.Nick) != c.self {
+		return
+	}
+	evt := types.MembershipEvent{
+		Op:      m.Command, // "JOIN" or "PART"
+		Channel: channelParam(m.Params[0]),
+	}
+	select {
+	case c.membershipCh <- evt:
+	case <-ctx.Done():
+	default:
+		// drop if full; rectifier will reconcile on next tick/timeout
+		c.lg.Debug("membership event dropped (full)", "channel", evt.Channel, "op", evt.Op)
+	}
+}
+
+func (c *classifier) usernotice(ctx context.Context, m *ircmsg.Message) {
+	if m.Tags.Value("msg-id") != "raid" {
+		return // subs, gifts, etc. not captured yet
+	}
+	if len(m.Params) == 0 {
+		c.drop("raid missing channel")
+		return
+	}
+	chanLogin := strings.TrimPrefix(strings.ToLower(m.Params[0]), "#")
+	fromLogin := strings.ToLower(m.Tags.Value("msg-param-login"))
+	if fromLogin == "" {
+		fromLogin = strings.ToLower(m.Tags.Value("login"))
+	}
+	viewers, _ := strconv.Atoi(m.Tags.Value("msg-param-viewerCount"))
+
+	c.emit(ctx, ircevents.Raid{
+		ID:           m.Tags.Value("id"),
+		ChannelID:    m.Tags.Value("room-id"),
+		ChannelLogin: chanLogin,
+		FromUserID:   m.Tags.Value("user-id"),
+		FromLogin:    fromLogin,
+		ViewerCount:  viewers,
+	})
+	if fromLogin != "" {
+		sendRaid(ctx, c.raidCh, types.RaidEvent{Kind: "raid", From: "#" + fromLogin, To: "#" + chanLogin, Viewers: viewers})
+	}
+}
+
+// hosttarget handles ":tmi.twitch.tv HOSTTARGET #hoster :target viewers";
+// a target of "-" ends a host.
+func (c *classifier) hosttarget(ctx context.Context, m *ircmsg.Message) {
+	if len(m.Params) < 2 {
+		return
+	}
+	fields := strings.Fields(m.Params[1])
+	if len(fields) == 0 || fields[0] == "-" {
+		return
+	}
+	viewers := 0
+	if len(fields) > 1 {
+		viewers, _ = strconv.Atoi(fields[1])
+	}
+	sendRaid(ctx, c.raidCh, types.RaidEvent{Kind: "host", From: channelParam(m.Params[0]), To: "#" + strings.ToLower(fields[0]), Viewers: viewers})
+}
+
+// userstate carries our own badges in a channel, which decide the message
+// limit that applies there.
+func (c *classifier) userstate(ctx context.Context, m *ircmsg.Message) {
+	if len(m.Params) == 0 {
+		return
+	}
+	ch := channelParam(m.Params[0])
+	badges := m.Tags.Value("badges")
+	st := types.UserState{
+		Channel:     ch,
+		Broadcaster: hasBadge(badges, "broadcaster"),
+		Moderator:   m.Tags.Value("mod") == "1" || hasBadge(badges, "moderator"),
+		VIP:         m.Tags.Value("vip") == "1" || hasBadge(badges, "vip"),
+	}
+	if c.roleCh != nil {
+		select {
+		case c.roleCh <- st:
+		case <-ctx.Done():
+			return
+		default:
+			c.lg.Debug("user state dropped (full)", "channel", ch)
+		}
+	}
+	sendSignal(ctx, c.chatCh, types.ChatSignal{Kind: types.ChatUserState, Channel: ch, Elevated: st.Elevated()})
+
+	// Twitch repeats USERSTATE after every PRIVMSG we send; only changes
+	// are worth a record.
+	fingerprint := badges + " " + m.Tags.Value("color") + " " + m.Tags.Value("display-name") + " " + m.Tags.Value("emote-sets")
+	if c.states[ch] == fingerprint {
+		return
+	}
+	c.states[ch] = fingerprint
+	c.emit(ctx, ircevents.UserState{
+		ChannelLogin: strings.TrimPrefix(ch, "#"),
+		DisplayName:  m.Tags.Value("display-name"),
+		Color:        m.Tags.Value("color"),
+		Badges:       parseBadges(badges),
+		EmoteSets:    splitList(m.Tags.Value("emote-sets")),
+		Broadcaster:  st.Broadcaster,
+		Moderator:    st.Moderator,
+		VIP:          st.VIP,
+	})
+}
+
+// globaluserstate is our identity, sent once after login. A new connection
+// starts from scratch, so the per-channel USERSTATEs are emitted again.
+func (c *classifier) globaluserstate(ctx context.Context, m *ircmsg.Message) {
+	clear(c.states)
+	c.emit(ctx, ircevents.GlobalUserState{
+		UserID:      m.Tags.Value("user-id"),
+		DisplayName: m.Tags.Value("display-name"),
+		Color:       m.Tags.Value("color"),
+		Badges:      parseBadges(m.Tags.Value("badges")),
+		EmoteSets:   splitList(m.Tags.Value("emote-sets")),
+	})
+}
+
+func (c *classifier) whisper(ctx context.Context, m *ircmsg.Message) {
+	if len(m.Params) < 2 {
+		c.drop("malformed WHISPER")
+		return
+	}
+	text := chattext.Clean(m.Trailing(), m.Tags.Value("emotes"), c.text)
+	c.emit(ctx, ircevents.Whisper{
+		ID:         m.Tags.Value("message-id"),
+		ThreadID:   m.Tags.Value("thread-id"),
+		FromUserID: m.Tags.Value("user-id"),
+		FromLogin:  strings.ToLower(m.Source.Nick),
+		ToLogin:    strings.ToLower(m.Params[0]),
+		Text:       text.Text,
+		MaskedText: text.Masked,
+		IsAction:   text.IsAction,
+	})
+}
+
+func (c *classifier) roomstate(ctx context.Context, m *ircmsg.Message) {
+	if len(m.Params) == 0 {
+		return
+	}
+	slow := -1 // partial updates only carry changed settings
+	if v, ok := m.Tags.Get("slow"); ok {
+		slow, _ = strconv.Atoi(v)
+	}
+	sendSignal(ctx, c.chatCh, types.ChatSignal{Kind: types.ChatRoomState, Channel: channelParam(m.Params[0]), SlowSeconds: slow})
+}
+
+func (c *classifier) notice(ctx context.Context, m *ircmsg.Message) {
+	msgID := m.Tags.Value("msg-id")
+	if len(m.Params) == 0 || msgID == "" {
+		return
+	}
+	ch := channelParam(m.Params[0])
+	sendSignal(ctx, c.chatCh, types.ChatSignal{
+		Kind:    types.ChatNotice,
+		Channel: ch,
+		MsgID:   msgID,
+		Text:    m.Param(1),
+	})
+
+	// the rectifier decides whether this refuses a pending JOIN
+	if c.membershipCh == nil {
+		return
+	}
+	select {
+	case c.membershipCh <- types.MembershipEvent{Op: "NOTICE", Channel: ch, Reason: msgID}:
+	case <-ctx.Done():
+	default:
+		c.lg.Debug("notice dropped (full)", "channel", ch, "msg_id", msgID)
+	}
+}
+
+// sendRaid forwards evt to the discovery policy without ever stalling the
+// classifier; raidCh may be nil when discovery is disabled.
+func sendRaid(ctx context.Context, raidCh chan<- types.RaidEvent, evt types.RaidEvent) {
+	if raidCh == nil {
+		return
+	}
+	select {
+	case raidCh <- evt:
+	case <-ctx.Done():
+	default:
+		observe.C("classifier").Debug("raid event dropped (full)", "from", evt.From, "to", evt.To)
+	}
+}
+
+// sendSignal forwards sig to the scheduler without stalling the classifier;
+// chatCh may be nil.
+func sendSignal(ctx context.Context, chatCh chan<- types.ChatSignal, sig types.ChatSignal) {
+	if chatCh == nil {
+		return
+	}
+	select {
+	case chatCh <- sig:
+	case <-ctx.Done():
+	default:
+		observe.C("classifier").Debug("chat signal dropped (full)", "kind", sig.Kind, "channel", sig.Channel)
+	}
+}
+
+// channelParam normalizes a channel parameter to "#name".
+func channelParam(p string) string {
+	ch := strings.ToLower(p)
+	if !strings.HasPrefix(ch, "#") {
+		ch = "#" + ch
+	}
+	return ch
+}
+
+// hasBadge reports whether a badges tag ("moderator/1,subscriber/12")
+// contains name.
+func hasBadge(badges, name string) bool {
+	for _, b := range strings.Split(badges, ",") {
+		if n, _, _ := strings.Cut(b, "/"); n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseBadges turns a badges tag into name -> version; nil when empty.
+func parseBadges(badges string) map[string]string {
+	if badges == "" {
+		return nil
+	}
+	out := make(map[string]string)
+	for _, b := range strings.Split(badges, ",") {
+		if name, version, _ := strings.Cut(b, "/"); name != "" {
+			out[name] = version
+		}
+	}
+	return out
+}
+
+// splitList splits a comma-separated tag value; nil when empty.
+func splitList(v string) []string {
+	if v == "" {
+		return nil
+	}
+	return strings.Split(v, ",")
+}
@@ -0,0 +1,340 @@
+package classifier
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/chattext"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/deadletter"
+	ircevents "github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/irc_events"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/types"
+)
+
+type clsRig struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	in     chan string
+	out    chan ircevents.Event
+	memb   chan types.MembershipEvent
+	raids  chan types.RaidEvent
+	roles  chan types.UserState
+	chat   chan types.ChatSignal
+}
+
+func newRig(self string) *clsRig {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &clsRig{
+		ctx:    ctx,
+		cancel: cancel,
+		in:     make(chan string, 8),
+		out:    make(chan ircevents.Event, 8),
+		memb:   make(chan types.MembershipEvent, 8),
+		raids:  make(chan types.RaidEvent, 8),
+		roles:  make(chan types.UserState, 8),
+		chat:   make(chan types.ChatSignal, 8),
+	}
+	go ClassifyLine(ctx, r.in, Config{
+		Events:     r.out,
+		Membership: r.memb,
+		Raids:      r.raids,
+		Roles:      r.roles,
+		Chat:       r.chat,
+		Self:       self,
+		Text:       chattext.Options{StripBypass: true},
+	})
+	return r
+}
+
+func (r *clsRig) close() {
+	r.cancel()
+	close(r.in)
+}
+
+func recvEvt[T any](ch <-chan T) (v T, ok bool) {
+	select {
+	case v = <-ch:
+		return v, true
+	case <-time.After(100 * time.Millisecond):
+		return v, false
+	}
+}
+
+func TestClassifier_PrivMsg_Full(t *testing.T) {
+	r := newRig("selfuser")
+	defer r.close()
+
+	line := "@user-id=123;room-id=999;color=\\:blue\\;;badges=subscriber/3 :bob!bob@bob.tmi.twitch.tv PRIVMSG #chess :hello\\sworld!"
+	r.in <- line
+
+	ev, ok := recvEvt(r.out)
+	if !ok {
+		t.Fatal("no event emitted")
+	}
+	pm, ok := ev.(ircevents.PrivMsg)
+	if !ok {
+		t.Fatalf("expected PrivMsg, got %T", ev)
+	}
+
+	if pm.UserID != "123" || pm.ChannelID != "999" {
+		t.Fatalf("wrong ids: %+v", pm)
+	}
+	if pm.UserLogin != "bob" || pm.ChannelLogin != "chess" {
+		t.Fatalf("wrong logins: %+v", pm)
+	}
+	if pm.Text != "hello\\sworld!" {
+		t.Fatalf("unexpected text (trailing is not IRCv3-escaped): %q", pm.Text)
+	}
+}
+
+func TestClassifier_PrivMsg_Action(t *testing.T) {
+	r := newRig("selfuser")
+	defer r.close()
+
+	r.in <- "@emotes=25:6-10;room-id=999;user-id=123 :bob!bob@bob.tmi.twitch.tv PRIVMSG #chess :\x01ACTION waves Kappa \U000E0000\x01"
+
+	ev, ok := recvEvt(r.out)
+	if !ok {
+		t.Fatal("no event emitted")
+	}
+	pm := ev.(ircevents.PrivMsg)
+	if !pm.IsAction || pm.Text != "waves Kappa" || pm.MaskedText != "waves <emote>" {
+		t.Fatalf("action = %+v", pm)
+	}
+}
+
+func TestClassifier_PrivMsg_NoTags_Fallback(t *testing.T) {
+	r := newRig("selfuser")
+	defer r.close()
+
+	line := ":Alice!alice@tmi.twitch.tv PRIVMSG #SpeedRun :Go fast"
+	r.in <- line
+
+	ev, ok := recvEvt(r.out)
+	if !ok {
+		t.Fatal("no event")
+	}
+	pm := ev.(ircevents.PrivMsg)
+
+	// IDs absent, but logins captured (lowercased)
+	if pm.UserID != "" || pm.ChannelID != "" {
+		t.Fatalf("unexpected ids: %+v", pm)
+	}
+	if pm.UserLogin != "alice" || pm.ChannelLogin != "speedrun" {
+		t.Fatalf("fallback logins wrong: %+v", pm)
+	}
+	if pm.Text != "Go fast" {
+		t.Fatalf("text mismatch: %q", pm.Text)
+	}
+}
+
+func TestClassifier_PrivMsg_Malformed_Skipped(t *testing.T) {
+	r := newRig("selfuser")
+	defer r.close()
+
+	// Missing trailing part after " :"
+	r.in <- ":bob!bob@tmi PRIVMSG #chess"
+	if _, ok := recvEvt(r.out); ok {
+		t.Fatal("expected no event for malformed PRIVMSG")
+	}
+}
+
+func TestClassifier_Membership_SelfOnly(t *testing.T) {
+	r := newRig("me")
+	defer r.close()
+
+	// Another user JOIN - ignored
+	r.in <- ":alice!alice@tmi.twitch.tv JOIN #chess"
+	if _, ok := recvEvt(r.memb); ok {
+		t.Fatal("non-self JOIN should not emit membership event")
+	}
+
+	// Self JOIN emits
+	r.in <- ":me!me@tmi.twitch.tv JOIN #chess"
+	ev, ok := recvEvt(r.memb)
+	if !ok {
+		t.Fatal("expected membership join")
+	}
+	if ev.Op != "JOIN" || ev.Channel != "#chess" {
+		t.Fatalf("wrong membership: %+v", ev)
+	}
+
+	// Self PART emits
+	r.in <- ":me!me@tmi.twitch.tv PART chess" // missing '#' accepted by normaliser in writer
+	ev, ok = recvEvt(r.memb)
+	if !ok {
+		t.Fatal("expected membership part")
+	}
+	if ev.Op != "PART" || ev.Channel != "#chess" {
+		t.Fatalf("wrong membership: %+v", ev)
+	}
+}
+
+func TestClassifier_UserNoticeRaid(t *testing.T) {
+	r := newRig("me")
+	defer r.close()
+
+	r.in <- "@msg-id=raid;msg-param-login=Alice;msg-param-viewerCount=42;room-id=999;user-id=123;login=alice :tmi.twitch.tv USERNOTICE #chess"
+
+	ev, ok := recvEvt(r.out)
+	if !ok {
+		t.Fatal("no raid event emitted")
+	}
+	raid, ok := ev.(ircevents.Raid)
+	if !ok {
+		t.Fatalf("expected Raid, got %T", ev)
+	}
+	if raid.FromLogin != "alice" || raid.ChannelLogin != "chess" || raid.ViewerCount != 42 || raid.ChannelID != "999" {
+		t.Fatalf("wrong raid: %+v", raid)
+	}
+
+	sig, ok := recvEvt(r.raids)
+	if !ok {
+		t.Fatal("no raid signal for discovery")
+	}
+	if sig.From != "#alice" || sig.To != "#chess" || sig.Kind != "raid" {
+		t.Fatalf("wrong raid signal: %+v", sig)
+	}
+
+	// Other USERNOTICEs are still ignored.
+	r.in <- "@msg-id=sub;login=bob :tmi.twitch.tv USERNOTICE #chess :hi"
+	if _, ok := recvEvt(r.out); ok {
+		t.Fatal("non-raid USERNOTICE should not emit")
+	}
+}
+
+func TestClassifier_UserStateRoles(t *testing.T) {
+	r := newRig("me")
+	defer r.close()
+
+	r.in <- "@badges=moderator/1,subscriber/6;mod=1;user-type=mod :tmi.twitch.tv USERSTATE #Chess"
+	st, ok := recvEvt(r.roles)
+	if !ok {
+		t.Fatal("no user state emitted")
+	}
+	if st.Channel != "#chess" || !st.Moderator || !st.Elevated() {
+		t.Fatalf("wrong user state: %+v", st)
+	}
+
+	r.in <- "@badges=subscriber/6;mod=0 :tmi.twitch.tv USERSTATE #speedrun"
+	if st, _ := recvEvt(r.roles); st.Elevated() {
+		t.Fatalf("plain user reported elevated: %+v", st)
+	}
+}
+
+func TestClassifier_ChatSignals(t *testing.T) {
+	r := newRig("me")
+	defer r.close()
+
+	r.in <- "@emote-only=0;room-id=999;slow=30 :tmi.twitch.tv ROOMSTATE #chess"
+	sig, ok := recvEvt(r.chat)
+	if !ok || sig.Kind != types.ChatRoomState || sig.Channel != "#chess" || sig.SlowSeconds != 30 {
+		t.Fatalf("roomstate signal = %+v, %v", sig, ok)
+	}
+
+	r.in <- "@room-id=999;subs-only=1 :tmi.twitch.tv ROOMSTATE #chess"
+	if sig, _ := recvEvt(r.chat); sig.SlowSeconds != -1 {
+		t.Fatalf("partial roomstate should leave slow unset, got %+v", sig)
+	}
+
+	r.in <- "@msg-id=msg_duplicate :tmi.twitch.tv NOTICE #chess :Your message was not sent because it is identical to the previous one you sent, less than 30 seconds ago."
+	sig, ok = recvEvt(r.chat)
+	if !ok || sig.Kind != types.ChatNotice || sig.MsgID != "msg_duplicate" || sig.Text == "" {
+		t.Fatalf("notice signal = %+v, %v", sig, ok)
+	}
+
+	r.in <- "@badges=broadcaster/1 :tmi.twitch.tv USERSTATE #chess"
+	<-r.roles
+	if sig, _ := recvEvt(r.chat); sig.Kind != types.ChatUserState || !sig.Elevated {
+		t.Fatalf("userstate signal = %+v", sig)
+	}
+}
+
+func TestClassifier_IdentityState(t *testing.T) {
+	r := newRig("me")
+	defer r.close()
+
+	r.in <- "@badge-info=;badges=premium/1;color=#0D4200;display-name=Me;emote-sets=0,33,50;user-id=222;user-type= :tmi.twitch.tv GLOBALUSERSTATE"
+	evt, ok := recvEvt(r.out)
+	g, _ := evt.(ircevents.GlobalUserState)
+	if !ok || g.UserID != "222" || g.Badges["premium"] != "1" || len(g.EmoteSets) != 3 || g.Color != "#0D4200" {
+		t.Fatalf("global user state = %#v", evt)
+	}
+
+	line := "@badges=moderator/1;color=#0D4200;display-name=Me;emote-sets=0,33;mod=1 :tmi.twitch.tv USERSTATE #Chess"
+	r.in <- line
+	evt, ok = recvEvt(r.out)
+	u, _ := evt.(ircevents.UserState)
+	if !ok || u.ChannelLogin != "chess" || !u.Moderator || u.VIP || u.Badges["moderator"] != "1" || len(u.EmoteSets) != 2 {
+		t.Fatalf("user state = %#v", evt)
+	}
+
+	// repeated after each PRIVMSG we send; unchanged, so no record
+	r.in <- "@id=abc;" + line[1:]
+	if evt, ok := recvEvt(r.out); ok {
+		t.Fatalf("unchanged user state emitted again: %#v", evt)
+	}
+
+	r.in <- "@badges=vip/1;vip=1 :tmi.twitch.tv USERSTATE #chess"
+	if evt, _ := recvEvt(r.out); !evt.(ircevents.UserState).VIP {
+		t.Fatalf("changed user state = %#v", evt)
+	}
+}
+
+func TestClassifier_Whisper(t *testing.T) {
+	r := newRig("me")
+	defer r.close()
+
+	r.in <- "@badges=;color=#1E90FF;display-name=Alice;emotes=25:4-8;message-id=7;thread-id=111_222;turbo=0;user-id=111;user-type= :alice!alice@alice.tmi.twitch.tv WHISPER me :hey Kappa"
+	evt, ok := recvEvt(r.out)
+	w, _ := evt.(ircevents.Whisper)
+	want := ircevents.Whisper{
+		ID: "7", ThreadID: "111_222", FromUserID: "111", FromLogin: "alice", ToLogin: "me",
+		Text: "hey Kappa", MaskedText: "hey <emote>",
+	}
+	if !ok || w != want {
+		t.Fatalf("whisper = %#v, want %#v", evt, want)
+	}
+	if w.Key() != "111_222" || w.MessageID() != "7" {
+		t.Fatalf("key/id = %q/%q", w.Key(), w.MessageID())
+	}
+}
+
+func TestClassifier_NoticeReachesRectifier(t *testing.T) {
+	r := newRig("me")
+	defer r.close()
+
+	r.in <- "@msg-id=msg_channel_suspended :tmi.twitch.tv NOTICE #Gone :This channel does not exist or has been suspended."
+	evt, ok := recvEvt(r.memb)
+	if !ok || evt != (types.MembershipEvent{Op: "NOTICE", Channel: "#gone", Reason: "msg_channel_suspended"}) {
+		t.Fatalf("membership event = %+v, %v", evt, ok)
+	}
+}
+
+type sinkStub chan deadletter.Record
+
+func (s sinkStub) Write(_ context.Context, r deadletter.Record) error { s <- r; return nil }
+func (s sinkStub) Close() error                                       { return nil }
+
+func TestClassifier_DeadLetter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	in := make(chan string, 4)
+	sink := make(sinkStub, 4)
+	dead := deadletter.New(100, 10)
+	go func() { _ = dead.Run(ctx, sink) }()
+	go ClassifyLine(ctx, in, Config{Events: make(chan ircevents.Event, 4), Self: "me", Dead: dead})
+
+	in <- "@a=b :src"
+	in <- ":bob!bob@bob.tmi.twitch.tv PRIVMSG #chess"
+	for _, want := range []deadletter.Record{
+		{Stage: "classifier", Reason: "ircmsg: missing command", Line: "@a=b :src"},
+		{Stage: "classifier", Reason: "malformed PRIVMSG", Line: ":bob!bob@bob.tmi.twitch.tv PRIVMSG #chess"},
+	} {
+		got, ok := recvEvt((<-chan deadletter.Record)(sink))
+		got.Time = time.Time{}
+		if !ok || got != want {
+			t.Fatalf("dead letter = %+v, want %+v", got, want)
+		}
+	}
+}
@@ -0,0 +1,495 @@
+// Package collector is the IRC collector pipeline: the Twitch connection,
+// classifier, Kafka producer, channel rectifier and HTTP control API, wired
+// together from the environment.
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/sync/errgroup"
+
+	channelrecord "github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/channel_record"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/chattext"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/classifier"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/config"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/deadletter"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/eventsub"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/healthcheck"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/httpapi"
+	ircevents "github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/irc_events"
+	kstream "github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/kafka"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/leader"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/oauth"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/observe"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/outbound"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/rawarchive"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/scheduler"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/types"
+)
+
+// Run is the whole collector, configured from the environment, until ctx
+// is canceled. Events go to w, or to KAFKA_TOPIC when w is nil.
+func Run(root context.Context, w kstream.MessageWriter) error {
+	lg := observe.C("irc_collector")
+
+	account, err := config.LoadAccount(os.Getenv("ACCOUNTS_PATH"))
+	if err != nil {
+		return fmt.Errorf("load account: %w", err)
+	}
+	selfLogin := strings.ToLower(account.User)
+
+	token, err := oauth.LoadTokenJSON(os.Getenv("TOKENS_PATH"))
+	if err != nil {
+		return fmt.Errorf("load token: %w", err)
+	}
+
+	// pipeline context derives from root
+	g, ctx := errgroup.WithContext(root)
+
+	// pipeline channels
+	controlCh := make(chan types.IRCCommand, 100)
+	rectifierOutCh := make(chan types.IRCCommand, 100)
+	membershipCh := make(chan types.MembershipEvent, 100)
+	var raidCh chan types.RaidEvent // nil unless auto-discovery is enabled
+	writerCh := make(chan string, 100)
+	socketCh := make(chan string) // unbuffered: the limiter picks what goes next
+	chatCh := make(chan types.ChatSignal, 100)
+	roleCh := make(chan types.UserState, 100)
+	readerCh := make(chan string, 1000)
+	parseCh := make(chan ircevents.Event, 1000)
+
+	sessCfg, err := sessionConfigFromEnv()
+	if err != nil {
+		return fmt.Errorf("invalid keepalive config: %w", err)
+	}
+	reloadPolicy, err := channelrecord.ParseReloadPolicy(strings.ToLower(strings.TrimSpace(os.Getenv("CHANNELS_RELOAD"))))
+	if err != nil {
+		return fmt.Errorf("invalid CHANNELS_RELOAD: %w", err)
+	}
+	var elector *leader.Elector // nil unless active/standby is enabled
+	if leasePath := strings.TrimSpace(os.Getenv("LEADER_LEASE_PATH")); leasePath != "" {
+		if elector, err = electorFromEnv(leasePath); err != nil {
+			return fmt.Errorf("invalid leader election config: %w", err)
+		}
+	}
+	discCfg, discOn, err := discoveryConfigFromEnv()
+	if err != nil {
+		return fmt.Errorf("invalid auto-discovery config: %w", err)
+	}
+	var raidWatch *eventsub.Config // nil unless raids are followed
+	if discOn && slices.Contains(discCfg.Follow, "raid") {
+		if raidWatch, err = eventsubFromEnv(); err != nil {
+			return fmt.Errorf("invalid auto-discovery config: %w", err)
+		}
+	}
+	archive, archiveSink, err := rawArchiveFromEnv()
+	if err != nil {
+		return fmt.Errorf("invalid raw archive config: %w", err)
+	}
+	if archiveSink != nil {
+		defer func() {
+			if archiveSink != nil {
+				_ = archiveSink.Close() // never handed to archive.Run
+			}
+		}()
+	}
+
+	// connect (fail fast before goroutines)
+	lg.Info("starting", "nick", account.Nick)
+
+	uri := os.Getenv("TWITCH_IRC_URI")
+	accessToken := func() string {
+		// pick up a token refreshed by oauth_server since the last use
+		if t, err := oauth.LoadTokenJSON(os.Getenv("TOKENS_PATH")); err == nil {
+			return t.AccessToken
+		}
+		return token.AccessToken
+	}
+	dial := func(ctx context.Context) (*websocket.Conn, error) {
+		return TwitchWebsocket(ctx, accessToken(), account.Nick, uri)
+	}
+	conn, err := dial(ctx)
+	if err != nil {
+		return fmt.Errorf("websocket connect %s: %w", uri, err)
+	}
+	defer func() { _ = conn.Close() }() // Session closes it too; this covers early returns
+
+	lg.Info("connected", "uri", uri)
+
+	// Outbound limiter: writerCh -> socketCh within Twitch's rate limits
+	limits := outbound.DefaultLimits()
+	if v, _ := strconv.ParseBool(os.Getenv("IRC_VERIFIED_BOT")); v {
+		limits = outbound.VerifiedBotLimits()
+	}
+	limiter := outbound.New(limits)
+
+	sessCfg.Archive = archive
+	sessCfg.OnReset = limiter.Reset // queued JOINs and PRIVMSGs die with the socket
+	session := NewSession(dial, sessCfg)
+
+	// Desired-state store (channels.json by default)
+	store, err := openStore(account.Nick)
+	if err != nil {
+		return fmt.Errorf("open channel store: %w", err)
+	}
+	defer func() {
+		if err := store.Close(); err != nil {
+			lg.Warn("channel store close failed", "err", err)
+		}
+	}()
+
+	// Build controller (single writer), consuming HTTP intents from controlCh.
+	ctl, err := channelrecord.NewControllerWithStore(store, account.Nick, controlCh)
+	if err != nil {
+		return fmt.Errorf("init controller (%s): %w", store.String(), err)
+	}
+	ctl.SetReloadPolicy(reloadPolicy)
+
+	// kafka writer (lifecycle tied to run) unless the caller brought one
+	if w == nil {
+		kw := kstream.NewWriter(os.Getenv("KAFKA_BROKERS"), os.Getenv("KAFKA_TOPIC"))
+		defer func() {
+			if err := kw.Close(); err != nil {
+				lg.Error("kafka writer close failed", "err", err)
+			}
+		}()
+		w = kw
+	}
+
+	// Whispers are private: they go to their own topic, or nowhere.
+	whisperRoute := kstream.Route{Kind: "whisper"}
+	if topic := strings.TrimSpace(os.Getenv("KAFKA_WHISPER_TOPIC")); topic != "" {
+		ww := kstream.NewWriter(os.Getenv("KAFKA_BROKERS"), topic)
+		defer func() {
+			if err := ww.Close(); err != nil {
+				lg.Error("kafka whisper writer close failed", "err", err)
+			}
+		}()
+		whisperRoute.Writer = ww
+	}
+
+	// Optional dead-letter sink for dropped lines and events
+	dead, deadSink, err := deadLetterFromEnv()
+	if err != nil {
+		return fmt.Errorf("invalid dead-letter config: %w", err)
+	}
+	if deadSink != nil {
+		defer func() {
+			if err := deadSink.Close(); err != nil {
+				lg.Warn("dead-letter sink close failed", "err", err)
+			}
+		}()
+	}
+
+	// all stages run under errgroup; nothing below may return early
+
+	// Channels controller
+	g.Go(func() error { return ctl.Run(ctx) })
+
+	if dead != nil {
+		g.Go(func() error { return dead.Run(ctx, deadSink) })
+	}
+
+	// Raw line archive; Run closes the sink once the buffer is written out
+	if archive != nil {
+		sink := archiveSink
+		archiveSink = nil
+		g.Go(func() error { return archive.Run(ctx, sink) })
+	}
+
+	// Rectifier phase board, shared with the HTTP API for wait=
+	status := channelrecord.NewStatusBoard()
+
+	// Optional active/standby: only the lease holder joins channels.
+	cfg := channelrecord.NewDefaultConfig()
+	cfg.Status = status
+	checks := []healthcheck.Check{session.ReadinessCheck()}
+	if elector != nil {
+		cfg.Gate = elector
+		checks = append(checks, elector.ReadinessCheck())
+		g.Go(func() error { return elector.Run(ctx) })
+	}
+
+	// HTTP control plane
+	g.Go(func() error { return httpapi.Run(ctx, controlCh, rectifierOutCh, membershipCh, ctl, status, checks...) })
+
+	// Channel rectifier
+	g.Go(func() error {
+		return channelrecord.Run(ctx, ctl, membershipCh, rectifierOutCh, cfg)
+	})
+
+	// Raid/host auto-discovery -> controlCh
+	if discOn {
+		raidCh = make(chan types.RaidEvent, 100)
+		g.Go(func() error {
+			return channelrecord.RunDiscovery(ctx, ctl, raidCh, controlCh, discCfg)
+		})
+	}
+
+	// Raids out of operator channels (EventSub channel.raid) -> raidCh
+	if raidWatch != nil {
+		raidWatch.Token = accessToken
+		watcher := eventsub.NewRaidWatcher(*raidWatch, ctl)
+		g.Go(func() error { return watcher.Run(ctx, raidCh) })
+	}
+
+	// IRC control scheduler (JOIN/PART/PRIVMSG -> writerCh)
+	g.Go(func() error {
+		scheduler.ControlScheduler(ctx, rectifierOutCh, writerCh, chatCh)
+		return nil
+	})
+
+	// IRC connection: socket -> readerCh, socketCh -> socket, keepalive and
+	// PONGs -> writerCh; redials when the connection dies
+	g.Go(func() error {
+		return session.Run(ctx, conn, writerCh, socketCh, readerCh, membershipCh)
+	})
+
+	// Outbound limiter; which PRIVMSGs it wrote or dropped goes back to the
+	// scheduler on chatCh
+	g.Go(func() error { return limiter.Run(ctx, writerCh, roleCh, socketCh, chatCh) })
+
+	// Parser: readerCh -> parseCh
+	stripBypass, _ := strconv.ParseBool(os.Getenv("IRC_STRIP_BYPASS_CHARS"))
+	textOpt := chattext.Options{StripBypass: stripBypass}
+	g.Go(func() error {
+		classifier.ClassifyLine(ctx, readerCh, classifier.Config{
+			Events:     parseCh,
+			Membership: membershipCh,
+			Raids:      raidCh,
+			Roles:      roleCh,
+			Chat:       chatCh,
+			Self:       selfLogin,
+			Text:       textOpt,
+			Dead:       dead,
+		})
+		return nil
+	})
+
+	// Kafka producer: parseCh -> Kafka
+	g.Go(func() error {
+		kstream.KafkaProducer(ctx, w, parseCh, dead, whisperRoute)
+		return nil
+	})
+
+	// wait for first error or signal; stages unwinding on cancel aren't failures
+	err = g.Wait()
+	if root.Err() != nil && errors.Is(err, context.Canceled) {
+		err = nil
+	}
+	return err
+}
+
+// sessionConfigFromEnv reads IRC_PING_INTERVAL (0 disables client PINGs)
+// and IRC_PONG_TIMEOUT.
+func sessionConfigFromEnv() (SessionConfig, error) {
+	cfg := DefaultSessionConfig()
+	for key, dst := range map[string]*time.Duration{
+		"IRC_PING_INTERVAL": &cfg.PingInterval,
+		"IRC_PONG_TIMEOUT":  &cfg.PongTimeout,
+	} {
+		v := strings.TrimSpace(os.Getenv(key))
+		if v == "" {
+			continue
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return cfg, fmt.Errorf("%s: invalid duration %q", key, v)
+		}
+		*dst = d
+	}
+	if cfg.PingInterval > 0 && cfg.PongTimeout <= 0 {
+		return cfg, fmt.Errorf("IRC_PONG_TIMEOUT must be positive while client PINGs are on")
+	}
+	return cfg, nil
+}
+
+// deadLetterFromEnv sets up the dead-letter sink: DEADLETTER_TOPIC (Kafka)
+// or DEADLETTER_PATH (local JSONL), limited to DEADLETTER_RATE records per
+// second with bursts of DEADLETTER_BURST. With neither set it returns a nil
+// Box, which drops silently.
+func deadLetterFromEnv() (*deadletter.Box, deadletter.Sink, error) {
+	topic := strings.TrimSpace(os.Getenv("DEADLETTER_TOPIC"))
+	path := strings.TrimSpace(os.Getenv("DEADLETTER_PATH"))
+	if topic != "" && path != "" {
+		return nil, nil, fmt.Errorf("set DEADLETTER_TOPIC or DEADLETTER_PATH, not both")
+	}
+	if topic == "" && path == "" {
+		return nil, nil, nil
+	}
+
+	rate, burst := 5.0, 50
+	if v := strings.TrimSpace(os.Getenv("DEADLETTER_RATE")); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f <= 0 {
+			return nil, nil, fmt.Errorf("DEADLETTER_RATE: invalid rate %q", v)
+		}
+		rate = f
+	}
+	if v := strings.TrimSpace(os.Getenv("DEADLETTER_BURST")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return nil, nil, fmt.Errorf("DEADLETTER_BURST: invalid burst %q", v)
+		}
+		burst = n
+	}
+
+	var sink deadletter.Sink
+	if topic != "" {
+		sink = deadletter.KafkaSink{W: kstream.NewWriter(os.Getenv("KAFKA_BROKERS"), topic)}
+	} else {
+		fs, err := deadletter.NewFileSink(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		sink = fs
+	}
+	return deadletter.New(rate, burst), sink, nil
+}
+
+// rawArchiveBuffer is how many lines may wait for the archive sink before
+// lines are dropped; a few seconds of a busy connection.
+const rawArchiveBuffer = 10000
+
+// rawArchiveFromEnv sets up raw line archival: RAW_ARCHIVE_TOPIC (Kafka) or
+// RAW_ARCHIVE_DIR (zstd segments rotated at RAW_ARCHIVE_SEGMENT_BYTES of
+// raw data or RAW_ARCHIVE_SEGMENT_AGE). With neither set it returns nil.
+func rawArchiveFromEnv() (*rawarchive.Archive, rawarchive.Sink, error) {
+	topic := strings.TrimSpace(os.Getenv("RAW_ARCHIVE_TOPIC"))
+	dir := strings.TrimSpace(os.Getenv("RAW_ARCHIVE_DIR"))
+	switch {
+	case topic != "" && dir != "":
+		return nil, nil, fmt.Errorf("set RAW_ARCHIVE_TOPIC or RAW_ARCHIVE_DIR, not both")
+	case topic != "":
+		w := rawarchive.NewKafkaWriter(os.Getenv("KAFKA_BROKERS"), topic)
+		return rawarchive.New(rawArchiveBuffer), rawarchive.NewKafkaSink(w), nil
+	case dir == "":
+		return nil, nil, nil
+	}
+
+	maxBytes := int64(64 << 20)
+	if v := strings.TrimSpace(os.Getenv("RAW_ARCHIVE_SEGMENT_BYTES")); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			return nil, nil, fmt.Errorf("RAW_ARCHIVE_SEGMENT_BYTES: invalid size %q", v)
+		}
+		maxBytes = n
+	}
+	maxAge := time.Hour
+	if v := strings.TrimSpace(os.Getenv("RAW_ARCHIVE_SEGMENT_AGE")); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, nil, fmt.Errorf("RAW_ARCHIVE_SEGMENT_AGE: invalid duration %q", v)
+		}
+		maxAge = d
+	}
+	sink, err := rawarchive.NewSegmentSink(dir, maxBytes, maxAge)
+	if err != nil {
+		return nil, nil, err
+	}
+	return rawarchive.New(rawArchiveBuffer), sink, nil
+}
+
+// openStore picks the desired-state backend from CHANNELS_STORE: "file"
+// (default, CHANNELS_PATH) or "sqlite" (CHANNELS_SQLITE_PATH, with the set
+// named by CHANNELS_SET or the account).
+func openStore(account string) (channelrecord.Store, error) {
+	switch backend := strings.ToLower(strings.TrimSpace(os.Getenv("CHANNELS_STORE"))); backend {
+	case "", "file":
+		return channelrecord.NewFileStore(os.Getenv("CHANNELS_PATH"))
+	case "sqlite":
+		set := strings.TrimSpace(os.Getenv("CHANNELS_SET"))
+		if set == "" {
+			set = account
+		}
+		return channelrecord.OpenSQLiteStore(os.Getenv("CHANNELS_SQLITE_PATH"), set)
+	default:
+		return nil, fmt.Errorf("CHANNELS_STORE: unknown backend %q", backend)
+	}
+}
+
+// electorFromEnv builds a file-lease elector identified by LEADER_ID
+// (default: hostname) that retries every LEADER_INTERVAL (default 2s).
+func electorFromEnv(leasePath string) (*leader.Elector, error) {
+	id := strings.TrimSpace(os.Getenv("LEADER_ID"))
+	if id == "" {
+		h, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("LEADER_ID unset and hostname unavailable: %w", err)
+		}
+		id = h
+	}
+	interval := 2 * time.Second
+	if v := strings.TrimSpace(os.Getenv("LEADER_INTERVAL")); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("LEADER_INTERVAL: invalid duration %q", v)
+		}
+		interval = d
+	}
+	lease, err := leader.NewFileLease(leasePath, id)
+	if err != nil {
+		return nil, err
+	}
+	return leader.NewElector(lease, id, interval), nil
+}
+
+// eventsubFromEnv configures the EventSub raid watcher. It needs
+// TWITCH_CLIENT_ID, the app the token in TOKENS_PATH was issued to;
+// EVENTSUB_WS_URL and HELIX_URL override the Twitch endpoints.
+func eventsubFromEnv() (*eventsub.Config, error) {
+	clientID := strings.TrimSpace(os.Getenv("TWITCH_CLIENT_ID"))
+	if clientID == "" {
+		return nil, fmt.Errorf("AUTODISCOVER=raid needs TWITCH_CLIENT_ID for EventSub")
+	}
+	cfg := eventsub.NewDefaultConfig(clientID, nil)
+	if v := strings.TrimSpace(os.Getenv("EVENTSUB_WS_URL")); v != "" {
+		cfg.WSURL = v
+	}
+	if v := strings.TrimSpace(os.Getenv("HELIX_URL")); v != "" {
+		cfg.HelixURL = v
+	}
+	return &cfg, nil
+}
+
+// discoveryConfigFromEnv reads AUTODISCOVER (comma-separated kinds to follow,
+// e.g. "raid,host"; empty disables), AUTODISCOVER_TTL and AUTODISCOVER_MAX.
+func discoveryConfigFromEnv() (channelrecord.DiscoveryConfig, bool, error) {
+	cfg := channelrecord.NewDefaultDiscoveryConfig()
+	kinds := strings.TrimSpace(os.Getenv("AUTODISCOVER"))
+	if kinds == "" {
+		return cfg, false, nil
+	}
+	cfg.Follow = nil
+	for _, k := range strings.Split(kinds, ",") {
+		switch k = strings.ToLower(strings.TrimSpace(k)); k {
+		case "raid", "host":
+			cfg.Follow = append(cfg.Follow, k)
+		default:
+			return cfg, false, fmt.Errorf("AUTODISCOVER: unknown kind %q", k)
+		}
+	}
+	if v := strings.TrimSpace(os.Getenv("AUTODISCOVER_TTL")); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return cfg, false, fmt.Errorf("AUTODISCOVER_TTL: invalid duration %q", v)
+		}
+		cfg.TTL = d
+	}
+	if v := strings.TrimSpace(os.Getenv("AUTODISCOVER_MAX")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return cfg, false, fmt.Errorf("AUTODISCOVER_MAX: invalid count %q", v)
+		}
+		cfg.MaxAuto = n
+	}
+	return cfg, true, nil
+}
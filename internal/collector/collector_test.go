@@ -0,0 +1,54 @@
+package collector
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/fakeirc"
+)
+
+// TestRun_BadConfigStartsNothing checks that invalid settings are reported
+// before Run dials or starts any stage.
+func TestRun_BadConfigStartsNothing(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		env  map[string]string
+	}{
+		{"leader", map[string]string{"LEADER_LEASE_PATH": "lease", "LEADER_INTERVAL": "soon"}},
+		{"discovery", map[string]string{"AUTODISCOVER": "raid,lurk"}},
+		{"eventsub", map[string]string{"AUTODISCOVER": "raid"}}, // no TWITCH_CLIENT_ID
+		{"reload", map[string]string{"CHANNELS_RELOAD": "sometimes"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			irc := fakeirc.New(fakeirc.Config{Token: "secret"})
+			if err := irc.Listen("127.0.0.1:0"); err != nil {
+				t.Fatal(err)
+			}
+			defer irc.Close()
+			port := collectorEnv(t, irc)
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+
+			done := make(chan error, 1)
+			go func() { done <- Run(context.Background(), &memWriter{}) }()
+			select {
+			case err := <-done:
+				if err == nil {
+					t.Fatal("Run accepted invalid config")
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Run did not return")
+			}
+			if got := irc.Received(); len(got) != 0 {
+				t.Fatalf("Run connected before failing: %q", got)
+			}
+			if c, err := net.Dial("tcp", "127.0.0.1:"+port); err == nil {
+				_ = c.Close()
+				t.Fatal("HTTP API still listening")
+			}
+		})
+	}
+}
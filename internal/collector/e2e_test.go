@@ -0,0 +1,193 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/fakeirc"
+	kstream "github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/kafka"
+)
+
+// memWriter keeps everything the producer writes.
+type memWriter struct {
+	mu   sync.Mutex
+	msgs []kafkago.Message
+}
+
+func (w *memWriter) WriteMessages(_ context.Context, msgs ...kafkago.Message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.msgs = append(w.msgs, msgs...)
+	return nil
+}
+
+func (w *memWriter) Close() error { return nil }
+
+// find returns the first message of kind whose value contains sub.
+func (w *memWriter) find(kind, sub string) (kafkago.Message, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, m := range w.msgs {
+		for _, h := range m.Headers {
+			if h.Key == kstream.HeaderKind && string(h.Value) == kind && strings.Contains(string(m.Value), sub) {
+				return m, true
+			}
+		}
+	}
+	return kafkago.Message{}, false
+}
+
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(15 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func writeFile(t *testing.T, dir, name, body string) string {
+	t.Helper()
+	p := filepath.Join(dir, name)
+	if err := os.WriteFile(p, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func freePort(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return fmt.Sprint(ln.Addr().(*net.TCPAddr).Port)
+}
+
+// collectorEnv points Run at irc with a desired set of #chess and every
+// optional stage off, and returns the HTTP API port.
+func collectorEnv(t *testing.T, irc *fakeirc.Server) string {
+	t.Helper()
+	dir := t.TempDir()
+	port := freePort(t)
+	env := map[string]string{
+		"ACCOUNTS_PATH":  writeFile(t, dir, "account.json", `{"accountname":"collector","username":"collector"}`),
+		"TOKENS_PATH":    writeFile(t, dir, "token.json", `{"access_token":"secret"}`),
+		"CHANNELS_PATH":  writeFile(t, dir, "channels.json", `{"schema":2,"account":"collector","channels":[{"name":"#chess"}]}`),
+		"TWITCH_IRC_URI": irc.URL(),
+		"HTTP_API_HOST":  "127.0.0.1",
+		"HTTP_API_PORT":  port,
+	}
+	// Keep the optional stages off whatever the surrounding environment says.
+	for _, k := range []string{
+		"CHANNELS_STORE", "CHANNELS_RELOAD", "LEADER_LEASE_PATH", "AUTODISCOVER",
+		"DEADLETTER_TOPIC", "DEADLETTER_PATH", "RAW_ARCHIVE_TOPIC", "RAW_ARCHIVE_DIR",
+		"KAFKA_WHISPER_TOPIC", "HTTP_API_AUTH_FILE", "HTTP_API_TLS_CERT", "HTTP_API_TLS_KEY",
+		"IRC_PING_INTERVAL", "IRC_PONG_TIMEOUT", "TWITCH_CLIENT_ID", "EVENTSUB_WS_URL", "HELIX_URL",
+	} {
+		env[k] = ""
+	}
+	for k, v := range env {
+		t.Setenv(k, v)
+	}
+	return port
+}
+
+// TestCollector_EndToEnd runs the whole collector against the fake IRC
+// server: desired channels are joined, chat reaches the writer, a refused
+// join fails the API call, /say is confirmed, and a RECONNECT leads to a
+// rejoin.
+func TestCollector_EndToEnd(t *testing.T) {
+	if testing.Short() {
+		t.Skip("end-to-end test")
+	}
+	irc := fakeirc.New(fakeirc.Config{
+		Token:   "secret",
+		Latency: 10 * time.Millisecond,
+		Refuse:  map[string]string{"gone": "msg_channel_suspended"},
+	})
+	if err := irc.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer irc.Close()
+
+	port := collectorEnv(t, irc)
+
+	w := &memWriter{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- Run(ctx, w) }()
+
+	joined := func() bool { return slices.Contains(irc.Members("#chess"), "collector") }
+	eventually(t, "desired channel joined", joined)
+
+	irc.Say(fakeirc.Chat{Channel: "#chess", Login: "viewer", Text: "hello from the fake"})
+	eventually(t, "chat message written", func() bool {
+		_, ok := w.find("privmsg", "hello from the fake")
+		return ok
+	})
+
+	api := "http://127.0.0.1:" + port
+	resp, err := http.Post(api+"/join?channel=gone&wait=10s", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var joinRes struct {
+		Phase  string `json:"phase"`
+		Reason string `json:"reason"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&joinRes)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway || joinRes.Reason != "msg_channel_suspended" {
+		t.Fatalf("join refused channel: %d %+v", resp.StatusCode, joinRes)
+	}
+
+	resp, err = http.Post(api+"/say", "application/json", strings.NewReader(`{"channel":"chess","text":"hi chat"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("say: %d", resp.StatusCode)
+	}
+	if !slices.Contains(irc.Received(), "PRIVMSG #chess :hi chat") {
+		t.Fatalf("fake never saw the /say message: %q", irc.Received())
+	}
+
+	irc.Reconnect()
+	eventually(t, "rejoin after RECONNECT", func() bool {
+		n := 0
+		for _, l := range irc.Received() {
+			if strings.HasPrefix(l, "JOIN ") && strings.Contains(l, "#chess") {
+				n++
+			}
+		}
+		return n >= 2 && joined()
+	})
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run: %v", err)
+		}
+	case <-time.After(15 * time.Second):
+		t.Fatal("collector did not shut down")
+	}
+}
@@ -0,0 +1,88 @@
+package collector
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/observe"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/rawarchive"
+)
+
+// StartReader forwards lines from conn to readCh and answers server PINGs.
+// With deadAfter > 0 a read that sees no traffic for that long fails, which
+// is how a half-open connection is noticed; the session's client PINGs keep
+// a healthy but quiet connection inside the window. Every line, PINGs
+// included, is also recorded in archive under connID; archive may be nil.
+func StartReader(ctx context.Context, conn *websocket.Conn, writerCh chan<- string, readCh chan<- string, deadAfter time.Duration, archive *rawarchive.Archive, connID string) error {
+	lg := observe.C("reader")
+
+	// Ensure ReadMessage unblocks when ctx is cancelled.
+	go func() {
+		<-ctx.Done()
+		_ = conn.Close()
+	}()
+
+	for {
+		if deadAfter > 0 {
+			_ = conn.SetReadDeadline(time.Now().Add(deadAfter))
+		}
+		_, payload, err := conn.ReadMessage()
+		received := time.Now()
+		if err != nil {
+			if ctx.Err() != nil {
+				lg.Info("reader stopping", "reason", "context_canceled")
+				return ctx.Err()
+			}
+			lg.Warn("socket read failed", "err", err)
+			return err
+		}
+
+		for _, line := range strings.Split(string(payload), "\r\n") {
+			if line == "" {
+				continue
+			}
+			archive.Record(connID, line, received)
+			if pong, ok := pongFor(line); ok {
+				select {
+				case writerCh <- pong:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+				continue
+			}
+			if isPong(line) {
+				// reply to our own keepalive; the read itself was the point
+				continue
+			}
+			select {
+			case readCh <- line:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// pongFor answers a server PING, echoing its argument.
+func pongFor(line string) (string, bool) {
+	if line != "PING" && !strings.HasPrefix(line, "PING ") {
+		return "", false
+	}
+	arg := strings.TrimPrefix(line, "PING")
+	if arg == "" {
+		arg = " :tmi.twitch.tv"
+	}
+	return "PONG" + arg + "\r\n", true
+}
+
+func isPong(line string) bool {
+	if strings.HasPrefix(line, ":") {
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			line = line[i+1:]
+		}
+	}
+	return line == "PONG" || strings.HasPrefix(line, "PONG ")
+}
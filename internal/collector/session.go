@@ -0,0 +1,206 @@
+package collector
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/healthcheck"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/metrics"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/observe"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/rawarchive"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/types"
+)
+
+var (
+	reconnects = metrics.NewCounter("irc_reconnects_total",
+		"IRC connections replaced after a failure.")
+	connected = metrics.NewGauge("irc_connected",
+		"1 while the IRC connection is up.")
+)
+
+// errDead is returned for a connection that went quiet past the liveness
+// window.
+var errDead = errors.New("no traffic from server within the liveness window")
+
+// SessionConfig controls keepalive and reconnect behaviour.
+type SessionConfig struct {
+	// PingInterval is how often the client PINGs the server; 0 disables
+	// client PINGs and read deadlines.
+	PingInterval time.Duration
+	// PongTimeout is how long past a PING the server may stay silent
+	// before the connection is declared dead.
+	PongTimeout time.Duration
+	BackoffMin  time.Duration
+	BackoffMax  time.Duration
+	// Archive, when set, receives every raw line read.
+	Archive *rawarchive.Archive
+	// OnReset, when set, is called each time the connection is lost,
+	// before RESET goes out; lines queued for the old socket are void.
+	OnReset func()
+}
+
+func DefaultSessionConfig() SessionConfig {
+	return SessionConfig{
+		PingInterval: 60 * time.Second,
+		PongTimeout:  15 * time.Second,
+		BackoffMin:   time.Second,
+		BackoffMax:   60 * time.Second,
+	}
+}
+
+// Session owns the IRC connection: it runs the reader and writer on it,
+// keeps it alive with client PINGs, and redials when it dies.
+type Session struct {
+	dial func(ctx context.Context) (*websocket.Conn, error)
+	cfg  SessionConfig
+	lg   *slog.Logger
+
+	mu      sync.Mutex
+	up      bool
+	since   time.Time
+	lastErr error
+}
+
+func NewSession(dial func(ctx context.Context) (*websocket.Conn, error), cfg SessionConfig) *Session {
+	return &Session{dial: dial, cfg: cfg, lg: observe.C("session")}
+}
+
+// Run serves conn until it fails, then redials with backoff until ctx is
+// done. Lines for the socket come from socketCh; PONG and PING lines go to
+// writerCh so they pass through the outbound limiter like everything else.
+// After every reconnect a RESET is sent on membershipCh because the new
+// connection has no channels joined.
+func (s *Session) Run(ctx context.Context, conn *websocket.Conn, writerCh chan<- string, socketCh <-chan string, readerCh chan<- string, membershipCh chan<- types.MembershipEvent) error {
+	backoff := s.cfg.BackoffMin
+	for {
+		s.setUp(nil)
+		err := s.serve(ctx, conn, writerCh, socketCh, readerCh)
+		if ctx.Err() != nil {
+			s.lg.Info("session stopping")
+			return ctx.Err()
+		}
+		s.setUp(err)
+		s.lg.Warn("connection lost", "err", err)
+
+		if s.cfg.OnReset != nil {
+			s.cfg.OnReset()
+		}
+		select {
+		case membershipCh <- types.MembershipEvent{Op: "RESET"}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		for {
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			conn, err = s.dial(ctx)
+			if err == nil {
+				break
+			}
+			s.setUp(err)
+			backoff = min(backoff*2, s.cfg.BackoffMax)
+			s.lg.Warn("reconnect failed", "err", err, "next_try_in_s", backoff.Seconds())
+		}
+		reconnects.Inc()
+		backoff = s.cfg.BackoffMin
+		s.lg.Info("reconnected")
+	}
+}
+
+// serve runs one connection until its reader, writer or pinger fails.
+func (s *Session) serve(ctx context.Context, conn *websocket.Conn, writerCh chan<- string, socketCh <-chan string, readerCh chan<- string) error {
+	defer func() { _ = conn.Close() }()
+
+	var deadAfter time.Duration
+	if s.cfg.PingInterval > 0 {
+		deadAfter = s.cfg.PingInterval + s.cfg.PongTimeout
+	}
+
+	connID := newConnID()
+	s.lg.Info("serving connection", "conn_id", connID)
+
+	g, cctx := errgroup.WithContext(ctx)
+	g.Go(func() error {
+		err := StartReader(cctx, conn, writerCh, readerCh, deadAfter, s.cfg.Archive, connID)
+		var ne interface{ Timeout() bool }
+		if errors.As(err, &ne) && ne.Timeout() {
+			return errDead
+		}
+		return err
+	})
+	g.Go(func() error { return IRCWriter(cctx, conn, socketCh) })
+	if s.cfg.PingInterval > 0 {
+		g.Go(func() error { return s.pinger(cctx, writerCh) })
+	}
+	return g.Wait()
+}
+
+// newConnID names a connection in the raw archive.
+func newConnID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+func (s *Session) pinger(ctx context.Context, writerCh chan<- string) error {
+	t := time.NewTicker(s.cfg.PingInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-t.C:
+			select {
+			case writerCh <- fmt.Sprintf("PING :%d\r\n", now.Unix()):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+func (s *Session) setUp(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	up := err == nil
+	if up != s.up {
+		s.since = time.Now()
+	}
+	s.up = up
+	if err != nil {
+		s.lastErr = err
+	}
+	if up {
+		connected.Set(1)
+	} else {
+		connected.Set(0)
+	}
+}
+
+// ReadinessCheck fails while the connection is down.
+func (s *Session) ReadinessCheck() healthcheck.Check {
+	return healthcheck.Check{Name: "irc", Fn: func() (string, bool) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.up {
+			return "connected since " + s.since.Format(time.RFC3339), true
+		}
+		if s.lastErr == nil {
+			return "not connected", false
+		}
+		return "disconnected since " + s.since.Format(time.RFC3339) + ": " + s.lastErr.Error(), false
+	}}
+}
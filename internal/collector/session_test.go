@@ -0,0 +1,167 @@
+package collector
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/rawarchive"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/types"
+)
+
+func TestPongFor(t *testing.T) {
+	cases := map[string]string{
+		"PING :tmi.twitch.tv": "PONG :tmi.twitch.tv\r\n",
+		"PING :abc123":        "PONG :abc123\r\n",
+		"PING irc.example":    "PONG irc.example\r\n",
+		"PING":                "PONG :tmi.twitch.tv\r\n",
+	}
+	for in, want := range cases {
+		if got, ok := pongFor(in); !ok || got != want {
+			t.Errorf("pongFor(%q) = %q, %v; want %q", in, got, ok, want)
+		}
+	}
+	if _, ok := pongFor(":tmi.twitch.tv PONG tmi.twitch.tv :1"); ok {
+		t.Error("server PONG treated as PING")
+	}
+	if _, ok := pongFor("PINGU"); ok {
+		t.Error("PINGU treated as PING")
+	}
+}
+
+type lineSink chan rawarchive.Line
+
+func (s lineSink) Write(_ context.Context, l rawarchive.Line) error { s <- l; return nil }
+func (s lineSink) Close() error                                     { return nil }
+
+func TestStartReader_ArchivesEveryLine(t *testing.T) {
+	up := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := up.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		_ = c.WriteMessage(websocket.TextMessage, []byte("PING :abc\r\n:tmi.twitch.tv 001 me :Welcome\r\n"))
+		_, _, _ = c.ReadMessage() // until the client goes away
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, "ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := rawarchive.New(16)
+	sink := make(lineSink, 16)
+	go func() { _ = archive.Run(ctx, sink) }()
+	readCh := make(chan string, 4)
+	go func() { _ = StartReader(ctx, conn, make(chan string, 4), readCh, 0, archive, "conn1") }()
+
+	if line := <-readCh; line != ":tmi.twitch.tv 001 me :Welcome" {
+		t.Fatalf("forwarded %q", line)
+	}
+	for _, want := range []string{"PING :abc", ":tmi.twitch.tv 001 me :Welcome"} {
+		select {
+		case l := <-sink:
+			if l.Line != want || l.ConnID != "conn1" || l.Received.IsZero() {
+				t.Fatalf("archived %+v, want %q", l, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%q not archived", want)
+		}
+	}
+}
+
+func TestSession_SilentServerTriggersReconnect(t *testing.T) {
+	var conns atomic.Int32
+	got := make(chan string, 16)
+	up := websocket.Upgrader{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := up.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		if conns.Add(1) == 1 {
+			_ = c.WriteMessage(websocket.TextMessage, []byte("PING :abc\r\n"))
+		}
+		// read what the client sends but never answer its PINGs
+		for {
+			_, p, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			got <- string(p)
+		}
+	}))
+	defer srv.Close()
+
+	uri := "ws" + strings.TrimPrefix(srv.URL, "http")
+	dial := func(ctx context.Context) (*websocket.Conn, error) {
+		c, _, err := websocket.DefaultDialer.DialContext(ctx, uri, nil)
+		return c, err
+	}
+	s := NewSession(dial, SessionConfig{
+		PingInterval: 50 * time.Millisecond,
+		PongTimeout:  50 * time.Millisecond,
+		BackoffMin:   200 * time.Millisecond,
+		BackoffMax:   time.Second,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conn, err := dial(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// no limiter in between: writerCh feeds the socket directly
+	lines := make(chan string, 16)
+	membership := make(chan types.MembershipEvent, 4)
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx, conn, lines, lines, make(chan string, 16), membership) }()
+
+	if line := <-got; line != "PONG :abc\r\n" {
+		t.Fatalf("first line = %q, want the echoed PONG", line)
+	}
+	if line := <-got; !strings.HasPrefix(line, "PING :") {
+		t.Fatalf("second line = %q, want a client PING", line)
+	}
+
+	select {
+	case ev := <-membership:
+		if ev.Op != "RESET" {
+			t.Fatalf("event = %+v, want RESET", ev)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("silent connection was not declared dead")
+	}
+	if detail, ok := s.ReadinessCheck().Fn(); ok || !strings.Contains(detail, "liveness") {
+		t.Fatalf("readiness while down = %q, %v", detail, ok)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for conns.Load() < 2 || !ready(s) {
+		if time.Now().After(deadline) {
+			t.Fatal("session did not reconnect")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("Run returned %v", err)
+	}
+}
+
+func ready(s *Session) bool {
+	_, ok := s.ReadinessCheck().Fn()
+	return ok
+}
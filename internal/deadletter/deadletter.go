@@ -0,0 +1,119 @@
+// Package deadletter keeps a sampled record of the lines and events the
+// pipeline throws away, so parser gaps can be debugged against real
+// traffic.
+package deadletter
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/metrics"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/observe"
+)
+
+// Record is one dropped line or event.
+type Record struct {
+	Time   time.Time `json:"time"`
+	Stage  string    `json:"stage"` // "classifier", "producer"
+	Reason string    `json:"reason"`
+	Line   string    `json:"line"` // the raw IRC line, or the event for later stages
+}
+
+// Sink stores records; Run calls Write from a single goroutine.
+type Sink interface {
+	Write(ctx context.Context, r Record) error
+	Close() error
+}
+
+var (
+	recorded = metrics.NewCounterVec("deadletter_records_total",
+		"Dropped lines written to the dead-letter sink.", "stage")
+	suppressed = metrics.NewCounterVec("deadletter_suppressed_total",
+		"Dropped lines not written because of the rate limit or a full buffer.", "stage")
+)
+
+const bufferSize = 256
+
+// Box rate-limits drops and hands them to a sink. A nil *Box discards
+// everything, so stages can call Drop unconditionally.
+type Box struct {
+	ch  chan Record
+	now func() time.Time
+	lg  *slog.Logger
+
+	mu     sync.Mutex
+	rate   float64 // records per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// New returns a Box that records at most rate drops per second, with
+// bursts of up to burst.
+func New(rate float64, burst int) *Box {
+	if burst < 1 {
+		burst = 1
+	}
+	b := &Box{
+		ch:     make(chan Record, bufferSize),
+		now:    time.Now,
+		lg:     observe.C("deadletter"),
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+	b.last = b.now()
+	return b
+}
+
+// Drop records that stage discarded line for reason. It never blocks.
+func (b *Box) Drop(stage, reason, line string) {
+	if b == nil {
+		return
+	}
+	now := b.now()
+	if !b.take(now) {
+		suppressed.With(stage).Inc()
+		return
+	}
+	select {
+	case b.ch <- Record{Time: now.UTC(), Stage: stage, Reason: reason, Line: line}:
+	default:
+		suppressed.With(stage).Inc()
+	}
+}
+
+func (b *Box) take(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = min(b.burst, b.tokens+elapsed*b.rate)
+		b.last = now
+	}
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Run writes recorded drops to sink until ctx ends. A failed write is
+// logged and the record lost; the dead-letter path must not stop the
+// pipeline.
+func (b *Box) Run(ctx context.Context, sink Sink) error {
+	b.lg.Info("dead-letter sink starting", "rate", b.rate, "burst", b.burst)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case r := <-b.ch:
+			if err := sink.Write(ctx, r); err != nil {
+				b.lg.Warn("dead-letter write failed", "err", err, "stage", r.Stage)
+				continue
+			}
+			recorded.With(r.Stage).Inc()
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package deadletter
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBox_RateLimited(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	b := New(1, 2)
+	b.now = func() time.Time { return now }
+	b.last = now
+
+	for i := 0; i < 5; i++ {
+		b.Drop("classifier", "malformed", "x")
+	}
+	if len(b.ch) != 2 {
+		t.Fatalf("recorded %d of a burst, want 2", len(b.ch))
+	}
+	now = now.Add(time.Second)
+	b.Drop("classifier", "malformed", "y")
+	b.Drop("classifier", "malformed", "z")
+	if len(b.ch) != 3 {
+		t.Fatalf("recorded %d after refill, want 3", len(b.ch))
+	}
+
+	var nilBox *Box
+	nilBox.Drop("classifier", "malformed", "ignored") // must not panic
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead.jsonl")
+	sink, err := NewFileSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := New(100, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		_ = b.Run(ctx, sink)
+		close(done)
+	}()
+	b.Drop("classifier", "missing command", "@a=b :src")
+	b.Drop("producer", "marshal error", "{}")
+
+	deadline := time.Now().Add(2 * time.Second)
+	var recs []Record
+	for len(recs) < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+		recs = readRecords(t, path)
+	}
+	cancel()
+	<-done
+	_ = sink.Close()
+
+	if len(recs) != 2 || recs[0].Stage != "classifier" || recs[0].Line != "@a=b :src" || recs[1].Reason != "marshal error" || recs[0].Time.IsZero() {
+		t.Fatalf("records = %+v", recs)
+	}
+}
+
+func readRecords(t *testing.T, path string) []Record {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var out []Record
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var r Record
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			t.Fatalf("line %q: %v", sc.Text(), err)
+		}
+		out = append(out, r)
+	}
+	return out
+}
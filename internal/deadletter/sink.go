@@ -0,0 +1,51 @@
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+// FileSink appends records to a local file as JSON lines.
+type FileSink struct {
+	f   *os.File
+	enc *json.Encoder
+}
+
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("deadletter: %w", err)
+	}
+	return &FileSink{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (s *FileSink) Write(_ context.Context, r Record) error {
+	return s.enc.Encode(r)
+}
+
+func (s *FileSink) Close() error { return s.f.Close() }
+
+// MessageWriter is the part of a kafka-go Writer KafkaSink uses.
+type MessageWriter interface {
+	WriteMessages(ctx context.Context, msgs ...kafkago.Message) error
+	Close() error
+}
+
+// KafkaSink produces records to a topic, keyed by stage.
+type KafkaSink struct {
+	W MessageWriter
+}
+
+func (s KafkaSink) Write(ctx context.Context, r Record) error {
+	value, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return s.W.WriteMessages(ctx, kafkago.Message{Key: []byte(r.Stage), Value: value})
+}
+
+func (s KafkaSink) Close() error { return s.W.Close() }
@@ -0,0 +1,95 @@
+package dedup
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Cache remembers recently seen message ids, bounded both by count (oldest
+// first out) and by age. An id seen again within the window is a
+// duplicate; after that it is treated as new. A zero window bounds by count
+// only.
+type Cache struct {
+	capacity int
+	window   time.Duration
+
+	mu    sync.Mutex
+	order *list.List // of *entry, newest at front
+	byID  map[string]*list.Element
+	stats Stats
+}
+
+type entry struct {
+	id string
+	at time.Time
+}
+
+// Stats are cumulative counters since the cache was created.
+type Stats struct {
+	Seen       uint64 // ids offered to Duplicate
+	Duplicates uint64 // of which were dropped as duplicates
+	Evicted    uint64 // ids forgotten early because the cache was full
+	Size       int
+}
+
+func New(capacity int, window time.Duration) *Cache {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &Cache{
+		capacity: capacity,
+		window:   window,
+		order:    list.New(),
+		byID:     make(map[string]*list.Element, capacity),
+	}
+}
+
+// Duplicate records id as seen at now and reports whether it had already
+// been seen within the window.
+func (c *Cache) Duplicate(id string, now time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.stats.Seen++
+	c.expire(now)
+	if _, ok := c.byID[id]; ok {
+		// expire already dropped anything outside the window
+		c.stats.Duplicates++
+		return true
+	}
+
+	c.byID[id] = c.order.PushFront(&entry{id: id, at: now})
+	for c.order.Len() > c.capacity {
+		c.remove(c.order.Back())
+		c.stats.Evicted++
+	}
+	return false
+}
+
+// expire drops entries older than the window from the back of the list.
+func (c *Cache) expire(now time.Time) {
+	if c.window <= 0 {
+		return
+	}
+	cutoff := now.Add(-c.window)
+	for el := c.order.Back(); el != nil; el = c.order.Back() {
+		if el.Value.(*entry).at.After(cutoff) {
+			return
+		}
+		c.remove(el)
+	}
+}
+
+func (c *Cache) remove(el *list.Element) {
+	delete(c.byID, el.Value.(*entry).id)
+	c.order.Remove(el)
+}
+
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stats
+	s.Size = c.order.Len()
+	return s
+}
@@ -0,0 +1,36 @@
+package dedup
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCache_WindowAndCapacity(t *testing.T) {
+	start := time.Unix(1_700_000_000, 0)
+	c := New(2, time.Minute)
+
+	if c.Duplicate("a", start) {
+		t.Fatal("first a reported duplicate")
+	}
+	if !c.Duplicate("a", start.Add(time.Second)) {
+		t.Fatal("second a within window not a duplicate")
+	}
+
+	// Outside the window the id is new again.
+	if c.Duplicate("a", start.Add(2*time.Minute)) {
+		t.Fatal("a after window reported duplicate")
+	}
+
+	// Capacity 2: adding b and c evicts a.
+	now := start.Add(2 * time.Minute)
+	c.Duplicate("b", now)
+	c.Duplicate("c", now)
+	if c.Duplicate("a", now) {
+		t.Fatal("evicted a reported duplicate")
+	}
+
+	st := c.Stats()
+	if st.Seen != 6 || st.Duplicates != 1 || st.Evicted != 2 || st.Size != 2 {
+		t.Fatalf("stats = %+v", st)
+	}
+}
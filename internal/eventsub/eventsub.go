@@ -0,0 +1,333 @@
+// Package eventsub watches Twitch EventSub over a WebSocket for what IRC
+// cannot report. IRC only shows a raid in the channel being raided, so
+// raids out of tracked channels come from channel.raid subscriptions here.
+package eventsub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	channelrecord "github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/channel_record"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/observe"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/types"
+)
+
+const (
+	DefaultWSURL    = "wss://eventsub.wss.twitch.tv/ws"
+	DefaultHelixURL = "https://api.twitch.tv/helix"
+)
+
+type Config struct {
+	ClientID string
+	// Token returns the user access token for ClientID; it is called for
+	// every Helix request so a refreshed token is picked up.
+	Token    func() string
+	WSURL    string
+	HelixURL string
+	// Resync is how often the watched broadcasters are compared with the
+	// desired set.
+	Resync     time.Duration
+	BackoffMin time.Duration
+	BackoffMax time.Duration
+}
+
+func NewDefaultConfig(clientID string, token func() string) Config {
+	return Config{
+		ClientID:   clientID,
+		Token:      token,
+		WSURL:      DefaultWSURL,
+		HelixURL:   DefaultHelixURL,
+		Resync:     30 * time.Second,
+		BackoffMin: time.Second,
+		BackoffMax: time.Minute,
+	}
+}
+
+// RaidWatcher subscribes to channel.raid for every channel an operator
+// added to the desired set and reports each raid out of one as a
+// types.RaidEvent. Auto-discovered channels are not watched: a WebSocket
+// session may only hold a few unauthorized subscriptions, so the budget
+// goes to the operator's channels, highest priority first.
+type RaidWatcher struct {
+	cfg     Config
+	catalog channelrecord.DesiredCatalog
+	helix   *helix
+	ids     map[string]string // login -> broadcaster id, kept across sessions
+	lg      *slog.Logger
+}
+
+func NewRaidWatcher(cfg Config, catalog channelrecord.DesiredCatalog) *RaidWatcher {
+	return &RaidWatcher{
+		cfg:     cfg,
+		catalog: catalog,
+		helix:   &helix{base: strings.TrimRight(cfg.HelixURL, "/"), clientID: cfg.ClientID, token: cfg.Token, hc: &http.Client{Timeout: 10 * time.Second}},
+		ids:     make(map[string]string),
+		lg:      observe.C("eventsub"),
+	}
+}
+
+// Run keeps an EventSub session open until ctx is done, redialing with
+// backoff. Subscriptions belong to a session, so each new session
+// subscribes again.
+func (w *RaidWatcher) Run(ctx context.Context, raids chan<- types.RaidEvent) error {
+	w.lg.Info("eventsub starting", "url", w.cfg.WSURL)
+	backoff := w.cfg.BackoffMin
+	for {
+		err := w.session(ctx, raids)
+		if ctx.Err() != nil {
+			w.lg.Info("eventsub stopping")
+			return ctx.Err()
+		}
+		w.lg.Warn("eventsub session ended", "err", err, "next_try_in_s", backoff.Seconds())
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff = min(backoff*2, w.cfg.BackoffMax)
+	}
+}
+
+// message is an EventSub WebSocket frame.
+type message struct {
+	Metadata struct {
+		MessageType      string `json:"message_type"`
+		SubscriptionType string `json:"subscription_type"`
+	} `json:"metadata"`
+	Payload struct {
+		Session *struct {
+			ID                      string `json:"id"`
+			KeepaliveTimeoutSeconds int    `json:"keepalive_timeout_seconds"`
+			ReconnectURL            string `json:"reconnect_url"`
+		} `json:"session"`
+		Subscription *struct {
+			ID     string `json:"id"`
+			Status string `json:"status"`
+		} `json:"subscription"`
+		Event json.RawMessage `json:"event"`
+	} `json:"payload"`
+}
+
+type raidEvent struct {
+	FromLogin string `json:"from_broadcaster_user_login"`
+	ToLogin   string `json:"to_broadcaster_user_login"`
+	Viewers   int    `json:"viewers"`
+}
+
+type frame struct {
+	conn *websocket.Conn
+	msg  message
+	err  error
+}
+
+// welcomeTimeout bounds the wait for session_welcome on a new connection.
+const welcomeTimeout = 10 * time.Second
+
+func (w *RaidWatcher) session(ctx context.Context, raids chan<- types.RaidEvent) error {
+	frames := make(chan frame)
+	done := make(chan struct{})
+	defer close(done)
+	conn, sessionID, err := w.open(ctx, w.cfg.WSURL, frames, done)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = conn.Close() }()
+	w.lg.Info("eventsub session open", "session_id", sessionID)
+
+	subs := &watched{ids: make(map[string]string)}
+	if err := w.resync(ctx, sessionID, subs); err != nil {
+		return err
+	}
+	tick := time.NewTicker(w.cfg.Resync)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case <-tick.C:
+			if err := w.resync(ctx, sessionID, subs); err != nil {
+				return err
+			}
+
+		case f := <-frames:
+			if f.conn != conn {
+				continue // the connection we left after a reconnect
+			}
+			if f.err != nil {
+				return f.err
+			}
+			switch f.msg.Metadata.MessageType {
+			case "session_keepalive":
+			case "notification":
+				if f.msg.Metadata.SubscriptionType != "channel.raid" {
+					continue
+				}
+				var ev raidEvent
+				if err := json.Unmarshal(f.msg.Payload.Event, &ev); err != nil {
+					w.lg.Warn("bad channel.raid event", "err", err)
+					continue
+				}
+				evt := types.RaidEvent{Kind: "raid", From: "#" + ev.FromLogin, To: "#" + ev.ToLogin, Viewers: ev.Viewers}
+				w.lg.Info("raid", "from", evt.From, "to", evt.To, "viewers", evt.Viewers)
+				select {
+				case raids <- evt:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			case "session_reconnect":
+				// Subscriptions move to the new connection; the old one is
+				// closed once the new one is welcomed.
+				s := f.msg.Payload.Session
+				if s == nil || s.ReconnectURL == "" {
+					return errors.New("session_reconnect without reconnect_url")
+				}
+				next, _, err := w.open(ctx, s.ReconnectURL, frames, done)
+				if err != nil {
+					return fmt.Errorf("reconnect: %w", err)
+				}
+				_ = conn.Close()
+				conn = next
+				w.lg.Info("eventsub session moved", "session_id", sessionID)
+			case "revocation":
+				if s := f.msg.Payload.Subscription; s != nil {
+					for login, id := range subs.ids {
+						if id == s.ID {
+							delete(subs.ids, login)
+							w.lg.Warn("raid subscription revoked", "channel", "#"+login, "status", s.Status)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// open dials url, waits for session_welcome and starts a reader that
+// forwards every later frame to frames until done is closed.
+func (w *RaidWatcher) open(ctx context.Context, url string, frames chan<- frame, done <-chan struct{}) (*websocket.Conn, string, error) {
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, url, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("dial %s: %w", url, err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(welcomeTimeout))
+	var welcome message
+	if err := conn.ReadJSON(&welcome); err != nil {
+		_ = conn.Close()
+		return nil, "", fmt.Errorf("read welcome: %w", err)
+	}
+	if welcome.Metadata.MessageType != "session_welcome" || welcome.Payload.Session == nil {
+		_ = conn.Close()
+		return nil, "", fmt.Errorf("expected session_welcome, got %q", welcome.Metadata.MessageType)
+	}
+	s := welcome.Payload.Session
+	// Twitch sends a keepalive when a session is otherwise quiet for this
+	// long; allow some slack before calling it dead.
+	keepalive := time.Duration(s.KeepaliveTimeoutSeconds)*time.Second + 5*time.Second
+
+	go func() {
+		for {
+			_ = conn.SetReadDeadline(time.Now().Add(keepalive))
+			var m message
+			err := conn.ReadJSON(&m)
+			select {
+			case frames <- frame{conn: conn, msg: m, err: err}:
+			case <-done:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return conn, s.ID, nil
+}
+
+// watched is one session's subscriptions.
+type watched struct {
+	ids    map[string]string // login -> subscription id
+	capped bool              // the cost limit was hit and reported
+}
+
+// resync subscribes to raids out of every operator-added channel not yet
+// watched and drops subscriptions for channels no longer desired.
+func (w *RaidWatcher) resync(ctx context.Context, sessionID string, subs *watched) error {
+	_, entries, _, _ := w.catalog.Entries()
+	var want []types.ChannelEntry
+	for _, e := range entries {
+		if !e.HasTag(channelrecord.AutoDiscoveredTag) {
+			want = append(want, e)
+		}
+	}
+	sort.SliceStable(want, func(i, j int) bool { return want[i].Priority > want[j].Priority })
+
+	wanted := make(map[string]bool, len(want))
+	var missing []string
+	for _, e := range want {
+		login := strings.TrimPrefix(e.Name, "#")
+		wanted[login] = true
+		if _, ok := subs.ids[login]; !ok {
+			missing = append(missing, login)
+		}
+	}
+	for login, id := range subs.ids {
+		if wanted[login] {
+			continue
+		}
+		if err := w.helix.unsubscribe(ctx, id); err != nil {
+			w.lg.Warn("drop raid subscription failed", "channel", "#"+login, "err", err)
+			continue
+		}
+		delete(subs.ids, login)
+		subs.capped = false
+	}
+	if len(missing) == 0 || subs.capped {
+		return nil
+	}
+
+	var unknown []string
+	for _, login := range missing {
+		if _, ok := w.ids[login]; !ok {
+			unknown = append(unknown, login)
+		}
+	}
+	if len(unknown) > 0 {
+		found, err := w.helix.userIDs(ctx, unknown)
+		if err != nil {
+			return fmt.Errorf("look up broadcasters: %w", err)
+		}
+		for login, id := range found {
+			w.ids[login] = id
+		}
+	}
+
+	for i, login := range missing {
+		id, ok := w.ids[login]
+		if !ok {
+			continue // no such user (renamed or banned)
+		}
+		subID, err := w.helix.subscribeRaids(ctx, sessionID, id)
+		if errors.Is(err, errBudget) {
+			subs.capped = true
+			w.lg.Warn("eventsub subscription budget spent; raids out of these channels are not followed",
+				"channels", len(missing)-i, "first", "#"+login)
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("subscribe to raids from #%s: %w", login, err)
+		}
+		subs.ids[login] = subID
+		w.lg.Info("watching raids", "channel", "#"+login)
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package eventsub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	channelrecord "github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/channel_record"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/types"
+)
+
+// fakeTwitch serves an EventSub WebSocket at /ws and the Helix endpoints
+// the watcher uses under /helix.
+type fakeTwitch struct {
+	srv   *httptest.Server
+	users map[string]string // login -> id
+	limit int               // subscriptions allowed per session
+
+	mu    sync.Mutex
+	subs  []string // broadcaster ids subscribed, in order
+	conns chan *websocket.Conn
+}
+
+func newFakeTwitch(t *testing.T, users map[string]string) *fakeTwitch {
+	f := &fakeTwitch{users: users, limit: 10, conns: make(chan *websocket.Conn, 4)}
+	up := websocket.Upgrader{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		c, err := up.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		_ = c.WriteJSON(map[string]any{
+			"metadata": map[string]string{"message_type": "session_welcome"},
+			"payload":  map[string]any{"session": map[string]any{"id": "sess-1", "keepalive_timeout_seconds": 10}},
+		})
+		f.conns <- c
+	})
+	mux.HandleFunc("GET /helix/users", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Client-Id") != "cid" || r.Header.Get("Authorization") != "Bearer tok" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var data []map[string]string
+		for _, l := range r.URL.Query()["login"] {
+			if id, ok := f.users[l]; ok {
+				data = append(data, map[string]string{"id": id, "login": l})
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": data})
+	})
+	mux.HandleFunc("POST /helix/eventsub/subscriptions", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Type      string            `json:"type"`
+			Condition map[string]string `json:"condition"`
+			Transport map[string]string `json:"transport"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		if body.Type != "channel.raid" || body.Transport["session_id"] != "sess-1" {
+			http.Error(w, "bad subscription", http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if len(f.subs) >= f.limit {
+			http.Error(w, "cost exceeded", http.StatusTooManyRequests)
+			return
+		}
+		f.subs = append(f.subs, body.Condition["from_broadcaster_user_id"])
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": []map[string]string{{"id": fmt.Sprintf("sub-%d", len(f.subs))}}})
+	})
+	f.srv = httptest.NewServer(mux)
+	t.Cleanup(f.srv.Close)
+	return f
+}
+
+func (f *fakeTwitch) config() Config {
+	cfg := NewDefaultConfig("cid", func() string { return "tok" })
+	cfg.WSURL = "ws" + strings.TrimPrefix(f.srv.URL, "http") + "/ws"
+	cfg.HelixURL = f.srv.URL + "/helix"
+	cfg.Resync = 20 * time.Millisecond
+	cfg.BackoffMin = 10 * time.Millisecond
+	return cfg
+}
+
+func (f *fakeTwitch) subscribed() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.subs)
+}
+
+func (f *fakeTwitch) conn(t *testing.T) *websocket.Conn {
+	t.Helper()
+	select {
+	case c := <-f.conns:
+		t.Cleanup(func() { _ = c.Close() })
+		return c
+	case <-time.After(2 * time.Second):
+		t.Fatal("watcher never connected")
+		return nil
+	}
+}
+
+func raidNotification(from, to string, viewers int) map[string]any {
+	return map[string]any{
+		"metadata": map[string]string{"message_type": "notification", "subscription_type": "channel.raid"},
+		"payload": map[string]any{
+			"subscription": map[string]string{"id": "sub-1", "type": "channel.raid"},
+			"event": map[string]any{
+				"from_broadcaster_user_id": "1", "from_broadcaster_user_login": from,
+				"to_broadcaster_user_id": "2", "to_broadcaster_user_login": to,
+				"viewers": viewers,
+			},
+		},
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for " + what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// A raid out of a tracked channel, reported by EventSub, ends up in the
+// controller's desired set through the discovery policy.
+func TestRaidWatcher_RaidOutOfTrackedChannelIsDiscovered(t *testing.T) {
+	tw := newFakeTwitch(t, map[string]string{"chess": "1", "alice": "2"})
+
+	controlCh := make(chan types.IRCCommand)
+	ctl, err := channelrecord.NewController(filepath.Join(t.TempDir(), "channels.json"), "me", controlCh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = ctl.Run(ctx) }()
+
+	res := make(chan types.CommandResult, 1)
+	controlCh <- types.IRCCommand{Op: "JOIN", Channel: "#chess", Result: res}
+	if out := <-res; out.Err != nil {
+		t.Fatal(out.Err)
+	}
+
+	raids := make(chan types.RaidEvent)
+	go func() {
+		_ = channelrecord.RunDiscovery(ctx, ctl, raids, controlCh, channelrecord.NewDefaultDiscoveryConfig())
+	}()
+	go func() { _ = NewRaidWatcher(tw.config(), ctl).Run(ctx, raids) }()
+
+	c := tw.conn(t)
+	waitFor(t, "subscription to #chess", func() bool { return slices.Equal(tw.subscribed(), []string{"1"}) })
+	if err := c.WriteJSON(raidNotification("chess", "alice", 120)); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor(t, "#alice in the desired set", func() bool {
+		_, entries, _, _ := ctl.Entries()
+		for _, e := range entries {
+			if e.Name == "#alice" {
+				return e.HasTag(channelrecord.AutoDiscoveredTag) && e.HasTag("via:raid")
+			}
+		}
+		return false
+	})
+
+	// The discovered channel is not watched in turn.
+	time.Sleep(60 * time.Millisecond)
+	if got := tw.subscribed(); !slices.Equal(got, []string{"1"}) {
+		t.Fatalf("subscribed = %v, want only #chess", got)
+	}
+}
+
+func TestRaidWatcher_ReconnectKeepsSubscriptionsAndBudget(t *testing.T) {
+	tw := newFakeTwitch(t, map[string]string{"chess": "1", "speedrun": "3"})
+	tw.limit = 1
+	cat := &catalog{entries: []types.ChannelEntry{
+		{Name: "#chess", ChannelMeta: types.ChannelMeta{Priority: 5}},
+		{Name: "#speedrun"},
+		{Name: "#nobody"}, // no such user
+	}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	raids := make(chan types.RaidEvent, 1)
+	go func() { _ = NewRaidWatcher(tw.config(), cat).Run(ctx, raids) }()
+
+	old := tw.conn(t)
+	waitFor(t, "subscription to #chess", func() bool { return len(tw.subscribed()) == 1 })
+	if got := tw.subscribed(); got[0] != "1" {
+		t.Fatalf("subscribed = %v; the higher-priority channel should get the budget", got)
+	}
+
+	err := old.WriteJSON(map[string]any{
+		"metadata": map[string]string{"message_type": "session_reconnect"},
+		"payload": map[string]any{"session": map[string]any{
+			"id": "sess-1", "reconnect_url": tw.config().WSURL}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := tw.conn(t)
+	if err := next.WriteJSON(raidNotification("chess", "alice", 7)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case evt := <-raids:
+		want := types.RaidEvent{Kind: "raid", From: "#chess", To: "#alice", Viewers: 7}
+		if evt != want {
+			t.Fatalf("raid = %+v, want %+v", evt, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no raid after reconnect")
+	}
+	if got := tw.subscribed(); len(got) != 1 {
+		t.Fatalf("subscribed = %v; a reconnect keeps the session's subscriptions", got)
+	}
+}
+
+type catalog struct{ entries []types.ChannelEntry }
+
+func (c *catalog) Entries() (uint64, []types.ChannelEntry, time.Time, string) {
+	return 1, c.entries, time.Time{}, "me"
+}
@@ -0,0 +1,118 @@
+package eventsub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// errBudget is Helix refusing a subscription because the session's total
+// cost limit is reached.
+var errBudget = errors.New("eventsub subscription cost limit reached")
+
+// helix is the small part of the Helix API the watcher needs.
+type helix struct {
+	base     string
+	clientID string
+	token    func() string
+	hc       *http.Client
+}
+
+func (h *helix) do(ctx context.Context, method, path string, body any, out any) (int, error) {
+	var rd io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		rd = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, h.base+path, rd)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Client-Id", h.clientID)
+	req.Header.Set("Authorization", "Bearer "+h.token())
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := h.hc.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return resp.StatusCode, fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, fmt.Errorf("%s %s: decode: %w", method, path, err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// userIDs maps logins to broadcaster ids; unknown logins are left out.
+func (h *helix) userIDs(ctx context.Context, logins []string) (map[string]string, error) {
+	out := make(map[string]string, len(logins))
+	for len(logins) > 0 {
+		n := min(len(logins), 100) // Helix limit per request
+		q := url.Values{}
+		for _, l := range logins[:n] {
+			q.Add("login", l)
+		}
+		logins = logins[n:]
+
+		var res struct {
+			Data []struct {
+				ID    string `json:"id"`
+				Login string `json:"login"`
+			} `json:"data"`
+		}
+		if _, err := h.do(ctx, http.MethodGet, "/users?"+q.Encode(), nil, &res); err != nil {
+			return nil, err
+		}
+		for _, u := range res.Data {
+			out[strings.ToLower(u.Login)] = u.ID
+		}
+	}
+	return out, nil
+}
+
+// subscribeRaids subscribes the session to raids out of broadcasterID and
+// returns the subscription id.
+func (h *helix) subscribeRaids(ctx context.Context, sessionID, broadcasterID string) (string, error) {
+	body := map[string]any{
+		"type":      "channel.raid",
+		"version":   "1",
+		"condition": map[string]string{"from_broadcaster_user_id": broadcasterID},
+		"transport": map[string]string{"method": "websocket", "session_id": sessionID},
+	}
+	var res struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	status, err := h.do(ctx, http.MethodPost, "/eventsub/subscriptions", body, &res)
+	switch {
+	case status == http.StatusTooManyRequests:
+		return "", errBudget
+	case err != nil:
+		return "", err
+	case len(res.Data) == 0:
+		return "", errors.New("subscription created without an id")
+	}
+	return res.Data[0].ID, nil
+}
+
+func (h *helix) unsubscribe(ctx context.Context, id string) error {
+	_, err := h.do(ctx, http.MethodDelete, "/eventsub/subscriptions?id="+url.QueryEscape(id), nil, nil)
+	return err
+}
@@ -0,0 +1,269 @@
+package fakeirc
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/ircmsg"
+)
+
+// closeMarker, queued like a line, makes the writer close the connection
+// once everything before it has been written.
+const closeMarker = "\x00close"
+
+// frameLines caps how many queued lines go out in one websocket frame.
+const frameLines = 64
+
+type client struct {
+	s    *Server
+	conn *websocket.Conn
+	out  chan string
+
+	closeOnce sync.Once
+	done      chan struct{}
+
+	mu       sync.Mutex
+	pass     string
+	nick     string
+	channels map[string]struct{}
+}
+
+func newClient(s *Server, conn *websocket.Conn) *client {
+	return &client{
+		s:        s,
+		conn:     conn,
+		out:      make(chan string, 1024),
+		done:     make(chan struct{}),
+		channels: make(map[string]struct{}),
+	}
+}
+
+// run reads until the connection ends, then waits for the writer.
+func (c *client) run() {
+	wrote := make(chan struct{})
+	go func() {
+		defer close(wrote)
+		c.writeLoop()
+	}()
+	if c.s.cfg.PingInterval > 0 {
+		go c.pingLoop()
+	}
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if line = strings.TrimRight(line, "\r"); line != "" {
+				c.s.record(line)
+				c.handle(line)
+			}
+		}
+	}
+	c.close()
+	<-wrote
+}
+
+func (c *client) writeLoop() {
+	defer c.conn.Close()
+	var b strings.Builder
+	for {
+		var line string
+		select {
+		case line = <-c.out:
+		case <-c.done:
+			return
+		}
+		b.Reset()
+		for n := 0; ; n++ {
+			if line == closeMarker {
+				c.flush(&b)
+				c.close()
+				return
+			}
+			b.WriteString(line)
+			b.WriteString("\r\n")
+			if n == frameLines-1 {
+				break
+			}
+			select {
+			case line = <-c.out:
+				continue
+			default:
+			}
+			break
+		}
+		if !c.flush(&b) {
+			c.close()
+			return
+		}
+	}
+}
+
+func (c *client) flush(b *strings.Builder) bool {
+	if b.Len() == 0 {
+		return true
+	}
+	_ = c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	return c.conn.WriteMessage(websocket.TextMessage, []byte(b.String())) == nil
+}
+
+func (c *client) pingLoop() {
+	t := time.NewTicker(c.s.cfg.PingInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			c.send("PING :tmi.twitch.tv")
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// send queues line, blocking while the buffer is full; false once the
+// client is gone.
+func (c *client) send(line string) bool {
+	select {
+	case c.out <- line:
+		return true
+	case <-c.done:
+		return false
+	}
+}
+
+func (c *client) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		_ = c.conn.Close()
+	})
+}
+
+func (c *client) closeAfterFlush() { c.send(closeMarker) }
+
+func (c *client) member(channel string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.channels[strings.ToLower(channel)]
+	return c.nick, ok
+}
+
+func (c *client) handle(line string) {
+	m, err := ircmsg.Parse(line)
+	if err != nil {
+		return
+	}
+	switch m.Command {
+	case "PASS":
+		c.mu.Lock()
+		c.pass = strings.TrimPrefix(m.Param(0), "oauth:")
+		c.mu.Unlock()
+	case "NICK":
+		c.login(strings.ToLower(m.Param(0)))
+	case "CAP":
+		if m.Param(0) == "REQ" {
+			c.send(":tmi.twitch.tv CAP * ACK :" + m.Trailing())
+		}
+	case "PING":
+		c.send(":tmi.twitch.tv PONG tmi.twitch.tv :" + m.Trailing())
+	case "JOIN":
+		for _, ch := range strings.Split(m.Param(0), ",") {
+			c.later(func() { c.join(strings.ToLower(ch)) })
+		}
+	case "PART":
+		for _, ch := range strings.Split(m.Param(0), ",") {
+			c.later(func() { c.part(strings.ToLower(ch)) })
+		}
+	case "PRIVMSG":
+		// Twitch doesn't echo a client's own message; it confirms with
+		// USERSTATE.
+		if nick, ok := c.member(m.Param(0)); ok {
+			c.send(c.userstate("USERSTATE", nick, m.Param(0)))
+		}
+	}
+}
+
+func (c *client) later(fn func()) {
+	if c.s.cfg.Latency <= 0 {
+		fn()
+		return
+	}
+	time.AfterFunc(c.s.cfg.Latency, fn)
+}
+
+func (c *client) login(nick string) {
+	c.mu.Lock()
+	c.nick = nick
+	pass := c.pass
+	c.mu.Unlock()
+	if c.s.cfg.Token != "" && pass != c.s.cfg.Token {
+		c.send(":tmi.twitch.tv NOTICE * :Login authentication failed")
+		c.closeAfterFlush()
+		return
+	}
+	for _, l := range []string{
+		"001 " + nick + " :Welcome, GLHF!",
+		"002 " + nick + " :Your host is tmi.twitch.tv",
+		"003 " + nick + " :This server is rather new",
+		"004 " + nick + " :-",
+		"375 " + nick + " :-",
+		"372 " + nick + " :You are in a maze of twisty passages, all alike.",
+		"376 " + nick + " :>",
+	} {
+		c.send(":tmi.twitch.tv " + l)
+	}
+	c.send(c.userstate("GLOBALUSERSTATE", nick, ""))
+}
+
+func (c *client) userstate(cmd, nick, channel string) string {
+	m := ircmsg.Message{
+		Tags: ircmsg.Tags("badge-info=;badges=;color=;emote-sets=0;user-type=").
+			With("display-name", nick).
+			With("user-id", userID(nick)),
+		Source:  ircmsg.Source{Nick: "tmi.twitch.tv"},
+		Command: cmd,
+	}
+	if channel != "" {
+		m.Params = []string{channel}
+	}
+	return m.Format()
+}
+
+func (c *client) join(channel string) {
+	if msgID, ok := c.s.cfg.Refuse[strings.TrimPrefix(channel, "#")]; ok {
+		m := ircmsg.Message{
+			Tags:    ircmsg.Tags("").With("msg-id", msgID),
+			Source:  ircmsg.Source{Nick: "tmi.twitch.tv"},
+			Command: "NOTICE",
+			Params:  []string{channel, "This channel is unavailable."},
+		}
+		c.send(m.Format())
+		return
+	}
+	c.mu.Lock()
+	nick := c.nick
+	c.channels[channel] = struct{}{}
+	c.mu.Unlock()
+
+	src := ":" + nick + "!" + nick + "@" + nick + ".tmi.twitch.tv"
+	c.send(src + " JOIN " + channel)
+	c.send(":" + nick + ".tmi.twitch.tv 353 " + nick + " = " + channel + " :" + nick)
+	c.send(":" + nick + ".tmi.twitch.tv 366 " + nick + " " + channel + " :End of /NAMES list")
+	c.send(c.userstate("USERSTATE", nick, channel))
+	c.send("@emote-only=0;followers-only=-1;r9k=0;room-id=" + roomID(channel) +
+		";slow=0;subs-only=0 :tmi.twitch.tv ROOMSTATE " + channel)
+}
+
+func (c *client) part(channel string) {
+	c.mu.Lock()
+	nick := c.nick
+	_, ok := c.channels[channel]
+	delete(c.channels, channel)
+	c.mu.Unlock()
+	if ok {
+		c.send(":" + nick + "!" + nick + "@" + nick + ".tmi.twitch.tv PART " + channel)
+	}
+}
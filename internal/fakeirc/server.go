@@ -0,0 +1,262 @@
+// Package fakeirc is a local stand-in for Twitch's IRC websocket server,
+// for integration tests, demos and load generation. It speaks enough of
+// the protocol for the collector: PASS/NICK/CAP, JOIN/PART with their
+// echoes and state lines, PING/PONG, NOTICE refusals and RECONNECT, and it
+// can deliver scripted or generated chat.
+package fakeirc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/ircmsg"
+)
+
+type Config struct {
+	// Latency delays the answer to each JOIN and PART.
+	Latency time.Duration
+	// PingInterval is how often the server PINGs each client; 0 never.
+	PingInterval time.Duration
+	// Refuse maps a channel login to the NOTICE msg-id sent instead of
+	// joining it, e.g. "gone": "msg_channel_suspended".
+	Refuse map[string]string
+	// Token, when set, is the only oauth token PASS accepts.
+	Token string
+}
+
+// Server is safe for concurrent use.
+type Server struct {
+	cfg Config
+	up  websocket.Upgrader
+	srv *http.Server
+	url string
+
+	mu       sync.Mutex
+	clients  map[*client]struct{}
+	received []string // every line clients sent, in order
+
+	msgID atomic.Uint64
+}
+
+func New(cfg Config) *Server {
+	return &Server{cfg: cfg, clients: make(map[*client]struct{})}
+}
+
+// Listen serves on addr ("127.0.0.1:0" for any free port) until Close.
+func (s *Server) Listen(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("fakeirc: %w", err)
+	}
+	s.url = "ws://" + ln.Addr().String()
+	s.srv = &http.Server{Handler: s, ReadHeaderTimeout: 5 * time.Second}
+	go func() { _ = s.srv.Serve(ln) }()
+	return nil
+}
+
+// URL is the websocket address to dial once Listen has returned.
+func (s *Server) URL() string { return s.url }
+
+// Close disconnects every client and stops the listener.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	for c := range s.clients {
+		c.close()
+	}
+	s.mu.Unlock()
+	if s.srv == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.srv.Shutdown(ctx)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := s.up.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	c := newClient(s, conn)
+	s.mu.Lock()
+	s.clients[c] = struct{}{}
+	s.mu.Unlock()
+
+	c.run()
+
+	s.mu.Lock()
+	delete(s.clients, c)
+	s.mu.Unlock()
+}
+
+func (s *Server) record(line string) {
+	s.mu.Lock()
+	s.received = append(s.received, line)
+	s.mu.Unlock()
+}
+
+// Received returns every line clients have sent so far.
+func (s *Server) Received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.received...)
+}
+
+// Clients is the number of connected clients.
+func (s *Server) Clients() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.clients)
+}
+
+// Members lists the nicks currently joined to channel ("#name").
+func (s *Server) Members(channel string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []string
+	for c := range s.clients {
+		if nick, ok := c.member(channel); ok {
+			out = append(out, nick)
+		}
+	}
+	return out
+}
+
+func (s *Server) each(fn func(*client)) {
+	s.mu.Lock()
+	cs := make([]*client, 0, len(s.clients))
+	for c := range s.clients {
+		cs = append(cs, c)
+	}
+	s.mu.Unlock()
+	for _, c := range cs {
+		fn(c)
+	}
+}
+
+// Send writes a raw line to every client.
+func (s *Server) Send(line string) {
+	s.each(func(c *client) { c.send(line) })
+}
+
+// Reconnect tells every client to reconnect, as Twitch does before a
+// server restart, and then drops them.
+func (s *Server) Reconnect() {
+	s.each(func(c *client) {
+		c.send(":tmi.twitch.tv RECONNECT")
+		c.closeAfterFlush()
+	})
+}
+
+// Chat is one chat message from a (simulated) viewer.
+type Chat struct {
+	Channel string // "#name"
+	Login   string
+	Text    string
+	ID      string // the id tag; generated when empty
+	// Tags are added after the standard PRIVMSG tags, e.g. to make lines
+	// as large as real ones.
+	Tags ircmsg.Tags
+}
+
+// Say delivers c to every client joined to its channel, waiting for room
+// in their send buffers, and returns how many received it.
+func (s *Server) Say(c Chat) int {
+	line := s.privmsg(c, time.Now())
+	n := 0
+	s.each(func(cl *client) {
+		if _, ok := cl.member(c.Channel); ok && cl.send(line) {
+			n++
+		}
+	})
+	return n
+}
+
+// Broadcast is Say without the membership check: c reaches every client,
+// joined or not. Load tests use it to skip JOIN rate limits.
+func (s *Server) Broadcast(c Chat) int {
+	line := s.privmsg(c, time.Now())
+	n := 0
+	s.each(func(cl *client) {
+		if cl.send(line) {
+			n++
+		}
+	})
+	return n
+}
+
+func (s *Server) privmsg(c Chat, now time.Time) string {
+	login := strings.ToLower(c.Login)
+	id := c.ID
+	if id == "" {
+		n := s.msgID.Add(1)
+		id = fmt.Sprintf("%08x-0000-4000-8000-%012x", n>>48, n&(1<<48-1))
+	}
+	tags := ircmsg.Tags(fmt.Sprintf(
+		"badge-info=;badges=;color=;display-name=%s;emotes=;first-msg=0;flags=;id=%s;mod=0;room-id=%s;subscriber=0;tmi-sent-ts=%d;turbo=0;user-id=%s;user-type=",
+		ircmsg.EscapeTagValue(c.Login), ircmsg.EscapeTagValue(id), roomID(c.Channel), now.UnixMilli(), userID(login)))
+	if c.Tags != "" {
+		tags += ";" + c.Tags
+	}
+	m := ircmsg.Message{
+		Tags:    tags,
+		Source:  ircmsg.Source{Nick: login, User: login, Host: login + ".tmi.twitch.tv"},
+		Command: "PRIVMSG",
+		Params:  []string{c.Channel, c.Text},
+	}
+	return m.Format()
+}
+
+// Step is one entry of a script: after waiting After, Chat is said, or
+// Line is sent raw to every client when Chat is nil.
+type Step struct {
+	After time.Duration
+	Chat  *Chat
+	Line  string
+}
+
+// Play runs steps in order.
+func (s *Server) Play(ctx context.Context, steps []Step) error {
+	for _, st := range steps {
+		if st.After > 0 {
+			t := time.NewTimer(st.After)
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				return ctx.Err()
+			}
+		}
+		switch {
+		case st.Chat != nil:
+			s.Say(*st.Chat)
+		case st.Line != "":
+			s.Send(st.Line)
+		default:
+			return errors.New("fakeirc: step has neither Chat nor Line")
+		}
+	}
+	return nil
+}
+
+// roomID and userID derive stable numeric ids from names.
+func roomID(channel string) string {
+	return userID(strings.TrimPrefix(strings.ToLower(channel), "#"))
+}
+
+func userID(login string) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(login))
+	return strconv.FormatUint(uint64(h.Sum32()), 10)
+}
@@ -0,0 +1,203 @@
+package fakeirc
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/ircmsg"
+)
+
+type testConn struct {
+	t    *testing.T
+	ws   *websocket.Conn
+	pend []string
+}
+
+func dial(t *testing.T, s *Server, nick string) *testConn {
+	t.Helper()
+	ws, _, err := websocket.DefaultDialer.Dial(s.URL(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ws.Close() })
+	c := &testConn{t: t, ws: ws}
+	c.write("PASS oauth:secret", "NICK "+nick, "CAP REQ :twitch.tv/tags twitch.tv/commands")
+	return c
+}
+
+func (c *testConn) write(lines ...string) {
+	c.t.Helper()
+	for _, l := range lines {
+		if err := c.ws.WriteMessage(websocket.TextMessage, []byte(l+"\r\n")); err != nil {
+			c.t.Fatal(err)
+		}
+	}
+}
+
+// until reads lines up to and including the first with command cmd.
+func (c *testConn) until(cmd string) *ircmsg.Message {
+	c.t.Helper()
+	_ = c.ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		for len(c.pend) > 0 {
+			l := c.pend[0]
+			c.pend = c.pend[1:]
+			m, err := ircmsg.Parse(l)
+			if err != nil {
+				c.t.Fatalf("bad line %q: %v", l, err)
+			}
+			if m.Command == cmd {
+				return m
+			}
+		}
+		_, data, err := c.ws.ReadMessage()
+		if err != nil {
+			c.t.Fatalf("waiting for %s: %v", cmd, err)
+		}
+		for _, l := range strings.Split(string(data), "\r\n") {
+			if l != "" {
+				c.pend = append(c.pend, l)
+			}
+		}
+	}
+}
+
+func start(t *testing.T, cfg Config) *Server {
+	t.Helper()
+	s := New(cfg)
+	if err := s.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestServer_HandshakeJoinAndChat(t *testing.T) {
+	s := start(t, Config{Token: "secret"})
+	c := dial(t, s, "Bot")
+
+	c.until("376")
+	if m := c.until("GLOBALUSERSTATE"); m.Tags.Value("display-name") != "bot" {
+		t.Fatalf("GLOBALUSERSTATE = %q", m.Format())
+	}
+	if m := c.until("CAP"); m.Trailing() != "twitch.tv/tags twitch.tv/commands" {
+		t.Fatalf("CAP ack = %q", m.Format())
+	}
+
+	c.write("JOIN #chess,#go")
+	for _, ch := range []string{"#chess", "#go"} {
+		if m := c.until("JOIN"); m.Param(0) != ch || m.Source.Nick != "bot" {
+			t.Fatalf("JOIN echo = %q", m.Format())
+		}
+		c.until("366")
+		c.until("USERSTATE")
+		if m := c.until("ROOMSTATE"); m.Tags.Value("room-id") != roomID(ch) {
+			t.Fatalf("ROOMSTATE = %q", m.Format())
+		}
+	}
+	if got := s.Members("#chess"); len(got) != 1 || got[0] != "bot" {
+		t.Fatalf("members = %v", got)
+	}
+
+	if n := s.Say(Chat{Channel: "#chess", Login: "Alice", Text: "hi there", Tags: "extra=1"}); n != 1 {
+		t.Fatalf("delivered to %d", n)
+	}
+	if n := s.Say(Chat{Channel: "#nobody", Login: "alice", Text: "x"}); n != 0 {
+		t.Fatalf("delivered to %d outside the channel", n)
+	}
+	m := c.until("PRIVMSG")
+	if m.Param(0) != "#chess" || m.Trailing() != "hi there" || m.Source.Nick != "alice" ||
+		m.Tags.Value("display-name") != "Alice" || m.Tags.Value("extra") != "1" ||
+		m.Tags.Value("id") == "" || m.Tags.Value("tmi-sent-ts") == "" {
+		t.Fatalf("PRIVMSG = %q", m.Format())
+	}
+
+	if n := s.Broadcast(Chat{Channel: "#nobody", Login: "bob", Text: "load", ID: "gen-1"}); n != 1 {
+		t.Fatalf("broadcast to %d", n)
+	}
+	if m := c.until("PRIVMSG"); m.Param(0) != "#nobody" || m.Tags.Value("id") != "gen-1" {
+		t.Fatalf("broadcast PRIVMSG = %q", m.Format())
+	}
+
+	c.write("PRIVMSG #chess :hello", "PING :abc")
+	c.until("USERSTATE")
+	if m := c.until("PONG"); m.Trailing() != "abc" {
+		t.Fatalf("PONG = %q", m.Format())
+	}
+
+	c.write("PART #chess")
+	c.until("PART")
+	if got := s.Members("#chess"); len(got) != 0 {
+		t.Fatalf("members after PART = %v", got)
+	}
+	if got := s.Received(); got[0] != "PASS oauth:secret" {
+		t.Fatalf("received = %v", got)
+	}
+}
+
+func TestServer_RefusesBadToken(t *testing.T) {
+	s := start(t, Config{Token: "other"})
+	c := dial(t, s, "bot")
+	if m := c.until("NOTICE"); m.Trailing() != "Login authentication failed" {
+		t.Fatalf("NOTICE = %q", m.Format())
+	}
+}
+
+func TestServer_RefusedJoinAndLatency(t *testing.T) {
+	s := start(t, Config{Latency: 50 * time.Millisecond, Refuse: map[string]string{"gone": "msg_channel_suspended"}})
+	c := dial(t, s, "bot")
+	c.until("GLOBALUSERSTATE")
+
+	began := time.Now()
+	c.write("JOIN #gone")
+	m := c.until("NOTICE")
+	if m.Tags.Value("msg-id") != "msg_channel_suspended" || m.Param(0) != "#gone" {
+		t.Fatalf("NOTICE = %q", m.Format())
+	}
+	if d := time.Since(began); d < 50*time.Millisecond {
+		t.Fatalf("answered after %v, want at least the latency", d)
+	}
+	if got := s.Members("#gone"); len(got) != 0 {
+		t.Fatalf("members = %v", got)
+	}
+}
+
+func TestServer_PingReconnectAndScript(t *testing.T) {
+	s := start(t, Config{PingInterval: 20 * time.Millisecond})
+	c := dial(t, s, "bot")
+	c.write("JOIN #chess")
+	c.until("ROOMSTATE")
+	c.until("PING")
+
+	err := s.Play(context.Background(), []Step{
+		{Chat: &Chat{Channel: "#chess", Login: "a", Text: "one"}},
+		{After: 10 * time.Millisecond, Line: ":tmi.twitch.tv CLEARCHAT #chess"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := c.until("PRIVMSG"); m.Trailing() != "one" {
+		t.Fatalf("PRIVMSG = %q", m.Format())
+	}
+	c.until("CLEARCHAT")
+
+	s.Reconnect()
+	c.until("RECONNECT")
+	_ = c.ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		if _, _, err := c.ws.ReadMessage(); err != nil {
+			break // closed by the server
+		}
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for s.Clients() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("client still registered after RECONNECT")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -1,7 +1,9 @@
 package healthcheck
 
 import (
+	"fmt"
 	"net/http"
+	"strings"
 	"sync/atomic"
 	"time"
 
@@ -11,8 +13,16 @@ import (
 )
 
 type Probe struct {
-	ready int32 // 0 = not ready, 1 = ready
-	lg    *slog.Logger
+	ready  int32 // 0 = not ready, 1 = ready
+	checks []Check
+	lg     *slog.Logger
+}
+
+// Check adds a line to /readyz. Fn returns a short description and whether
+// the component is ready; any failing check makes the probe not ready.
+type Check struct {
+	Name string
+	Fn   func() (detail string, ok bool)
 }
 
 func New(component string) *Probe {
@@ -27,15 +37,27 @@ func (p *Probe) Register(mux *http.ServeMux) {
 		_, _ = w.Write([]byte("ok"))
 	})
 	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
-		if atomic.LoadInt32(&p.ready) == 1 {
+		ready := atomic.LoadInt32(&p.ready) == 1
+		var details strings.Builder
+		for _, c := range p.checks {
+			detail, ok := c.Fn()
+			ready = ready && ok
+			fmt.Fprintf(&details, "\n%s: %s", c.Name, detail)
+		}
+		if ready {
 			w.WriteHeader(http.StatusOK)
-			_, _ = w.Write([]byte("ready"))
+			_, _ = w.Write([]byte("ready" + details.String()))
 			return
 		}
-		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		http.Error(w, "not ready"+details.String(), http.StatusServiceUnavailable)
 	})
 }
 
+// AddCheck must be called before Register's handlers serve traffic.
+func (p *Probe) AddCheck(c Check) {
+	p.checks = append(p.checks, c)
+}
+
 func (p *Probe) SetReady() {
 	prev := atomic.SwapInt32(&p.ready, 1)
 	if prev != 1 {
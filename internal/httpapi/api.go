@@ -1,6 +1,7 @@
 package httpapi
 
 import (
+	"context"
 	"log/slog"
 	"time"
 
@@ -11,8 +12,53 @@ type ChannelSnapshotReader interface {
 	Snapshot() (version uint64, channels []string, updatedAt time.Time, account string)
 }
 
+type ChannelEntriesReader interface {
+	Entries() (version uint64, entries []types.ChannelEntry, updatedAt time.Time, account string)
+}
+
+type ChannelStatusReader interface {
+	Seq() uint64
+	Await(ctx context.Context, channel string, done func(types.ChannelStatus) bool) (types.ChannelStatus, error)
+}
+
+// ChannelStatusGetter reports one channel's current phase; /say uses it to
+// refuse channels the collector has not joined.
+type ChannelStatusGetter interface {
+	Get(channel string) types.ChannelStatus
+}
+
+// ChannelStatusLister reports every channel the rectifier tracks.
+type ChannelStatusLister interface {
+	List() []types.ChannelStatus
+}
+
+type ChannelHistoryReader interface {
+	History(channel string, limit int) ([]types.AuditEntry, error)
+}
+
+// Clock is the time schedule windows are judged by; the controller's, so
+// the API and the rectifier agree.
+type Clock interface {
+	Now() time.Time
+}
+
 type APIController struct {
 	ControlCh      chan types.IRCCommand
 	SnapshotReader ChannelSnapshotReader
-	lg             *slog.Logger
+	Status         ChannelStatusReader
+	History        ChannelHistoryReader
+	EntriesReader  ChannelEntriesReader
+	Clock          Clock // time.Now when nil
+	// SayCh carries PRIVMSG commands to the scheduler; nil disables /say.
+	SayCh chan<- types.IRCCommand
+	// ClearCh reaches the rectifier; nil disables /channels/clear.
+	ClearCh chan<- types.MembershipEvent
+	lg      *slog.Logger
+}
+
+func (api *APIController) now() time.Time {
+	if api.Clock != nil {
+		return api.Clock.Now()
+	}
+	return time.Now()
 }
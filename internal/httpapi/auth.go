@@ -0,0 +1,273 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/observe"
+)
+
+type Role int
+
+const (
+	RoleNone Role = iota
+	RoleReader
+	RoleOperator
+	RoleAdmin
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleReader:
+		return "reader"
+	case RoleOperator:
+		return "operator"
+	case RoleAdmin:
+		return "admin"
+	default:
+		return "none"
+	}
+}
+
+func parseRole(s string) (Role, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "reader", "read-only", "readonly":
+		return RoleReader, nil
+	case "operator":
+		return RoleOperator, nil
+	case "admin":
+		return RoleAdmin, nil
+	default:
+		return RoleNone, fmt.Errorf("unknown role %q", s)
+	}
+}
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	Name   string
+	Role   Role
+	Method string // "bearer", "mtls" or "anonymous" when auth is disabled
+}
+
+// authFile is the on-disk format of HTTP_API_AUTH_FILE. Each entry grants a
+// role to either a bearer token or a client certificate common name.
+type authFile struct {
+	Principals []struct {
+		Name   string `json:"name"`
+		Role   string `json:"role"`
+		Token  string `json:"token,omitempty"`
+		CertCN string `json:"cert_cn,omitempty"`
+	} `json:"principals"`
+}
+
+// Authenticator resolves requests to principals from a token file that is
+// re-read whenever it changes on disk.
+type Authenticator struct {
+	path string
+	lg   *slog.Logger
+
+	mu      sync.RWMutex
+	byToken map[[sha256.Size]byte]Principal
+	byCN    map[string]Principal
+	modTime time.Time
+}
+
+func LoadAuthenticator(path string) (*Authenticator, error) {
+	a := &Authenticator{
+		path: path,
+		lg:   observe.C("http_auth").With("path", path),
+	}
+	if err := a.reload(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *Authenticator) reload() error {
+	fi, err := os.Stat(a.path)
+	if err != nil {
+		return fmt.Errorf("stat auth file %q: %w", a.path, err)
+	}
+	b, err := os.ReadFile(a.path)
+	if err != nil {
+		return fmt.Errorf("read auth file %q: %w", a.path, err)
+	}
+	var f authFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return fmt.Errorf("decode auth file %q: %w", a.path, err)
+	}
+
+	byToken := make(map[[sha256.Size]byte]Principal)
+	byCN := make(map[string]Principal)
+	for i, e := range f.Principals {
+		role, err := parseRole(e.Role)
+		if err != nil {
+			return fmt.Errorf("auth file %q entry %d: %w", a.path, i, err)
+		}
+		if e.Name == "" {
+			return fmt.Errorf("auth file %q entry %d: missing name", a.path, i)
+		}
+		switch {
+		case e.Token != "":
+			byToken[sha256.Sum256([]byte(e.Token))] = Principal{Name: e.Name, Role: role, Method: "bearer"}
+		case e.CertCN != "":
+			byCN[e.CertCN] = Principal{Name: e.Name, Role: role, Method: "mtls"}
+		default:
+			return fmt.Errorf("auth file %q entry %d: needs token or cert_cn", a.path, i)
+		}
+	}
+
+	a.mu.Lock()
+	a.byToken = byToken
+	a.byCN = byCN
+	a.modTime = fi.ModTime()
+	a.mu.Unlock()
+
+	a.lg.Info("auth file loaded", "tokens", len(byToken), "cert_principals", len(byCN))
+	return nil
+}
+
+// Watch polls the auth file and reloads it when its mtime changes. A file
+// that fails to parse keeps the previous principals in place.
+func (a *Authenticator) Watch(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			fi, err := os.Stat(a.path)
+			if err != nil {
+				a.lg.Warn("auth file stat failed; keeping current principals", "err", err)
+				continue
+			}
+			a.mu.RLock()
+			same := fi.ModTime().Equal(a.modTime)
+			a.mu.RUnlock()
+			if same {
+				continue
+			}
+			if err := a.reload(); err != nil {
+				a.lg.Error("auth file reload failed; keeping current principals", "err", err)
+			}
+		}
+	}
+}
+
+func (a *Authenticator) authenticate(r *http.Request) (Principal, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if h := r.Header.Get("Authorization"); h != "" {
+		tok, ok := strings.CutPrefix(h, "Bearer ")
+		if !ok {
+			return Principal{}, false
+		}
+		p, ok := a.byToken[sha256.Sum256([]byte(strings.TrimSpace(tok)))]
+		return p, ok
+	}
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		p, ok := a.byCN[r.TLS.VerifiedChains[0][0].Subject.CommonName]
+		return p, ok
+	}
+	return Principal{}, false
+}
+
+type principalKey struct{}
+
+// PrincipalFrom returns the principal attached by Require, if any.
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// Require wraps next so it only runs for principals holding at least min.
+// Mutating endpoints additionally get an audit log entry. With a nil
+// Authenticator every caller is an anonymous admin, but audit still applies.
+func (a *Authenticator) Require(min Role, mutating bool, next http.HandlerFunc) http.HandlerFunc {
+	audit := observe.C("audit")
+	return func(w http.ResponseWriter, r *http.Request) {
+		var p Principal
+		if a == nil {
+			p = Principal{Name: "anonymous", Role: RoleAdmin, Method: "anonymous"}
+		} else {
+			var ok bool
+			p, ok = a.authenticate(r)
+			if !ok {
+				a.lg.Warn("unauthenticated request", "path", r.URL.Path, "remote", r.RemoteAddr)
+				w.Header().Set("WWW-Authenticate", `Bearer realm="irc_collector"`)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if p.Role < min {
+				a.lg.Warn("forbidden request",
+					"principal", p.Name, "role", p.Role.String(), "required", min.String(),
+					"path", r.URL.Path, "remote", r.RemoteAddr)
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+		}
+
+		r = r.WithContext(context.WithValue(r.Context(), principalKey{}, p))
+		if !mutating {
+			next(w, r)
+			return
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r)
+		audit.Info("control call",
+			"principal", p.Name,
+			"role", p.Role.String(),
+			"auth", p.Method,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"query", r.URL.RawQuery,
+			"status", rec.status,
+			"remote", r.RemoteAddr,
+		)
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	s.status = code
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter { return s.ResponseWriter }
+
+// serverTLSConfig builds a TLS config that verifies client certificates
+// against clientCAPath when one is given.
+func serverTLSConfig(clientCAPath string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if clientCAPath == "" {
+		return cfg, nil
+	}
+	pem, err := os.ReadFile(clientCAPath)
+	if err != nil {
+		return nil, fmt.Errorf("read client CA %q: %w", clientCAPath, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("client CA %q: no certificates found", clientCAPath)
+	}
+	cfg.ClientCAs = pool
+	cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	return cfg, nil
+}
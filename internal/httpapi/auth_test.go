@@ -0,0 +1,81 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeAuthFile(t *testing.T, path, body string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRequireRoles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth.json")
+	writeAuthFile(t, path, `{"principals":[
+		{"name":"dash","role":"reader","token":"r-token"},
+		{"name":"alice","role":"operator","token":"o-token"}
+	]}`)
+
+	auth, err := LoadAuthenticator(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var seen Principal
+	h := auth.Require(RoleOperator, true, func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = PrincipalFrom(r.Context())
+	})
+
+	cases := []struct {
+		header string
+		want   int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer nope", http.StatusUnauthorized},
+		{"Bearer r-token", http.StatusForbidden},
+		{"Bearer o-token", http.StatusOK},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest("GET", "/join?channel=chess", nil)
+		if tc.header != "" {
+			req.Header.Set("Authorization", tc.header)
+		}
+		w := httptest.NewRecorder()
+		h(w, req)
+		if w.Code != tc.want {
+			t.Fatalf("Authorization %q: status = %d, want %d", tc.header, w.Code, tc.want)
+		}
+	}
+	if seen.Name != "alice" || seen.Role != RoleOperator {
+		t.Fatalf("principal = %+v, want alice/operator", seen)
+	}
+
+	// Promote the reader and drop alice; reload swaps the table atomically.
+	writeAuthFile(t, path, `{"principals":[{"name":"dash","role":"admin","token":"r-token"}]}`)
+	if err := auth.reload(); err != nil {
+		t.Fatal(err)
+	}
+	for header, want := range map[string]int{"Bearer r-token": http.StatusOK, "Bearer o-token": http.StatusUnauthorized} {
+		req := httptest.NewRequest("GET", "/join?channel=chess", nil)
+		req.Header.Set("Authorization", header)
+		w := httptest.NewRecorder()
+		h(w, req)
+		if w.Code != want {
+			t.Fatalf("after reload %q: status = %d, want %d", header, w.Code, want)
+		}
+	}
+}
+
+func TestLoadAuthenticatorRejectsBadRole(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth.json")
+	writeAuthFile(t, path, `{"principals":[{"name":"x","role":"root","token":"t"}]}`)
+	if _, err := LoadAuthenticator(path); err == nil {
+		t.Fatal("expected error for unknown role")
+	}
+}
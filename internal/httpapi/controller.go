@@ -3,7 +3,9 @@ package httpapi
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 
 	"net"
 	"net/http"
@@ -12,49 +14,214 @@ import (
 	"strings"
 	"time"
 
+	channelrecord "github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/channel_record"
 	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/healthcheck"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/metrics"
 	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/observe"
 	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/types"
 )
 
+const (
+	commandTimeout = 5 * time.Second
+	maxBodyBytes   = 1 << 20
+	defaultWait    = 35 * time.Second // one join timeout plus slack
+	maxWait        = 2 * time.Minute
+
+	authReloadInterval = 5 * time.Second
+
+	defaultHistoryLimit = 100
+	maxHistoryLimit     = 10000
+)
+
 func (api *APIController) Join(w http.ResponseWriter, r *http.Request) {
-	ch := strings.TrimSpace(strings.ToLower(r.URL.Query().Get("channel")))
-	if ch == "" {
-		api.lg.Warn("join request missing channel parameter", "remote", r.RemoteAddr)
-		http.Error(w, "Missing channel parameter", http.StatusBadRequest)
+	api.membership(w, r, "JOIN")
+}
+
+func (api *APIController) Part(w http.ResponseWriter, r *http.Request) {
+	api.membership(w, r, "PART")
+}
+
+// membership handles /join and /part, which differ only in op.
+func (api *APIController) membership(w http.ResponseWriter, r *http.Request, op string) {
+	verb := strings.ToLower(op)
+
+	raws := r.URL.Query()["channel"]
+	if len(raws) == 0 || strings.TrimSpace(raws[0]) == "" {
+		api.lg.Warn(verb+" request missing channel parameter", "remote", r.RemoteAddr)
+		writeError(w, http.StatusBadRequest, "missing_channel", "Missing channel parameter")
+		return
+	}
+	if len(raws) > 1 {
+		writeError(w, http.StatusBadRequest, "invalid_channel", "channel parameter given more than once; send one channel per request")
+		return
+	}
+	channel, err := channelrecord.ValidateChannel(raws[0])
+	if err != nil {
+		api.lg.Warn(verb+" request invalid channel", "raw_channel", raws[0], "err", err, "remote", r.RemoteAddr)
+		writeError(w, http.StatusBadRequest, "invalid_channel", err.Error())
+		return
+	}
+	ch := strings.TrimPrefix(channel, "#")
+
+	expected, err := expectedVersion(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_precondition", err.Error())
 		return
 	}
 
-	api.lg.Info("enqueue join", "channel", ch, "remote", r.RemoteAddr)
-	api.ControlCh <- types.IRCCommand{Op: "JOIN", Channel: "#" + ch}
-	_, _ = w.Write([]byte("Queued join for channel: " + ch))
+	var meta *types.ChannelMeta
+	if op == "JOIN" {
+		if meta, err = metaFromQuery(r); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_metadata", err.Error())
+			return
+		}
+	}
+
+	wait, err := waitDuration(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_wait", err.Error())
+		return
+	}
+	if wait > 0 && api.Status == nil {
+		writeError(w, http.StatusNotImplemented, "wait_unsupported", "wait is not supported by this server")
+		return
+	}
+
+	api.lg.Info("enqueue "+verb, "channel", ch, "remote", r.RemoteAddr, "expected_version", expected, "wait", wait)
+	cmd := types.IRCCommand{
+		Op:              op,
+		Channel:         channel,
+		Meta:            meta,
+		ExpectedVersion: expected,
+		Source:          types.SourceHTTP,
+		Principal:       principalName(r),
+	}
+	var since uint64
+	if wait > 0 {
+		since = api.Status.Seq()
+	}
+	if expected == 0 {
+		api.ControlCh <- cmd
+	} else if !api.submitConditional(w, r, cmd) {
+		return
+	}
+	if wait > 0 {
+		api.awaitPhase(w, r, cmd, since, wait)
+		return
+	}
+	if expected == 0 {
+		_, _ = w.Write([]byte("Queued " + verb + " for channel: " + ch))
+	} else {
+		_, _ = w.Write([]byte("Applied " + verb + " for channel: " + ch))
+	}
 }
 
-func (api *APIController) Part(w http.ResponseWriter, r *http.Request) {
-	ch := strings.TrimSpace(strings.ToLower(r.URL.Query().Get("channel")))
-	if ch == "" {
-		api.lg.Warn("part request missing channel parameter", "remote", r.RemoteAddr)
-		http.Error(w, "Missing channel parameter", http.StatusBadRequest)
+// Replace swaps the whole desired set for the channels in the JSON body.
+// Each element is either a bare name or an object with name and metadata.
+func (api *APIController) Replace(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodPut {
+		w.Header().Set("Allow", "POST, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	api.lg.Info("enqueue part", "channel", ch, "remote", r.RemoteAddr)
-	api.ControlCh <- types.IRCCommand{Op: "PART", Channel: "#" + ch}
-	_, _ = w.Write([]byte("Queued part for channel: " + ch))
+	var body struct {
+		Channels []types.ChannelEntry `json:"channels"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxBodyBytes)).Decode(&body); err != nil {
+		api.lg.Warn("replace request body invalid", "err", err, "remote", r.RemoteAddr)
+		writeError(w, http.StatusBadRequest, "invalid_body", "Invalid JSON body")
+		return
+	}
+	expected, err := expectedVersion(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_precondition", err.Error())
+		return
+	}
+
+	entries := make([]types.ChannelEntry, 0, len(body.Channels))
+	for _, e := range body.Channels {
+		ch, err := channelrecord.ValidateChannel(e.Name)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_channel", err.Error())
+			return
+		}
+		e.Name = ch
+		entries = append(entries, e)
+	}
+
+	api.lg.Info("enqueue replace", "channels", len(entries), "remote", r.RemoteAddr, "expected_version", expected)
+	cmd := types.IRCCommand{
+		Op:              "REPLACE",
+		Entries:         entries,
+		ExpectedVersion: expected,
+		Source:          types.SourceHTTP,
+		Principal:       principalName(r),
+	}
+	if expected == 0 {
+		api.ControlCh <- cmd
+		_, _ = w.Write([]byte("Queued replace of " + strconv.Itoa(len(entries)) + " channels"))
+		return
+	}
+	if api.submitConditional(w, r, cmd) {
+		_, _ = w.Write([]byte("Applied replace of " + strconv.Itoa(len(entries)) + " channels"))
+	}
 }
 
+// Channels serves the desired set. With ?tag= (repeatable) only channels
+// carrying every given tag are listed.
 func (api *APIController) Channels(w http.ResponseWriter, r *http.Request) {
-	version, channels, updatedAt, account := api.SnapshotReader.Snapshot()
+	var (
+		version   uint64
+		entries   []types.ChannelEntry
+		updatedAt time.Time
+		account   string
+	)
+	if api.EntriesReader != nil {
+		version, entries, updatedAt, account = api.EntriesReader.Entries()
+	} else {
+		var names []string
+		version, names, updatedAt, account = api.SnapshotReader.Snapshot()
+		for _, n := range names {
+			entries = append(entries, types.ChannelEntry{Name: n})
+		}
+	}
+
+	etag := formatETag(version)
+	w.Header().Set("ETag", etag)
+	if inm := r.Header.Get("If-None-Match"); inm != "" && inm == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	type entry struct {
+		types.ChannelEntry
+		Active bool `json:"active"` // schedule window currently open
+	}
+
+	now := api.now()
+	tags := r.URL.Query()["tag"]
+	channels := make([]string, 0, len(entries))
+	filtered := make([]entry, 0, len(entries))
+	for _, e := range entries {
+		if !hasAllTags(e.ChannelMeta, tags) {
+			continue
+		}
+		channels = append(channels, e.Name)
+		filtered = append(filtered, entry{ChannelEntry: e, Active: channelrecord.ActiveAt(e, now)})
+	}
 
 	resp := struct {
 		Account   string    `json:"account"`
 		Version   uint64    `json:"version"`
 		UpdatedAt time.Time `json:"updated_at"`
 		Channels  []string  `json:"channels"`
+		Entries   []entry   `json:"entries"`
 	}{
 		Account:   account,
 		Version:   version,
 		UpdatedAt: updatedAt,
 		Channels:  channels,
+		Entries:   filtered,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -66,22 +233,357 @@ func (api *APIController) Channels(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func Run(ctx context.Context, controlCh chan types.IRCCommand, snapshotReader ChannelSnapshotReader) error {
+func hasAllTags(m types.ChannelMeta, tags []string) bool {
+	for _, t := range tags {
+		if !m.HasTag(strings.ToLower(strings.TrimSpace(t))) {
+			return false
+		}
+	}
+	return true
+}
+
+// ChannelHistory serves the desired-state audit log, optionally filtered by
+// channel and limited to the newest entries.
+func (api *APIController) ChannelHistory(w http.ResponseWriter, r *http.Request) {
+	if api.History == nil {
+		http.Error(w, "history is not available", http.StatusNotImplemented)
+		return
+	}
+	q := r.URL.Query()
+	limit := defaultHistoryLimit
+	if v := strings.TrimSpace(q.Get("limit")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid_limit", "limit must be a positive integer")
+			return
+		}
+		limit = min(n, maxHistoryLimit)
+	}
+	var ch string
+	if raw := q.Get("channel"); strings.TrimSpace(raw) != "" {
+		var err error
+		if ch, err = channelrecord.ValidateChannel(raw); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_channel", err.Error())
+			return
+		}
+	}
+
+	entries, err := api.History.History(ch, limit)
+	if err != nil {
+		api.lg.Error("read channel history failed", "err", err, "channel", ch, "remote", r.RemoteAddr)
+		http.Error(w, "failed to read history", http.StatusInternalServerError)
+		return
+	}
+	if entries == nil {
+		entries = []types.AuditEntry{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(struct {
+		Entries []types.AuditEntry `json:"entries"`
+	}{Entries: entries}); err != nil {
+		api.lg.Error("encode history response failed", "err", err, "remote", r.RemoteAddr)
+	}
+}
+
+// apiError is the JSON body of every structured error response.
+type apiError struct {
+	Error          string `json:"error"`
+	Message        string `json:"message"`
+	CurrentVersion uint64 `json:"current_version,omitempty"`
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, apiError{Error: code, Message: message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func principalName(r *http.Request) string {
+	if p, ok := PrincipalFrom(r.Context()); ok {
+		return p.Name
+	}
+	return ""
+}
+
+// submitConditional hands cmd to the controller and waits for its verdict.
+// It writes the error response itself and reports whether the caller should
+// write a success body.
+func (api *APIController) submitConditional(w http.ResponseWriter, r *http.Request, cmd types.IRCCommand) bool {
+	res := make(chan types.CommandResult, 1)
+	cmd.Result = res
+
+	ctx, cancel := context.WithTimeout(r.Context(), commandTimeout)
+	defer cancel()
+
+	select {
+	case api.ControlCh <- cmd:
+	case <-ctx.Done():
+		http.Error(w, "controller busy", http.StatusServiceUnavailable)
+		return false
+	}
+
+	select {
+	case out := <-res:
+		w.Header().Set("ETag", formatETag(out.Version))
+		switch {
+		case out.Conflict:
+			api.lg.Info("rejected stale write",
+				"op", cmd.Op, "channel", cmd.Channel,
+				"expected_version", cmd.ExpectedVersion, "current_version", out.Version,
+				"remote", r.RemoteAddr)
+			writeJSON(w, http.StatusConflict, apiError{
+				Error:          "version_conflict",
+				Message:        "desired channels changed since the given version",
+				CurrentVersion: out.Version,
+			})
+			return false
+		case errors.Is(out.Err, channelrecord.ErrInvalidChannel):
+			writeError(w, http.StatusBadRequest, "invalid_channel", out.Err.Error())
+			return false
+		case out.Err != nil:
+			writeError(w, http.StatusBadRequest, "rejected", out.Err.Error())
+			return false
+		}
+		return true
+	case <-ctx.Done():
+		http.Error(w, "timed out waiting for controller", http.StatusServiceUnavailable)
+		return false
+	}
+}
+
+// awaitPhase blocks until the rectifier reports a final phase for cmd's
+// channel and writes it as JSON. Joined/Idle are final at any time; an Error
+// only counts if it was raised after since, so a stale failure from an
+// earlier attempt does not answer a fresh request.
+func (api *APIController) awaitPhase(w http.ResponseWriter, r *http.Request, cmd types.IRCCommand, since uint64, wait time.Duration) {
+	want := "Joined"
+	if cmd.Op == "PART" {
+		want = "Idle"
+	}
+
+	// The server-wide WriteTimeout is shorter than a join timeout.
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(wait + 5*time.Second))
+
+	ctx, cancel := context.WithTimeout(r.Context(), wait)
+	defer cancel()
+
+	start := time.Now()
+	st, err := api.Status.Await(ctx, cmd.Channel, func(st types.ChannelStatus) bool {
+		return st.Phase == want || (st.Phase == "Error" && (st.Seq > since || st.Terminal))
+	})
+
+	code := http.StatusOK
+	switch {
+	case err != nil:
+		code = http.StatusGatewayTimeout
+	case st.Phase == "Error":
+		code = http.StatusBadGateway
+	}
+	api.lg.Info("wait finished",
+		"op", cmd.Op, "channel", cmd.Channel, "phase", st.Phase,
+		"status", code, "waited_ms", time.Since(start).Milliseconds(), "remote", r.RemoteAddr)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(struct {
+		Op       string `json:"op"`
+		Channel  string `json:"channel"`
+		Phase    string `json:"phase"`
+		Reason   string `json:"reason,omitempty"`
+		TimedOut bool   `json:"timed_out"`
+		WaitedMs int64  `json:"waited_ms"`
+	}{
+		Op:       cmd.Op,
+		Channel:  cmd.Channel,
+		Phase:    st.Phase,
+		Reason:   st.Reason,
+		TimedOut: err != nil,
+		WaitedMs: time.Since(start).Milliseconds(),
+	})
+}
+
+// metaFromQuery reads optional channel metadata from a join request:
+// tags (comma-separated or repeated), priority, owner, either expires_at
+// (RFC 3339) or expires_in (duration), and a schedule from start/end
+// (RFC 3339) and cron/duration/tz. It returns nil when none were given so a
+// plain join leaves existing metadata alone.
+func metaFromQuery(r *http.Request) (*types.ChannelMeta, error) {
+	q := r.URL.Query()
+	var meta types.ChannelMeta
+	given := false
+
+	for _, v := range q["tags"] {
+		given = true
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				meta.Tags = append(meta.Tags, t)
+			}
+		}
+	}
+	if v := strings.TrimSpace(q.Get("priority")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid priority parameter")
+		}
+		meta.Priority = n
+		given = true
+	}
+	if v := strings.TrimSpace(q.Get("owner")); v != "" {
+		meta.Owner = v
+		given = true
+	}
+	at, in := strings.TrimSpace(q.Get("expires_at")), strings.TrimSpace(q.Get("expires_in"))
+	switch {
+	case at != "" && in != "":
+		return nil, fmt.Errorf("give expires_at or expires_in, not both")
+	case at != "":
+		t, err := time.Parse(time.RFC3339, at)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expires_at parameter; want RFC 3339")
+		}
+		meta.ExpiresAt = &t
+		given = true
+	case in != "":
+		d, err := time.ParseDuration(in)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid expires_in parameter")
+		}
+		t := time.Now().Add(d).UTC()
+		meta.ExpiresAt = &t
+		given = true
+	}
+	var sched types.Schedule
+	schedGiven := false
+	for name, dst := range map[string]**time.Time{"start": &sched.Start, "end": &sched.End} {
+		if v := strings.TrimSpace(q.Get(name)); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s parameter; want RFC 3339", name)
+			}
+			*dst = &t
+			schedGiven = true
+		}
+	}
+	for name, dst := range map[string]*string{"cron": &sched.Cron, "duration": &sched.Duration, "tz": &sched.TZ} {
+		if v := strings.TrimSpace(q.Get(name)); v != "" {
+			*dst = v
+			schedGiven = true
+		}
+	}
+	if schedGiven {
+		meta.Schedule = &sched
+		given = true
+	}
+
+	if !given {
+		return nil, nil
+	}
+	return &meta, nil
+}
+
+// waitDuration parses the wait parameter: a Go duration ("20s") or a
+// boolean, where true selects defaultWait. Values are capped at maxWait.
+func waitDuration(r *http.Request) (time.Duration, error) {
+	q := strings.TrimSpace(r.URL.Query().Get("wait"))
+	if q == "" {
+		return 0, nil
+	}
+	if b, err := strconv.ParseBool(q); err == nil {
+		if b {
+			return defaultWait, nil
+		}
+		return 0, nil
+	}
+	d, err := time.ParseDuration(q)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid wait parameter")
+	}
+	if d > maxWait {
+		d = maxWait
+	}
+	return d, nil
+}
+
+// expectedVersion reads the caller's precondition from If-Match or the
+// expected_version query parameter; 0 means none was given.
+func expectedVersion(r *http.Request) (uint64, error) {
+	if im := strings.TrimSpace(r.Header.Get("If-Match")); im != "" && im != "*" {
+		v, err := strconv.ParseUint(strings.Trim(strings.TrimPrefix(im, "W/"), `"`), 10, 64)
+		if err != nil || v == 0 {
+			return 0, fmt.Errorf("invalid If-Match header")
+		}
+		return v, nil
+	}
+	if q := strings.TrimSpace(r.URL.Query().Get("expected_version")); q != "" {
+		v, err := strconv.ParseUint(q, 10, 64)
+		if err != nil || v == 0 {
+			return 0, fmt.Errorf("invalid expected_version parameter")
+		}
+		return v, nil
+	}
+	return 0, nil
+}
+
+func formatETag(version uint64) string {
+	return `"` + strconv.FormatUint(version, 10) + `"`
+}
+
+// Run serves the control API. sayCh, when non-nil, enables POST /say, and
+// clearCh POST /channels/clear.
+func Run(ctx context.Context, controlCh chan types.IRCCommand, sayCh chan<- types.IRCCommand, clearCh chan<- types.MembershipEvent, snapshotReader ChannelSnapshotReader, status ChannelStatusReader, checks ...healthcheck.Check) error {
 	lg := observe.C("http_api")
 	api := &APIController{
 		ControlCh:      controlCh,
+		SayCh:          sayCh,
+		ClearCh:        clearCh,
 		SnapshotReader: snapshotReader,
+		Status:         status,
 		lg:             lg,
 	}
+	if h, ok := snapshotReader.(ChannelHistoryReader); ok {
+		api.History = h
+	}
+	if e, ok := snapshotReader.(ChannelEntriesReader); ok {
+		api.EntriesReader = e
+	}
+	if c, ok := snapshotReader.(Clock); ok {
+		api.Clock = c
+	}
 
 	mux := http.NewServeMux()
 	probe := healthcheck.New("http_api")
+	for _, c := range checks {
+		probe.AddCheck(c)
+	}
 	probe.Register(mux)
 	probe.SetNotReady()
 
-	mux.HandleFunc("/join", api.Join)
-	mux.HandleFunc("/part", api.Part)
-	mux.HandleFunc("/channels", api.Channels)
+	var auth *Authenticator
+	if path := strings.TrimSpace(os.Getenv("HTTP_API_AUTH_FILE")); path != "" {
+		a, err := LoadAuthenticator(path)
+		if err != nil {
+			return fmt.Errorf("http_api: %w", err)
+		}
+		auth = a
+		go auth.Watch(ctx, authReloadInterval)
+	} else {
+		lg.Warn("HTTP_API_AUTH_FILE not set; control API is unauthenticated")
+	}
+
+	mux.HandleFunc("/join", auth.Require(RoleOperator, true, api.Join))
+	mux.HandleFunc("/part", auth.Require(RoleOperator, true, api.Part))
+	mux.HandleFunc("/channels", auth.Require(RoleReader, false, api.Channels))
+	mux.HandleFunc("/channels/history", auth.Require(RoleReader, false, api.ChannelHistory))
+	mux.HandleFunc("/channels/status", auth.Require(RoleReader, false, api.ChannelStatus))
+	mux.HandleFunc("/channels/clear", auth.Require(RoleOperator, true, api.ClearChannel))
+	mux.HandleFunc("/replace", auth.Require(RoleAdmin, true, api.Replace))
+	mux.HandleFunc("/say", auth.Require(RoleOperator, true, api.Say))
+	mux.HandleFunc("/metrics", auth.Require(RoleReader, false, metrics.Handler().ServeHTTP))
 
 	host := strings.TrimSpace(os.Getenv("HTTP_API_HOST"))
 	if host == "" {
@@ -110,6 +612,19 @@ func Run(ctx context.Context, controlCh chan types.IRCCommand, snapshotReader Ch
 		IdleTimeout:       60 * time.Second,
 	}
 
+	certFile := strings.TrimSpace(os.Getenv("HTTP_API_TLS_CERT"))
+	keyFile := strings.TrimSpace(os.Getenv("HTTP_API_TLS_KEY"))
+	if (certFile == "") != (keyFile == "") {
+		return fmt.Errorf("HTTP_API_TLS_CERT and HTTP_API_TLS_KEY must be set together")
+	}
+	if certFile != "" {
+		tlsCfg, err := serverTLSConfig(strings.TrimSpace(os.Getenv("HTTP_API_TLS_CLIENT_CA")))
+		if err != nil {
+			return fmt.Errorf("http_api: %w", err)
+		}
+		srv.TLSConfig = tlsCfg
+	}
+
 	ln, err := net.Listen("tcp", address)
 	if err != nil {
 		return fmt.Errorf("http_api: listen error on %s: %w", address, err)
@@ -117,9 +632,13 @@ func Run(ctx context.Context, controlCh chan types.IRCCommand, snapshotReader Ch
 
 	errCh := make(chan error, 1)
 	go func() {
-		lg.Info("listening", "address", address)
+		lg.Info("listening", "address", address, "tls", certFile != "", "auth", auth != nil)
 		probe.SetReady()
-		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+		serve := func() error { return srv.Serve(ln) }
+		if certFile != "" {
+			serve = func() error { return srv.ServeTLS(ln, certFile, keyFile) }
+		}
+		if err := serve(); err != nil && err != http.ErrServerClosed {
 			errCh <- err
 			return
 		}
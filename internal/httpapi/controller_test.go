@@ -1,11 +1,16 @@
 package httpapi
 
 import (
+	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/observe"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/scheduler"
 	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/types"
 )
 
@@ -92,3 +97,339 @@ func TestPartMissingParam(t *testing.T) {
 		t.Fatal("should not enqueue on error")
 	}
 }
+
+type snapStub struct{ v uint64 }
+
+func (s snapStub) Snapshot() (uint64, []string, time.Time, string) {
+	return s.v, []string{"#chess"}, time.Time{}, "me"
+}
+
+func TestJoinIfMatchConflict(t *testing.T) {
+	ch := make(chan types.IRCCommand, 1)
+	api := &APIController{ControlCh: ch, lg: observe.C("httpapi_test")}
+
+	go func() {
+		cmd := <-ch
+		if cmd.ExpectedVersion != 3 {
+			t.Errorf("expected_version = %d, want 3", cmd.ExpectedVersion)
+		}
+		cmd.Result <- types.CommandResult{Version: 4, Conflict: true}
+	}()
+
+	req := httptest.NewRequest("GET", "/join?channel=chess", nil)
+	req.Header.Set("If-Match", `"3"`)
+	w := httptest.NewRecorder()
+
+	api.Join(w, req)
+
+	if w.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want 409", w.Code)
+	}
+	if got := w.Header().Get("ETag"); got != `"4"` {
+		t.Fatalf("ETag = %q, want \"4\"", got)
+	}
+	if !strings.Contains(w.Body.String(), `"current_version":4`) {
+		t.Fatalf("body missing current version: %q", w.Body.String())
+	}
+}
+
+func TestPartExpectedVersionApplied(t *testing.T) {
+	ch := make(chan types.IRCCommand, 1)
+	api := &APIController{ControlCh: ch, lg: observe.C("httpapi_test")}
+
+	go func() {
+		cmd := <-ch
+		cmd.Result <- types.CommandResult{Version: cmd.ExpectedVersion + 1}
+	}()
+
+	req := httptest.NewRequest("GET", "/part?channel=chess&expected_version=7", nil)
+	w := httptest.NewRecorder()
+
+	api.Part(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if got := w.Header().Get("ETag"); got != `"8"` {
+		t.Fatalf("ETag = %q, want \"8\"", got)
+	}
+}
+
+func TestChannelsETag(t *testing.T) {
+	api := &APIController{SnapshotReader: snapStub{v: 5}, lg: observe.C("httpapi_test")}
+
+	w := httptest.NewRecorder()
+	api.Channels(w, httptest.NewRequest("GET", "/channels", nil))
+	if got := w.Header().Get("ETag"); got != `"5"` {
+		t.Fatalf("ETag = %q, want \"5\"", got)
+	}
+
+	req := httptest.NewRequest("GET", "/channels", nil)
+	req.Header.Set("If-None-Match", `"5"`)
+	w = httptest.NewRecorder()
+	api.Channels(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Fatalf("status = %d, want 304", w.Code)
+	}
+}
+
+type statusStub struct {
+	seq uint64
+	st  types.ChannelStatus
+}
+
+func (s *statusStub) Seq() uint64 { return s.seq }
+
+func (s *statusStub) Await(ctx context.Context, _ string, done func(types.ChannelStatus) bool) (types.ChannelStatus, error) {
+	if done(s.st) {
+		return s.st, nil
+	}
+	<-ctx.Done()
+	return s.st, ctx.Err()
+}
+
+func TestJoinWait(t *testing.T) {
+	cases := []struct {
+		name string
+		st   types.ChannelStatus
+		want int
+	}{
+		{"joined", types.ChannelStatus{Phase: "Joined", Seq: 1}, http.StatusOK},
+		{"fresh error", types.ChannelStatus{Phase: "Error", Seq: 6}, http.StatusBadGateway},
+		{"stale error", types.ChannelStatus{Phase: "Error", Seq: 4}, http.StatusGatewayTimeout},
+		{"refused earlier", types.ChannelStatus{Phase: "Error", Reason: "msg_channel_suspended", Terminal: true, Seq: 4}, http.StatusBadGateway},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := make(chan types.IRCCommand, 1)
+			api := &APIController{
+				ControlCh: ch,
+				Status:    &statusStub{seq: 5, st: tc.st},
+				lg:        observe.C("httpapi_test"),
+			}
+
+			req := httptest.NewRequest("GET", "/join?channel=chess&wait=50ms", nil)
+			w := httptest.NewRecorder()
+			api.Join(w, req)
+
+			if w.Code != tc.want {
+				t.Fatalf("status = %d, want %d (body %q)", w.Code, tc.want, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), `"phase":"`+tc.st.Phase+`"`) {
+				t.Fatalf("body missing phase: %q", w.Body.String())
+			}
+			if len(ch) != 1 {
+				t.Fatal("join was not enqueued")
+			}
+		})
+	}
+}
+
+func TestJoinRejectsInvalidChannels(t *testing.T) {
+	cases := []string{
+		"abc",                        // too short
+		"abcdefghijklmnopqrstuvwxyz", // 26 chars
+		"chess,speedrun",             // would smuggle a second JOIN
+		"chess%20club",               // inner space
+		"sch%C3%B6n",                 // unicode
+		"chess%0D%0AQUIT",            // CRLF injection
+	}
+	for _, raw := range cases {
+		ch := make(chan types.IRCCommand, 1)
+		api := &APIController{ControlCh: ch, lg: observe.C("httpapi_test")}
+
+		w := httptest.NewRecorder()
+		api.Join(w, httptest.NewRequest("GET", "/join?channel="+raw, nil))
+
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("%q: status = %d, want 400", raw, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), `"error":"invalid_channel"`) {
+			t.Fatalf("%q: body = %q, want invalid_channel error", raw, w.Body.String())
+		}
+		if len(ch) != 0 {
+			t.Fatalf("%q: should not enqueue", raw)
+		}
+	}
+}
+
+type entriesStub struct{}
+
+func (entriesStub) Entries() (uint64, []types.ChannelEntry, time.Time, string) {
+	return 2, []types.ChannelEntry{
+		{Name: "#chess", ChannelMeta: types.ChannelMeta{Tags: []string{"esports", "tier1"}}},
+		{Name: "#speedrun", ChannelMeta: types.ChannelMeta{Tags: []string{"esports"}}},
+		{Name: "#cooking"},
+	}, time.Time{}, "me"
+}
+
+func TestChannelsFilterByTag(t *testing.T) {
+	api := &APIController{EntriesReader: entriesStub{}, lg: observe.C("httpapi_test")}
+
+	w := httptest.NewRecorder()
+	api.Channels(w, httptest.NewRequest("GET", "/channels?tag=esports&tag=Tier1", nil))
+
+	var resp struct {
+		Channels []string             `json:"channels"`
+		Entries  []types.ChannelEntry `json:"entries"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Channels) != 1 || resp.Channels[0] != "#chess" || len(resp.Entries) != 1 {
+		t.Fatalf("filtered = %+v, want only #chess", resp)
+	}
+}
+
+type scheduledStub struct{}
+
+func (scheduledStub) Entries() (uint64, []types.ChannelEntry, time.Time, string) {
+	return 1, []types.ChannelEntry{{Name: "#chess", ChannelMeta: types.ChannelMeta{
+		Schedule: &types.Schedule{Cron: "0 20 * * *", Duration: "2h"},
+	}}}, time.Time{}, "me"
+}
+
+type clockStub time.Time
+
+func (c clockStub) Now() time.Time { return time.Time(c) }
+
+func TestChannelsActiveByControllerClock(t *testing.T) {
+	for at, want := range map[time.Time]bool{
+		time.Date(2025, 6, 2, 21, 0, 0, 0, time.UTC): true,
+		time.Date(2025, 6, 2, 23, 0, 0, 0, time.UTC): false,
+	} {
+		api := &APIController{EntriesReader: scheduledStub{}, Clock: clockStub(at), lg: observe.C("httpapi_test")}
+		w := httptest.NewRecorder()
+		api.Channels(w, httptest.NewRequest("GET", "/channels", nil))
+
+		var resp struct {
+			Entries []struct {
+				Active bool `json:"active"`
+			} `json:"entries"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		if len(resp.Entries) != 1 || resp.Entries[0].Active != want {
+			t.Fatalf("at %s: entries = %+v, want active=%v", at, resp.Entries, want)
+		}
+	}
+}
+
+func TestJoinCarriesMetadata(t *testing.T) {
+	ch := make(chan types.IRCCommand, 1)
+	api := &APIController{ControlCh: ch, lg: observe.C("httpapi_test")}
+
+	w := httptest.NewRecorder()
+	api.Join(w, httptest.NewRequest("GET", "/join?channel=chess&tags=esports,tier1&priority=3&expires_in=1h", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (%s)", w.Code, w.Body.String())
+	}
+	cmd := <-ch
+	if cmd.Meta == nil || len(cmd.Meta.Tags) != 2 || cmd.Meta.Priority != 3 || cmd.Meta.ExpiresAt == nil {
+		t.Fatalf("meta = %+v, want tags, priority and expiry", cmd.Meta)
+	}
+}
+
+type joinedStub struct{ *statusStub }
+
+func (joinedStub) Get(channel string) types.ChannelStatus {
+	if channel == "#chess" {
+		return types.ChannelStatus{Channel: channel, Phase: "Joined"}
+	}
+	return types.ChannelStatus{Channel: channel, Phase: "Idle"}
+}
+
+func TestSay(t *testing.T) {
+	cases := []struct {
+		name   string
+		body   string
+		result error
+		want   int
+	}{
+		{"sent", `{"channel":"chess","text":"hello"}`, nil, http.StatusOK},
+		{"not joined", `{"channel":"other","text":"hello"}`, nil, http.StatusConflict},
+		{"command", `{"channel":"chess","text":"/ban someone"}`, nil, http.StatusBadRequest},
+		{"multiline", `{"channel":"chess","text":"a\r\nJOIN #x"}`, nil, http.StatusBadRequest},
+		{"slow", `{"channel":"chess","text":"hello"}`, &scheduler.SlowModeError{RetryAfter: 2500 * time.Millisecond}, http.StatusTooManyRequests},
+		{"duplicate", `{"channel":"chess","text":"hello"}`, scheduler.ErrDuplicateMessage, http.StatusConflict},
+		{"notice", `{"channel":"chess","text":"hello"}`, &scheduler.NoticeError{MsgID: "msg_banned"}, http.StatusUnprocessableEntity},
+		{"unconfirmed", `{"channel":"chess","text":"hello"}`, scheduler.ErrUnconfirmed, http.StatusAccepted},
+		{"not sent", `{"channel":"chess","text":"hello"}`, scheduler.ErrNotSent, http.StatusServiceUnavailable},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			sayCh := make(chan types.IRCCommand, 1)
+			api := &APIController{SayCh: sayCh, Status: joinedStub{&statusStub{}}, lg: observe.C("httpapi_test")}
+			go func() {
+				select {
+				case cmd := <-sayCh:
+					if cmd.Op != "PRIVMSG" || cmd.Channel != "#chess" {
+						t.Errorf("cmd = %+v", cmd)
+					}
+					cmd.Result <- types.CommandResult{Err: tc.result}
+				case <-time.After(time.Second):
+				}
+			}()
+
+			w := httptest.NewRecorder()
+			api.Say(w, httptest.NewRequest("POST", "/say", strings.NewReader(tc.body)))
+			if w.Code != tc.want {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tc.want, w.Body.String())
+			}
+			if tc.name == "slow" && w.Header().Get("Retry-After") != "3" {
+				t.Fatalf("Retry-After = %q, want 3", w.Header().Get("Retry-After"))
+			}
+		})
+	}
+}
+
+type boardStub struct {
+	*statusStub
+	byChan map[string]types.ChannelStatus
+}
+
+func (b boardStub) Get(channel string) types.ChannelStatus {
+	if st, ok := b.byChan[channel]; ok {
+		return st
+	}
+	return types.ChannelStatus{Channel: channel, Phase: "Idle"}
+}
+
+func (b boardStub) List() []types.ChannelStatus {
+	var out []types.ChannelStatus
+	for _, st := range b.byChan {
+		out = append(out, st)
+	}
+	return out
+}
+
+func TestChannelStatusAndClear(t *testing.T) {
+	board := boardStub{&statusStub{}, map[string]types.ChannelStatus{
+		"#gone": {Channel: "#gone", Phase: "Error", Reason: "msg_channel_suspended", Terminal: true},
+	}}
+	clearCh := make(chan types.MembershipEvent, 1)
+	api := &APIController{Status: board, ClearCh: clearCh, lg: observe.C("httpapi_test")}
+
+	w := httptest.NewRecorder()
+	api.ChannelStatus(w, httptest.NewRequest("GET", "/channels/status", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"reason":"msg_channel_suspended","terminal":true`) {
+		t.Fatalf("status list = %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	api.ClearChannel(w, httptest.NewRequest("POST", "/channels/clear?channel=chess", nil))
+	if w.Code != http.StatusConflict {
+		t.Fatalf("clear of a healthy channel = %d, want 409", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	api.ClearChannel(w, httptest.NewRequest("POST", "/channels/clear?channel=Gone", nil))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("clear = %d: %s", w.Code, w.Body.String())
+	}
+	if evt := <-clearCh; evt != (types.MembershipEvent{Op: "CLEAR", Channel: "#gone"}) {
+		t.Fatalf("clear event = %+v", evt)
+	}
+}
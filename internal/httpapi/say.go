@@ -0,0 +1,146 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	channelrecord "github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/channel_record"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/scheduler"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/types"
+)
+
+const (
+	maxSayRunes = 500 // Twitch's chat message limit
+	// sayTimeout is how long a caller waits for the outcome: a short wait
+	// behind the rate limiter plus the scheduler's confirmation wait. A
+	// message held longer is reported unconfirmed.
+	sayTimeout = 14 * time.Second
+)
+
+// Say posts one chat message through the collector's connection. The body
+// is {"channel": "...", "text": "..."}; the response reports whether
+// Twitch accepted it.
+func (api *APIController) Say(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if api.SayCh == nil {
+		http.Error(w, "say is not available", http.StatusNotImplemented)
+		return
+	}
+	var body struct {
+		Channel string `json:"channel"`
+		Text    string `json:"text"`
+	}
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxBodyBytes)).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_body", "Invalid JSON body")
+		return
+	}
+	channel, err := channelrecord.ValidateChannel(body.Channel)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_channel", err.Error())
+		return
+	}
+	if msg := validateSayText(body.Text); msg != "" {
+		writeError(w, http.StatusBadRequest, "invalid_text", msg)
+		return
+	}
+	if g, ok := api.Status.(ChannelStatusGetter); ok {
+		if st := g.Get(channel); st.Phase != "Joined" {
+			writeError(w, http.StatusConflict, "not_joined", "collector is not joined to "+channel+" (phase "+st.Phase+")")
+			return
+		}
+	}
+
+	// The server-wide WriteTimeout is about as long as sayTimeout.
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(sayTimeout + 5*time.Second))
+
+	ctx, cancel := context.WithTimeout(r.Context(), sayTimeout)
+	defer cancel()
+
+	res := make(chan types.CommandResult, 1)
+	cmd := types.IRCCommand{
+		Op:        "PRIVMSG",
+		Channel:   channel,
+		Text:      body.Text,
+		Source:    types.SourceHTTP,
+		Principal: principalName(r),
+		Result:    res,
+	}
+	select {
+	case api.SayCh <- cmd:
+	case <-ctx.Done():
+		http.Error(w, "scheduler busy", http.StatusServiceUnavailable)
+		return
+	}
+
+	var out types.CommandResult
+	select {
+	case out = <-res:
+	case <-ctx.Done():
+		out.Err = scheduler.ErrUnconfirmed
+	}
+
+	var (
+		slow   *scheduler.SlowModeError
+		notice *scheduler.NoticeError
+	)
+	switch {
+	case out.Err == nil:
+		writeJSON(w, http.StatusOK, sayResponse{Channel: channel, Status: "sent"})
+	case errors.Is(out.Err, scheduler.ErrUnconfirmed):
+		writeJSON(w, http.StatusAccepted, sayResponse{Channel: channel, Status: "unconfirmed"})
+	case errors.As(out.Err, &slow):
+		secs := int((slow.RetryAfter + time.Second - 1) / time.Second)
+		w.Header().Set("Retry-After", strconv.Itoa(secs))
+		writeError(w, http.StatusTooManyRequests, "slow_mode", out.Err.Error())
+	case errors.Is(out.Err, scheduler.ErrDuplicateMessage):
+		writeError(w, http.StatusConflict, "duplicate_message", out.Err.Error())
+	case errors.Is(out.Err, scheduler.ErrNotSent):
+		writeError(w, http.StatusServiceUnavailable, "not_sent", out.Err.Error())
+	case errors.As(out.Err, &notice):
+		writeJSON(w, http.StatusUnprocessableEntity, sayResponse{
+			Channel: channel,
+			Status:  "rejected",
+			MsgID:   notice.MsgID,
+			Message: notice.Text,
+		})
+	default:
+		writeError(w, http.StatusBadGateway, "rejected", out.Err.Error())
+	}
+	api.lg.Info("say finished", "channel", channel, "err", out.Err, "remote", r.RemoteAddr)
+}
+
+type sayResponse struct {
+	Channel string `json:"channel"`
+	Status  string `json:"status"` // "sent", "unconfirmed" or "rejected"
+	MsgID   string `json:"msg_id,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// validateSayText returns why text cannot be sent, or "" if it can.
+// Leading "/" and "." would be run as chat commands.
+func validateSayText(text string) string {
+	switch {
+	case strings.TrimSpace(text) == "":
+		return "text is empty"
+	case !utf8.ValidString(text):
+		return "text is not valid UTF-8"
+	case utf8.RuneCountInString(text) > maxSayRunes:
+		return "text is longer than " + strconv.Itoa(maxSayRunes) + " characters"
+	case strings.ContainsAny(text, "\r\n\x00"):
+		return "text must be a single line"
+	case strings.HasPrefix(text, "/") || strings.HasPrefix(text, "."):
+		return "chat commands are not allowed"
+	}
+	return ""
+}
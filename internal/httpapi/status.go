@@ -0,0 +1,81 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	channelrecord "github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/channel_record"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/types"
+)
+
+// ChannelStatus serves the rectifier's phase for every tracked channel, or
+// for one with ?channel=. A channel Twitch refused shows phase Error with
+// terminal set and the NOTICE msg-id as its reason.
+func (api *APIController) ChannelStatus(w http.ResponseWriter, r *http.Request) {
+	var statuses []types.ChannelStatus
+	if raw := r.URL.Query().Get("channel"); strings.TrimSpace(raw) != "" {
+		g, ok := api.Status.(ChannelStatusGetter)
+		if !ok {
+			http.Error(w, "status is not available", http.StatusNotImplemented)
+			return
+		}
+		ch, err := channelrecord.ValidateChannel(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid_channel", err.Error())
+			return
+		}
+		statuses = []types.ChannelStatus{g.Get(ch)}
+	} else {
+		l, ok := api.Status.(ChannelStatusLister)
+		if !ok {
+			http.Error(w, "status is not available", http.StatusNotImplemented)
+			return
+		}
+		statuses = l.List()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(struct {
+		Channels []types.ChannelStatus `json:"channels"`
+	}{Channels: statuses}); err != nil {
+		api.lg.Error("encode status response failed", "err", err, "remote", r.RemoteAddr)
+	}
+}
+
+// ClearChannel lifts a terminal error so the rectifier tries the channel
+// again, for when whatever made Twitch refuse it has been resolved.
+func (api *APIController) ClearChannel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	g, ok := api.Status.(ChannelStatusGetter)
+	if api.ClearCh == nil || !ok {
+		http.Error(w, "clear is not available", http.StatusNotImplemented)
+		return
+	}
+	channel, err := channelrecord.ValidateChannel(r.URL.Query().Get("channel"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_channel", err.Error())
+		return
+	}
+	if st := g.Get(channel); !st.Terminal {
+		writeError(w, http.StatusConflict, "not_terminal", channel+" is not in a terminal error (phase "+st.Phase+")")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), commandTimeout)
+	defer cancel()
+	select {
+	case api.ClearCh <- types.MembershipEvent{Op: "CLEAR", Channel: channel}:
+	case <-ctx.Done():
+		http.Error(w, "rectifier busy", http.StatusServiceUnavailable)
+		return
+	}
+	api.lg.Info("terminal error cleared", "channel", channel, "principal", principalName(r), "remote", r.RemoteAddr)
+	w.WriteHeader(http.StatusAccepted)
+	_, _ = w.Write([]byte("Queued clear for channel: " + strings.TrimPrefix(channel, "#")))
+}
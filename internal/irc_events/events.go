@@ -8,12 +8,32 @@ type Event interface {
 	Marshal() ([]byte, error)
 }
 
+// Identified is implemented by events that carry Twitch's unique message
+// id (the "id" tag), which downstream deduplication keys on.
+type Identified interface {
+	MessageID() string
+}
+
 type PrivMsg struct {
+	ID           string
 	UserID       string
 	UserLogin    string
 	ChannelID    string
 	ChannelLogin string
-	Text         string
+	Text         string // without the /me wrapper or control bytes, NFC-normalized
+	MaskedText   string // Text with each emote replaced by "<emote>"
+	IsAction     bool   // sent with /me
+}
+
+// Raid is a USERNOTICE msg-id=raid: FromLogin brought viewers into the
+// channel the notice was delivered to.
+type Raid struct {
+	ID           string
+	ChannelID    string
+	ChannelLogin string
+	FromUserID   string
+	FromLogin    string
+	ViewerCount  int
 }
 
 type JoinPart struct {
@@ -33,3 +53,98 @@ func (msg PrivMsg) Key() string {
 func (msg PrivMsg) Marshal() ([]byte, error) {
 	return json.Marshal(msg)
 }
+
+func (msg PrivMsg) MessageID() string {
+	return msg.ID
+}
+
+func (r Raid) Kind() string {
+	return "raid"
+}
+
+func (r Raid) Key() string {
+	return r.ChannelID
+}
+
+func (r Raid) Marshal() ([]byte, error) {
+	return json.Marshal(r)
+}
+
+func (r Raid) MessageID() string {
+	return r.ID
+}
+
+// Whisper is a private message to the collector's account.
+type Whisper struct {
+	ID         string // the "message-id" tag
+	ThreadID   string
+	FromUserID string
+	FromLogin  string
+	ToLogin    string
+	Text       string
+	MaskedText string
+	IsAction   bool
+}
+
+// GlobalUserState is the collector's own identity, sent once on login.
+type GlobalUserState struct {
+	UserID      string
+	DisplayName string
+	Color       string
+	Badges      map[string]string // name -> version
+	EmoteSets   []string
+}
+
+// UserState is the collector's own standing in one channel. It is emitted
+// when it changes, not for every USERSTATE Twitch repeats after a PRIVMSG.
+type UserState struct {
+	ChannelLogin string
+	DisplayName  string
+	Color        string
+	Badges       map[string]string
+	EmoteSets    []string
+	Broadcaster  bool
+	Moderator    bool
+	VIP          bool
+}
+
+func (w Whisper) Kind() string {
+	return "whisper"
+}
+
+// Key keeps a conversation on one partition.
+func (w Whisper) Key() string {
+	return w.ThreadID
+}
+
+func (w Whisper) Marshal() ([]byte, error) {
+	return json.Marshal(w)
+}
+
+func (w Whisper) MessageID() string {
+	return w.ID
+}
+
+func (g GlobalUserState) Kind() string {
+	return "globaluserstate"
+}
+
+func (g GlobalUserState) Key() string {
+	return g.UserID
+}
+
+func (g GlobalUserState) Marshal() ([]byte, error) {
+	return json.Marshal(g)
+}
+
+func (u UserState) Kind() string {
+	return "userstate"
+}
+
+func (u UserState) Key() string {
+	return u.ChannelLogin
+}
+
+func (u UserState) Marshal() ([]byte, error) {
+	return json.Marshal(u)
+}
@@ -0,0 +1,162 @@
+package ircmsg
+
+import (
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Vectors from ircdocs/parser-tests; see testdata/README.md.
+
+type atoms struct {
+	Tags   map[string]*string `yaml:"tags"` // null means a tag without a value
+	Source *string            `yaml:"source"`
+	Verb   string             `yaml:"verb"`
+	Params []string           `yaml:"params"`
+}
+
+func loadVectors(t *testing.T, name string, into any) {
+	t.Helper()
+	b, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal(b, into); err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+}
+
+func TestConformance_MsgSplit(t *testing.T) {
+	var doc struct {
+		Tests []struct {
+			Input string `yaml:"input"`
+			Atoms atoms  `yaml:"atoms"`
+		} `yaml:"tests"`
+	}
+	loadVectors(t, "msg-split.yaml", &doc)
+	if len(doc.Tests) == 0 {
+		t.Fatal("no vectors")
+	}
+
+	for _, tc := range doc.Tests {
+		m, err := Parse(tc.Input)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tc.Input, err)
+			continue
+		}
+		want := tc.Atoms
+		if m.Command != want.Verb {
+			t.Errorf("Parse(%q) command = %q, want %q", tc.Input, m.Command, want.Verb)
+		}
+		if src := m.Source.String(); want.Source == nil && src != "" || want.Source != nil && src != *want.Source {
+			t.Errorf("Parse(%q) source = %q, want %v", tc.Input, src, want.Source)
+		}
+		if !slices.Equal(m.Params, want.Params) {
+			t.Errorf("Parse(%q) params = %q, want %q", tc.Input, m.Params, want.Params)
+		}
+		wantTags := map[string]string{}
+		for k, v := range want.Tags {
+			if v != nil {
+				wantTags[k] = *v
+			} else {
+				wantTags[k] = ""
+			}
+		}
+		if got := m.Tags.Map(); !reflect.DeepEqual(got, wantTags) {
+			t.Errorf("Parse(%q) tags = %q, want %q", tc.Input, got, wantTags)
+		}
+	}
+}
+
+func TestConformance_MsgJoin(t *testing.T) {
+	var doc struct {
+		Tests []struct {
+			Desc    string   `yaml:"desc"`
+			Atoms   atoms    `yaml:"atoms"`
+			Matches []string `yaml:"matches"`
+		} `yaml:"tests"`
+	}
+	loadVectors(t, "msg-join.yaml", &doc)
+	if len(doc.Tests) == 0 {
+		t.Fatal("no vectors")
+	}
+
+	for _, tc := range doc.Tests {
+		m := Message{Command: tc.Atoms.Verb, Params: tc.Atoms.Params}
+		if tc.Atoms.Source != nil {
+			m.Source = ParseSource(*tc.Atoms.Source)
+		}
+		for k, v := range tc.Atoms.Tags {
+			val := ""
+			if v != nil {
+				val = *v
+			}
+			m.Tags = m.Tags.With(k, val)
+		}
+		if got := m.Format(); !slices.Contains(tc.Matches, got) {
+			t.Errorf("%s: Format = %q, want one of %q", tc.Desc, got, tc.Matches)
+		}
+	}
+}
+
+func TestConformance_UserhostSplit(t *testing.T) {
+	var doc struct {
+		Tests []struct {
+			Source string `yaml:"source"`
+			Atoms  struct {
+				Nick string `yaml:"nick"`
+				User string `yaml:"user"`
+				Host string `yaml:"host"`
+			} `yaml:"atoms"`
+		} `yaml:"tests"`
+	}
+	loadVectors(t, "userhost-split.yaml", &doc)
+	if len(doc.Tests) == 0 {
+		t.Fatal("no vectors")
+	}
+
+	for _, tc := range doc.Tests {
+		want := Source{Nick: tc.Atoms.Nick, User: tc.Atoms.User, Host: tc.Atoms.Host}
+		if got := ParseSource(tc.Source); got != want {
+			t.Errorf("ParseSource(%q) = %+v, want %+v", tc.Source, got, want)
+		}
+	}
+}
+
+// FuzzRoundTrip checks that Format writes back whatever Parse read:
+// Parse(Format(Parse(line))) must equal Parse(line).
+func FuzzRoundTrip(f *testing.F) {
+	f.Add(twitchPrivmsg)
+	f.Add("foo bar baz :")
+	f.Add("foo bar baz ::asdf")
+	f.Add(":src AWAY ")
+	f.Add("@c;h=;a=b :quux ab cd")
+	f.Add(":coolguy foo b\tar :  asdf quux ")
+	f.Fuzz(func(t *testing.T, line string) {
+		// CR, LF and NUL cannot appear inside a message
+		if strings.ContainsAny(line, "\r\n\x00") {
+			t.Skip()
+		}
+		m, err := Parse(line)
+		if err != nil {
+			return
+		}
+		out := m.Format()
+		again, err := Parse(out)
+		if err != nil {
+			t.Fatalf("Parse(Format(%q)) = %q: %v", line, out, err)
+		}
+		if !sameMessage(m, again) {
+			t.Fatalf("round trip of %q via %q:\n got %#v\nwant %#v", line, out, again, m)
+		}
+	})
+}
+
+func sameMessage(a, b *Message) bool {
+	return a.Tags == b.Tags && a.Source == b.Source && a.Command == b.Command &&
+		slices.Equal(a.Params, b.Params)
+}
@@ -0,0 +1,183 @@
+// Package ircmsg parses and formats IRCv3 message lines.
+//
+// Parsing does not copy: every string in a Message is a substring of the
+// line it came from, tags are decoded only when asked for, and ParseInto
+// reuses the Params slice, so a warmed-up Message parses without
+// allocating.
+package ircmsg
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrEmpty          = errors.New("ircmsg: empty line")
+	ErrMissingCommand = errors.New("ircmsg: missing command")
+	// ErrInvalidCommand is a command that would read back as tags or a
+	// source once formatted.
+	ErrInvalidCommand = errors.New("ircmsg: command starts with ':' or '@'")
+)
+
+// Message is one IRC line.
+type Message struct {
+	Tags    Tags
+	Source  Source // zero when the line has no :source
+	Command string
+	Params  []string // the last one may contain spaces
+}
+
+// Parse parses line into a new Message. A trailing "\r\n" is ignored.
+func Parse(line string) (*Message, error) {
+	m := new(Message)
+	if err := ParseInto(m, line); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ParseInto parses line into m, reusing m.Params' storage. On error m is
+// left in an unspecified state.
+func ParseInto(m *Message, line string) error {
+	line = strings.TrimRight(line, "\r\n")
+	m.Tags = ""
+	m.Source = Source{}
+	m.Command = ""
+	m.Params = m.Params[:0]
+
+	rest := skipSpaces(line)
+	if rest == "" {
+		return ErrEmpty
+	}
+	if rest[0] == '@' {
+		var tags string
+		tags, rest = word(rest[1:])
+		m.Tags = Tags(tags)
+	}
+	if rest != "" && rest[0] == ':' {
+		var src string
+		src, rest = word(rest[1:])
+		m.Source = ParseSource(src)
+	}
+	m.Command, rest = word(rest)
+	if m.Command == "" {
+		return ErrMissingCommand
+	}
+	if m.Command[0] == ':' || m.Command[0] == '@' {
+		return ErrInvalidCommand
+	}
+	for rest != "" {
+		if rest[0] == ':' {
+			m.Params = append(m.Params, rest[1:])
+			break
+		}
+		var p string
+		p, rest = word(rest)
+		m.Params = append(m.Params, p)
+	}
+	return nil
+}
+
+// word splits s at the first space and skips the spaces that follow.
+func word(s string) (string, string) {
+	i := strings.IndexByte(s, ' ')
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], skipSpaces(s[i+1:])
+}
+
+func skipSpaces(s string) string {
+	for len(s) > 0 && s[0] == ' ' {
+		s = s[1:]
+	}
+	return s
+}
+
+// Param returns the i-th parameter, or "" if there are fewer.
+func (m *Message) Param(i int) string {
+	if i < 0 || i >= len(m.Params) {
+		return ""
+	}
+	return m.Params[i]
+}
+
+// Trailing returns the last parameter, or "" if there are none.
+func (m *Message) Trailing() string {
+	return m.Param(len(m.Params) - 1)
+}
+
+// Format renders m as a line without the "\r\n" terminator. The last
+// parameter gets a ':' prefix when it needs one, and only then.
+func (m *Message) Format() string {
+	var b strings.Builder
+	n := len(m.Tags) + len(m.Source.Nick) + len(m.Source.User) + len(m.Source.Host) + len(m.Command) + 8
+	for _, p := range m.Params {
+		n += len(p) + 2
+	}
+	b.Grow(n)
+	if m.Tags != "" {
+		b.WriteByte('@')
+		b.WriteString(string(m.Tags))
+		b.WriteByte(' ')
+	}
+	if !m.Source.IsZero() {
+		b.WriteByte(':')
+		m.Source.write(&b)
+		b.WriteByte(' ')
+	}
+	b.WriteString(m.Command)
+	for i, p := range m.Params {
+		b.WriteByte(' ')
+		if i == len(m.Params)-1 && (p == "" || p[0] == ':' || strings.IndexByte(p, ' ') >= 0) {
+			b.WriteByte(':')
+		}
+		b.WriteString(p)
+	}
+	return b.String()
+}
+
+func (m *Message) String() string { return m.Format() }
+
+// Source is the origin of a message: "nick!user@host", or a server name,
+// which lands in Nick.
+type Source struct {
+	Nick string
+	User string
+	Host string
+}
+
+// ParseSource splits "nick!user@host"; user and host are optional.
+func ParseSource(s string) Source {
+	var src Source
+	if i := strings.IndexByte(s, '@'); i >= 0 {
+		src.Host = s[i+1:]
+		s = s[:i]
+	}
+	if i := strings.IndexByte(s, '!'); i >= 0 {
+		src.User = s[i+1:]
+		s = s[:i]
+	}
+	src.Nick = s
+	return src
+}
+
+func (s Source) IsZero() bool { return s == Source{} }
+
+func (s Source) String() string {
+	var b strings.Builder
+	s.write(&b)
+	return b.String()
+}
+
+func (s Source) write(b *strings.Builder) {
+	b.WriteString(s.Nick)
+	if s.User != "" {
+		b.WriteByte('!')
+		b.WriteString(s.User)
+	}
+	if s.Host != "" {
+		b.WriteByte('@')
+		b.WriteString(s.Host)
+	}
+}
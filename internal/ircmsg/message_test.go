@@ -0,0 +1,186 @@
+package ircmsg
+
+import (
+	"reflect"
+	"testing"
+)
+
+const twitchPrivmsg = `@badge-info=subscriber/12;badges=subscriber/12,premium/1;color=#1E90FF;display-name=SomeUser;emotes=25:0-4;first-msg=0;flags=;id=b34ccfc7-4977-403a-8a94-33c6bac34fb8;mod=0;room-id=1337;subscriber=1;tmi-sent-ts=1700000000000;turbo=0;user-id=12345;user-type= :someuser!someuser@someuser.tmi.twitch.tv PRIVMSG #chess :Kappa nice move\swell played`
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		line string
+		want Message
+	}{
+		{"PING :tmi.twitch.tv", Message{Command: "PING", Params: []string{"tmi.twitch.tv"}}},
+		{":tmi.twitch.tv 001 me :Welcome, GLHF!\r\n", Message{
+			Source: Source{Nick: "tmi.twitch.tv"}, Command: "001", Params: []string{"me", "Welcome, GLHF!"},
+		}},
+		{":me!me@me.tmi.twitch.tv JOIN #chess", Message{
+			Source: Source{Nick: "me", User: "me", Host: "me.tmi.twitch.tv"}, Command: "JOIN", Params: []string{"#chess"},
+		}},
+		{"@slow=10 :tmi.twitch.tv ROOMSTATE #chess", Message{
+			Tags: "slow=10", Source: Source{Nick: "tmi.twitch.tv"}, Command: "ROOMSTATE", Params: []string{"#chess"},
+		}},
+		{"CMD a  b   :", Message{Command: "CMD", Params: []string{"a", "b", ""}}},
+		{"CMD a ::b c ", Message{Command: "CMD", Params: []string{"a", ":b c "}}},
+		{"CMD a:b ", Message{Command: "CMD", Params: []string{"a:b"}}},
+	}
+	for _, tc := range cases {
+		got, err := Parse(tc.line)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tc.line, err)
+		}
+		if len(got.Params) == 0 {
+			got.Params = nil
+		}
+		if !reflect.DeepEqual(*got, tc.want) {
+			t.Errorf("Parse(%q) = %+v, want %+v", tc.line, *got, tc.want)
+		}
+	}
+
+	for _, bad := range []string{"", "  ", "@a=b", ":src", "@a=b :src ", ": :x y"} {
+		if _, err := Parse(bad); err == nil {
+			t.Errorf("Parse(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestTags(t *testing.T) {
+	m, err := Parse(twitchPrivmsg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := m.Tags.Get("user-id"); !ok || v != "12345" {
+		t.Fatalf("user-id = %q, %v", v, ok)
+	}
+	if v, ok := m.Tags.Get("flags"); !ok || v != "" {
+		t.Fatalf("empty tag = %q, %v", v, ok)
+	}
+	if m.Tags.Has("missing") {
+		t.Fatal("missing tag reported present")
+	}
+	if got := m.Trailing(); got != `Kappa nice move\swell played` {
+		t.Fatalf("trailing = %q; params are not tag-unescaped", got)
+	}
+
+	tags := Tags(`a=b\\and\nk;c=72\s45;d=gh\:764;e;a=last;bad=x\y\`)
+	want := map[string]string{"a": "last", "c": "72 45", "d": "gh;764", "e": "", "bad": "xy"}
+	if got := tags.Map(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Map = %q, want %q", got, want)
+	}
+}
+
+func TestParseSource(t *testing.T) {
+	cases := map[string]Source{
+		"alice!alice@alice.tmi.twitch.tv": {Nick: "alice", User: "alice", Host: "alice.tmi.twitch.tv"},
+		"tmi.twitch.tv":                   {Nick: "tmi.twitch.tv"},
+		"nick@host":                       {Nick: "nick", Host: "host"},
+		"":                                {},
+	}
+	for in, want := range cases {
+		if got := ParseSource(in); got != want {
+			t.Errorf("ParseSource(%q) = %+v, want %+v", in, got, want)
+		}
+		if got := ParseSource(in).String(); got != in {
+			t.Errorf("String() = %q, want %q", got, in)
+		}
+	}
+}
+
+func FuzzUnescapeTagValue(f *testing.F) {
+	for _, s := range []string{``, `\\`, `\s\:\;`, `a\b\c`, `hello\nworld`, `x\`} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		u := UnescapeTagValue(s)
+		if got := UnescapeTagValue(EscapeTagValue(u)); got != u {
+			t.Fatalf("escape round trip of %q = %q", u, got)
+		}
+	})
+}
+
+func TestTagsWith(t *testing.T) {
+	tags := Tags("a=1;b=2").With("a", "x; y\\z").With("c", "")
+	if tags != `b=2;a=x\:\sy\\z;c` {
+		t.Fatalf("With = %q", tags)
+	}
+	if v := tags.Value("a"); v != "x; y\\z" {
+		t.Fatalf("round trip = %q", v)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	cases := []struct {
+		m    Message
+		want string
+	}{
+		{Message{Command: "PONG", Params: []string{"tmi.twitch.tv"}}, "PONG tmi.twitch.tv"},
+		{Message{Command: "PRIVMSG", Params: []string{"#chess", "hello there"}}, "PRIVMSG #chess :hello there"},
+		{Message{Command: "CMD", Params: []string{"a", ""}}, "CMD a :"},
+		{Message{Command: "CMD", Params: []string{":a"}}, "CMD ::a"},
+		{Message{
+			Tags:    Tags("").With("id", "1 2"),
+			Source:  Source{Nick: "n", User: "u", Host: "h"},
+			Command: "NOTICE",
+			Params:  []string{"#c", "x"},
+		}, `@id=1\s2 :n!u@h NOTICE #c x`},
+	}
+	for _, tc := range cases {
+		if got := tc.m.Format(); got != tc.want {
+			t.Errorf("Format(%+v) = %q, want %q", tc.m, got, tc.want)
+		}
+	}
+}
+
+func TestParseInto_NoAllocs(t *testing.T) {
+	var m Message
+	_ = ParseInto(&m, twitchPrivmsg) // size Params once
+	allocs := testing.AllocsPerRun(100, func() {
+		if err := ParseInto(&m, twitchPrivmsg); err != nil {
+			t.Fatal(err)
+		}
+		_ = m.Tags.Value("user-id")
+		_ = m.Tags.Value("room-id")
+		_ = m.Tags.Value("id")
+	})
+	if allocs != 0 {
+		t.Fatalf("ParseInto + tag reads allocated %.0f times per line", allocs)
+	}
+}
+
+func BenchmarkParseInto(b *testing.B) {
+	var m Message
+	b.ReportAllocs()
+	b.SetBytes(int64(len(twitchPrivmsg)))
+	for b.Loop() {
+		_ = ParseInto(&m, twitchPrivmsg)
+		_ = m.Tags.Value("user-id")
+		_ = m.Tags.Value("room-id")
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	b.ReportAllocs()
+	for b.Loop() {
+		_, _ = Parse(twitchPrivmsg)
+	}
+}
+
+// BenchmarkTagsMap is the cost of decoding every tag up front, which is
+// what the classifier used to do for each line.
+func BenchmarkTagsMap(b *testing.B) {
+	m, _ := Parse(twitchPrivmsg)
+	b.ReportAllocs()
+	for b.Loop() {
+		_ = m.Tags.Map()
+	}
+}
+
+func BenchmarkFormat(b *testing.B) {
+	m, _ := Parse(twitchPrivmsg)
+	b.ReportAllocs()
+	for b.Loop() {
+		_ = m.Format()
+	}
+}
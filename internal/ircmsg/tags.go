@@ -0,0 +1,150 @@
+package ircmsg
+
+import (
+	"iter"
+	"strings"
+)
+
+// Tags is the raw, still escaped tag section of a message, without the
+// leading '@': "key=value;key2=value2". Values are decoded on access.
+// Keys without a value read as "", and a key given twice reads as its last
+// value.
+type Tags string
+
+// Get returns the unescaped value of key. Values without escapes are
+// returned without copying.
+func (t Tags) Get(key string) (string, bool) {
+	var raw string
+	found := false
+	for s := string(t); s != ""; {
+		var pair string
+		pair, s, _ = strings.Cut(s, ";")
+		k, v, _ := strings.Cut(pair, "=")
+		if k == key {
+			raw, found = v, true
+		}
+	}
+	if !found {
+		return "", false
+	}
+	return UnescapeTagValue(raw), true
+}
+
+// Value is Get without the presence flag.
+func (t Tags) Value(key string) string {
+	v, _ := t.Get(key)
+	return v
+}
+
+func (t Tags) Has(key string) bool {
+	_, ok := t.Get(key)
+	return ok
+}
+
+// All yields every tag in order with its value unescaped. Repeated keys
+// are yielded each time they occur.
+func (t Tags) All() iter.Seq2[string, string] {
+	return func(yield func(string, string) bool) {
+		for s := string(t); s != ""; {
+			var pair string
+			pair, s, _ = strings.Cut(s, ";")
+			if pair == "" {
+				continue
+			}
+			k, v, _ := strings.Cut(pair, "=")
+			if !yield(k, UnescapeTagValue(v)) {
+				return
+			}
+		}
+	}
+}
+
+// Map decodes every tag; later duplicates win.
+func (t Tags) Map() map[string]string {
+	m := make(map[string]string)
+	for k, v := range t.All() {
+		m[k] = v
+	}
+	return m
+}
+
+// With returns t with key set to value, replacing any existing value.
+// An empty value is written as a bare key.
+func (t Tags) With(key, value string) Tags {
+	var b strings.Builder
+	for s := string(t); s != ""; {
+		var pair string
+		pair, s, _ = strings.Cut(s, ";")
+		if k, _, _ := strings.Cut(pair, "="); k == key || pair == "" {
+			continue
+		}
+		b.WriteString(pair)
+		b.WriteByte(';')
+	}
+	b.WriteString(key)
+	if value != "" {
+		b.WriteByte('=')
+		b.WriteString(EscapeTagValue(value))
+	}
+	return Tags(b.String())
+}
+
+// UnescapeTagValue decodes the IRCv3 escapes \: \s \\ \r \n. An unknown
+// escape drops the backslash, and so does a trailing one.
+func UnescapeTagValue(s string) string {
+	if strings.IndexByte(s, '\\') < 0 {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		if i == len(s) {
+			break
+		}
+		switch s[i] {
+		case ':':
+			b.WriteByte(';')
+		case 's':
+			b.WriteByte(' ')
+		case 'r':
+			b.WriteByte('\r')
+		case 'n':
+			b.WriteByte('\n')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// EscapeTagValue is the inverse of UnescapeTagValue.
+func EscapeTagValue(s string) string {
+	if strings.IndexAny(s, "; \\\r\n") < 0 {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s) + 4)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case ';':
+			b.WriteString(`\:`)
+		case ' ':
+			b.WriteString(`\s`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\n':
+			b.WriteString(`\n`)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
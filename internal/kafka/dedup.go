@@ -0,0 +1,104 @@
+package kafka
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/dedup"
+)
+
+type MessageReader interface {
+	FetchMessage(ctx context.Context) (kafkago.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafkago.Message) error
+}
+
+// DedupCounters are cumulative and safe to read while Deduplicate runs.
+type DedupCounters struct {
+	Forwarded atomic.Uint64 // written to the output topic
+	Dropped   atomic.Uint64 // duplicates not written
+	NoID      atomic.Uint64 // forwarded without a message id to key on
+}
+
+// dedupBatch bounds how many records Deduplicate writes and commits at a
+// time; once it has one record it waits at most dedupLinger for more.
+const (
+	dedupBatch  = 500
+	dedupLinger = 20 * time.Millisecond
+)
+
+// Deduplicate copies records from r to w, dropping any whose message id is
+// already in cache. Records without an id are passed through. Records are
+// written and their offsets committed in batches, and a batch is committed
+// only after its records were written or deliberately dropped, so a crash
+// re-delivers rather than loses.
+func Deduplicate(ctx context.Context, r MessageReader, w MessageWriter, cache *dedup.Cache, counters *DedupCounters) error {
+	fetched := make([]kafkago.Message, 0, dedupBatch)
+	out := make([]kafkago.Message, 0, dedupBatch)
+	for {
+		m, err := r.FetchMessage(ctx)
+		if err != nil {
+			return err
+		}
+
+		fetched, out = fetched[:0], out[:0]
+		linger, cancel := context.WithTimeout(ctx, dedupLinger)
+		for {
+			fetched = append(fetched, m)
+			id := messageID(m)
+			switch {
+			case id == "":
+				counters.NoID.Add(1)
+				out = append(out, forward(m))
+			case cache.Duplicate(id, time.Now()):
+				counters.Dropped.Add(1)
+			default:
+				out = append(out, forward(m))
+			}
+			if len(fetched) == dedupBatch {
+				break
+			}
+			if m, err = r.FetchMessage(linger); err != nil {
+				break
+			}
+		}
+		lingered := linger.Err() != nil && ctx.Err() == nil
+		cancel()
+
+		if len(out) > 0 {
+			if err := w.WriteMessages(ctx, out...); err != nil {
+				return fmt.Errorf("write: %w", err)
+			}
+			counters.Forwarded.Add(uint64(len(out)))
+		}
+		if err := r.CommitMessages(ctx, fetched...); err != nil {
+			return fmt.Errorf("commit: %w", err)
+		}
+		if err != nil && !lingered {
+			return err
+		}
+	}
+}
+
+func forward(m kafkago.Message) kafkago.Message {
+	return kafkago.Message{Key: m.Key, Value: m.Value, Headers: m.Headers, Time: m.Time}
+}
+
+// messageID prefers the producer's header and falls back to the event's
+// ID field for records written before headers existed.
+func messageID(m kafkago.Message) string {
+	for _, h := range m.Headers {
+		if h.Key == HeaderMessageID {
+			return string(h.Value)
+		}
+	}
+	var v struct{ ID string }
+	if json.Unmarshal(m.Value, &v) != nil {
+		return ""
+	}
+	return v.ID
+}
@@ -0,0 +1,109 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/dedup"
+)
+
+type sliceReader struct {
+	msgs      []kafkago.Message
+	committed int
+	commits   int
+	block     bool // wait for ctx once empty instead of failing
+}
+
+func (r *sliceReader) FetchMessage(ctx context.Context) (kafkago.Message, error) {
+	if len(r.msgs) == 0 {
+		if r.block {
+			<-ctx.Done()
+			return kafkago.Message{}, ctx.Err()
+		}
+		return kafkago.Message{}, context.Canceled
+	}
+	m := r.msgs[0]
+	r.msgs = r.msgs[1:]
+	return m, nil
+}
+
+func (r *sliceReader) CommitMessages(_ context.Context, msgs ...kafkago.Message) error {
+	r.committed += len(msgs)
+	r.commits++
+	return nil
+}
+
+type sliceWriter struct {
+	msgs   []kafkago.Message
+	writes int
+}
+
+func (w *sliceWriter) WriteMessages(_ context.Context, msgs ...kafkago.Message) error {
+	w.msgs = append(w.msgs, msgs...)
+	w.writes++
+	return nil
+}
+
+func (w *sliceWriter) Close() error { return nil }
+
+func TestDeduplicate_DropsRepeatedIDs(t *testing.T) {
+	withHeader := func(id string) kafkago.Message {
+		return kafkago.Message{Value: []byte(`{}`), Headers: []kafkago.Header{{Key: HeaderMessageID, Value: []byte(id)}}}
+	}
+	r := &sliceReader{msgs: []kafkago.Message{
+		withHeader("m1"),
+		withHeader("m1"), // same message from the second collector
+		{Value: []byte(`{"ID":"m2","Text":"hi"}`)},
+		{Value: []byte(`{"ID":"m2","Text":"hi"}`)},
+		{Value: []byte(`{"UserID":"1","Op":"JOIN"}`)},
+	}}
+	w := &sliceWriter{}
+	var counters DedupCounters
+
+	err := Deduplicate(context.Background(), r, w, dedup.New(100, time.Minute), &counters)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v", err)
+	}
+	if len(w.msgs) != 3 || counters.Forwarded.Load() != 3 || counters.Dropped.Load() != 2 || counters.NoID.Load() != 1 {
+		t.Fatalf("wrote %d; forwarded=%d dropped=%d noid=%d", len(w.msgs),
+			counters.Forwarded.Load(), counters.Dropped.Load(), counters.NoID.Load())
+	}
+	if r.committed != 5 {
+		t.Fatalf("committed %d, want every record", r.committed)
+	}
+}
+
+func TestDeduplicate_Batches(t *testing.T) {
+	r := &sliceReader{}
+	for i := range 2*dedupBatch + 10 {
+		r.msgs = append(r.msgs, kafkago.Message{Headers: []kafkago.Header{{Key: HeaderMessageID, Value: []byte(fmt.Sprint(i))}}})
+	}
+	w := &sliceWriter{}
+	var counters DedupCounters
+	_ = Deduplicate(context.Background(), r, w, dedup.New(10*dedupBatch, time.Minute), &counters)
+	if w.writes != 3 || r.commits != 3 || len(w.msgs) != 2*dedupBatch+10 || r.committed != len(w.msgs) {
+		t.Fatalf("%d writes of %d records, %d commits of %d offsets; want 3 batches of everything",
+			w.writes, len(w.msgs), r.commits, r.committed)
+	}
+
+	// A partial batch goes out once the stream pauses, not when it resumes.
+	r = &sliceReader{block: true, msgs: r.msgs[:0]}
+	for _, id := range []string{"a", "b", "a"} {
+		r.msgs = append(r.msgs, kafkago.Message{Headers: []kafkago.Header{{Key: HeaderMessageID, Value: []byte(id)}}})
+	}
+	w = &sliceWriter{}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*dedupLinger)
+	defer cancel()
+	err := Deduplicate(ctx, r, w, dedup.New(100, time.Minute), &DedupCounters{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v", err)
+	}
+	if w.writes != 1 || len(w.msgs) != 2 || r.commits != 1 || r.committed != 3 {
+		t.Fatalf("%d writes of %d records, %d commits of %d offsets; want one batch", w.writes, len(w.msgs), r.commits, r.committed)
+	}
+}
@@ -2,30 +2,70 @@ package kafka
 
 import (
 	"context"
+	"fmt"
 	"log"
 
 	kafkago "github.com/segmentio/kafka-go"
 
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/deadletter"
 	ircevents "github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/irc_events"
 )
 
-func KafkaProducer(ctx context.Context, writer MessageWriter, parseCh <-chan ircevents.Event) {
+// Headers set on every produced record.
+const (
+	HeaderKind      = "kind"
+	HeaderMessageID = "message-id"
+)
+
+// Route sends events of one Kind to their own writer instead of the
+// default one. A nil Writer drops them.
+type Route struct {
+	Kind   string
+	Writer MessageWriter
+}
+
+// KafkaProducer writes each event from parseCh until ctx ends or parseCh
+// is closed. Events that cannot be marshalled or written are sampled into
+// dead, which may be nil.
+func KafkaProducer(ctx context.Context, writer MessageWriter, parseCh <-chan ircevents.Event, dead *deadletter.Box, routes ...Route) {
+	byKind := make(map[string]MessageWriter, len(routes))
+	for _, r := range routes {
+		byKind[r.Kind] = r.Writer
+	}
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case evt := <-parseCh:
+		case evt, ok := <-parseCh:
+			if !ok {
+				return
+			}
+			w, routed := byKind[evt.Kind()]
+			if !routed {
+				w = writer
+			}
+			if w == nil {
+				continue
+			}
 			value, err := evt.Marshal()
 			if err != nil {
 				log.Println("marshal error:", err)
+				dead.Drop("producer", "marshal "+evt.Kind()+": "+err.Error(), fmt.Sprintf("%+v", evt))
 				continue
 			}
 			msg := kafkago.Message{
-				Key:   []byte(evt.Key()),
-				Value: value,
+				Key:     []byte(evt.Key()),
+				Value:   value,
+				Headers: []kafkago.Header{{Key: HeaderKind, Value: []byte(evt.Kind())}},
+			}
+			if idr, ok := evt.(ircevents.Identified); ok && idr.MessageID() != "" {
+				msg.Headers = append(msg.Headers, kafkago.Header{Key: HeaderMessageID, Value: []byte(idr.MessageID())})
 			}
-			if err := writer.WriteMessages(ctx, msg); err != nil {
+			if err := w.WriteMessages(ctx, msg); err != nil {
 				log.Println("kafka write error:", err)
+				if ctx.Err() == nil {
+					dead.Drop("producer", "write "+evt.Kind()+": "+err.Error(), string(value))
+				}
 			}
 		}
 	}
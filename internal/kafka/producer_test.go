@@ -0,0 +1,82 @@
+package kafka
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+
+	ircevents "github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/irc_events"
+)
+
+type recordingWriter struct {
+	mu   sync.Mutex
+	msgs []kafkago.Message
+}
+
+func (w *recordingWriter) WriteMessages(_ context.Context, msgs ...kafkago.Message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.msgs = append(w.msgs, msgs...)
+	return nil
+}
+
+func (w *recordingWriter) Close() error { return nil }
+
+func (w *recordingWriter) kinds() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var out []string
+	for _, m := range w.msgs {
+		for _, h := range m.Headers {
+			if h.Key == HeaderKind {
+				out = append(out, string(h.Value))
+			}
+		}
+	}
+	return out
+}
+
+func TestKafkaProducer_Routes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	run := func(routes ...Route) *recordingWriter {
+		main := &recordingWriter{}
+		parseCh := make(chan ircevents.Event)
+		go KafkaProducer(ctx, main, parseCh, nil, routes...)
+		parseCh <- ircevents.PrivMsg{ID: "1", ChannelID: "9"}
+		parseCh <- ircevents.Whisper{ID: "2", ThreadID: "1_2"}
+		parseCh <- ircevents.PrivMsg{ID: "3", ChannelID: "9"} // flushes the whisper
+		return main
+	}
+
+	whispers := &recordingWriter{}
+	main := run(Route{Kind: "whisper", Writer: whispers})
+	waitFor(t, func() bool { return len(main.kinds()) == 2 })
+	if got := whispers.kinds(); len(got) != 1 || got[0] != "whisper" {
+		t.Fatalf("whisper writer got %v", got)
+	}
+	if got := main.kinds(); got[0] != "privmsg" || got[1] != "privmsg" {
+		t.Fatalf("default writer got %v", got)
+	}
+
+	main = run(Route{Kind: "whisper"}) // nil writer drops
+	waitFor(t, func() bool { return len(main.kinds()) == 2 })
+	if got := main.kinds(); got[0] != "privmsg" || got[1] != "privmsg" {
+		t.Fatalf("dropped whisper reached default writer: %v", got)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
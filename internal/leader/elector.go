@@ -0,0 +1,150 @@
+package leader
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/healthcheck"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/observe"
+)
+
+const (
+	RoleLeader  = "leader"
+	RoleStandby = "standby"
+)
+
+type State struct {
+	Role     string
+	Identity string
+	Holder   string    // current leader as recorded in the lease, if known
+	Since    time.Time // when Role last changed
+}
+
+// Elector keeps trying to take a Lease and reports whether this replica
+// should be active. It satisfies channelrecord.Gate.
+type Elector struct {
+	lease    Lease
+	id       string
+	interval time.Duration
+
+	mu      sync.RWMutex
+	st      State
+	changes chan struct{}
+	lg      *slog.Logger
+}
+
+func NewElector(lease Lease, id string, interval time.Duration) *Elector {
+	return &Elector{
+		lease:    lease,
+		id:       id,
+		interval: interval,
+		st:       State{Role: RoleStandby, Identity: id, Since: time.Now().UTC()},
+		changes:  make(chan struct{}, 1),
+		lg:       observe.C("leader").With("identity", id),
+	}
+}
+
+func (e *Elector) Run(ctx context.Context) error {
+	t := time.NewTicker(e.interval)
+	defer t.Stop()
+	e.lg.Info("elector starting", "interval_s", e.interval.Seconds())
+
+	for {
+		e.step()
+		select {
+		case <-ctx.Done():
+			if e.Active() {
+				if err := e.lease.Release(); err != nil {
+					e.lg.Warn("lease release failed", "err", err)
+				} else {
+					e.lg.Info("lease released")
+				}
+			}
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+func (e *Elector) step() {
+	if e.Active() {
+		held, err := e.lease.Held()
+		if err != nil {
+			// can't tell; keep leading rather than flap on a transient error
+			e.lg.Warn("lease check failed", "err", err)
+			return
+		}
+		if !held {
+			_ = e.lease.Release()
+			e.set(RoleStandby, "")
+		}
+		return
+	}
+
+	ok, err := e.lease.TryAcquire()
+	if err != nil {
+		e.lg.Warn("lease acquire failed", "err", err)
+	}
+	if ok {
+		e.set(RoleLeader, e.id)
+		return
+	}
+	holder, err := e.lease.Holder()
+	if err != nil {
+		e.lg.Debug("lease holder unknown", "err", err)
+	}
+	e.mu.Lock()
+	e.st.Holder = holder
+	e.mu.Unlock()
+}
+
+func (e *Elector) set(role, holder string) {
+	e.mu.Lock()
+	prev := e.st.Role
+	e.st.Role = role
+	e.st.Holder = holder
+	e.st.Since = time.Now().UTC()
+	e.mu.Unlock()
+
+	e.lg.Info("role transition", "from", prev, "to", role)
+	select {
+	case e.changes <- struct{}{}:
+	default:
+	}
+}
+
+// Active reports whether this replica holds the lease.
+func (e *Elector) Active() bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.st.Role == RoleLeader
+}
+
+// Changes signals (coalesced) whenever Active flips.
+func (e *Elector) Changes() <-chan struct{} {
+	return e.changes
+}
+
+func (e *Elector) State() State {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.st
+}
+
+// ReadinessCheck reports the lease state on /readyz. A standby is still
+// ready: it is connected and able to take over.
+func (e *Elector) ReadinessCheck() healthcheck.Check {
+	return healthcheck.Check{Name: "lease", Fn: func() (string, bool) {
+		st := e.State()
+		if st.Role == RoleLeader {
+			return "leader since " + st.Since.Format(time.RFC3339), true
+		}
+		holder := st.Holder
+		if holder == "" {
+			holder = "unknown"
+		}
+		return "standby (leader: " + holder + ")", true
+	}}
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package leader
+
+import (
+	"errors"
+	"os"
+)
+
+func tryLock(*os.File) (bool, error) {
+	return false, errors.ErrUnsupported
+}
+
+func unlock(*os.File) error { return nil }
@@ -0,0 +1,118 @@
+package leader
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Lease is a mutual-exclusion token shared by redundant collectors.
+type Lease interface {
+	// TryAcquire takes the lease if nobody holds it, without blocking.
+	TryAcquire() (bool, error)
+	// Held reports whether a lease acquired earlier is still ours.
+	Held() (bool, error)
+	// Holder returns the identity of the current holder, if known.
+	Holder() (string, error)
+	Release() error
+}
+
+// FileLease is an exclusive lock on a file, typically on a volume shared by
+// the replicas. The kernel drops the lock when the holder exits, so a
+// crashed leader cannot wedge the standby.
+type FileLease struct {
+	path string
+	id   string
+
+	mu sync.Mutex
+	f  *os.File // open while held
+}
+
+func NewFileLease(path, id string) (*FileLease, error) {
+	if path == "" {
+		return nil, errors.New("leader: empty lease path")
+	}
+	if id == "" {
+		return nil, errors.New("leader: empty identity")
+	}
+	return &FileLease{path: path, id: id}, nil
+}
+
+func (l *FileLease) TryAcquire() (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f != nil {
+		return true, nil
+	}
+
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return false, fmt.Errorf("open lease %s: %w", l.path, err)
+	}
+	ok, err := tryLock(f)
+	if err != nil || !ok {
+		_ = f.Close()
+		return false, err
+	}
+
+	// Record who holds it so standbys can report the leader.
+	stamp := l.id + " " + time.Now().UTC().Format(time.RFC3339) + "\n"
+	if err := f.Truncate(0); err == nil {
+		_, _ = f.WriteAt([]byte(stamp), 0)
+		_ = f.Sync()
+	}
+	l.f = f
+	return true, nil
+}
+
+// Held fails once the lease file has been deleted or replaced, since
+// another replica could then lock the new file.
+func (l *FileLease) Held() (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return false, nil
+	}
+	ours, err := l.f.Stat()
+	if err != nil {
+		return false, err
+	}
+	cur, err := os.Stat(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(ours, cur), nil
+}
+
+func (l *FileLease) Holder() (string, error) {
+	b, err := os.ReadFile(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	id, _, _ := strings.Cut(strings.TrimSpace(string(b)), " ")
+	return id, nil
+}
+
+func (l *FileLease) Release() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	f := l.f
+	l.f = nil
+	if err := unlock(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,140 @@
+// Package metrics is a minimal counter/gauge registry exposed in the
+// Prometheus text format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	mu       sync.Mutex
+	families = map[string]*family{}
+)
+
+type family struct {
+	name, help, kind, label string
+
+	mu     sync.Mutex
+	series map[string]*atomic.Int64 // by label value ("" when unlabelled)
+}
+
+func register(name, help, kind, label string) *family {
+	mu.Lock()
+	defer mu.Unlock()
+	if f, ok := families[name]; ok {
+		if f.kind != kind || f.label != label {
+			panic("metrics: " + name + " re-registered with a different shape")
+		}
+		return f
+	}
+	f := &family{name: name, help: help, kind: kind, label: label, series: map[string]*atomic.Int64{}}
+	families[name] = f
+	return f
+}
+
+func (f *family) get(value string) *atomic.Int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	v, ok := f.series[value]
+	if !ok {
+		v = new(atomic.Int64)
+		f.series[value] = v
+	}
+	return v
+}
+
+// Counter only goes up.
+type Counter struct{ v *atomic.Int64 }
+
+func (c Counter) Inc()        { c.v.Add(1) }
+func (c Counter) Add(n int64) { c.v.Add(n) }
+func (c Counter) Value() int64 {
+	return c.v.Load()
+}
+
+// Gauge can be set to any value.
+type Gauge struct{ v *atomic.Int64 }
+
+func (g Gauge) Set(n int64) { g.v.Store(n) }
+func (g Gauge) Add(n int64) { g.v.Add(n) }
+func (g Gauge) Value() int64 {
+	return g.v.Load()
+}
+
+// NewCounter registers (or returns the existing) unlabelled counter.
+func NewCounter(name, help string) Counter {
+	return Counter{register(name, help, "counter", "").get("")}
+}
+
+func NewGauge(name, help string) Gauge {
+	return Gauge{register(name, help, "gauge", "").get("")}
+}
+
+// CounterVec is a counter family split by a single label.
+type CounterVec struct{ f *family }
+
+func NewCounterVec(name, help, label string) CounterVec {
+	return CounterVec{register(name, help, "counter", label)}
+}
+
+func (v CounterVec) With(value string) Counter { return Counter{v.f.get(value)} }
+
+type GaugeVec struct{ f *family }
+
+func NewGaugeVec(name, help, label string) GaugeVec {
+	return GaugeVec{register(name, help, "gauge", label)}
+}
+
+func (v GaugeVec) With(value string) Gauge { return Gauge{v.f.get(value)} }
+
+// Write renders every registered metric.
+func Write(w io.Writer) error {
+	mu.Lock()
+	names := make([]string, 0, len(families))
+	for n := range families {
+		names = append(names, n)
+	}
+	mu.Unlock()
+	sort.Strings(names)
+
+	for _, n := range names {
+		mu.Lock()
+		f := families[n]
+		mu.Unlock()
+
+		f.mu.Lock()
+		values := make([]string, 0, len(f.series))
+		for v := range f.series {
+			values = append(values, v)
+		}
+		sort.Strings(values)
+		var b strings.Builder
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+		for _, v := range values {
+			if f.label == "" {
+				fmt.Fprintf(&b, "%s %d\n", f.name, f.series[v].Load())
+			} else {
+				fmt.Fprintf(&b, "%s{%s=%q} %d\n", f.name, f.label, v, f.series[v].Load())
+			}
+		}
+		f.mu.Unlock()
+		if _, err := io.WriteString(w, b.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler serves Write over HTTP.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_ = Write(w)
+	})
+}
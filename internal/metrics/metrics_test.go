@@ -0,0 +1,32 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWrite_PrometheusText(t *testing.T) {
+	c := NewCounterVec("test_lines_total", "Lines.", "class")
+	c.With("join").Add(3)
+	c.With("message").Inc()
+	NewGauge("test_depth", "Depth.").Set(7)
+
+	var b strings.Builder
+	if err := Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		"# TYPE test_depth gauge\ntest_depth 7\n",
+		"# HELP test_lines_total Lines.\n# TYPE test_lines_total counter\n",
+		`test_lines_total{class="join"} 3` + "\n",
+		`test_lines_total{class="message"} 1` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("output missing %q:\n%s", want, out)
+		}
+	}
+	if NewCounterVec("test_lines_total", "Lines.", "class").With("join").Value() != 3 {
+		t.Fatal("re-registering should return the existing family")
+	}
+}
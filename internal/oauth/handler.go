@@ -18,7 +18,7 @@ func Index(w http.ResponseWriter, r *http.Request) {
 	redirectURI := os.Getenv("TWITCH_REDIRECT_URI")
 
 	authURL := fmt.Sprintf(
-		"https://id.twitch.tv/oauth2/authorize?client_id=%s&redirect_uri=%s&response_type=code&scope=chat:read",
+		"https://id.twitch.tv/oauth2/authorize?client_id=%s&redirect_uri=%s&response_type=code&scope=chat:read%%20chat:edit%%20whispers:read",
 		clientID, redirectURI)
 
 	lg.Info("oauth index hit", "remote", r.RemoteAddr)
@@ -0,0 +1,388 @@
+// Package outbound rate-limits everything written to the IRC socket so the
+// collector stays inside Twitch's command limits no matter which stage
+// produced the line.
+package outbound
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/metrics"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/observe"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/types"
+)
+
+// Limits are Twitch's documented chat limits for one account.
+type Limits struct {
+	Joins      int // JOINed channels per JoinWindow
+	JoinWindow time.Duration
+
+	Messages         int // PRIVMSGs per MessageWindow
+	ElevatedMessages int // same, when sending to a channel where we are broadcaster, moderator or VIP
+	MessageWindow    time.Duration
+
+	QueueSize int // per class; further lines are dropped
+}
+
+func DefaultLimits() Limits {
+	return Limits{
+		Joins:            20,
+		JoinWindow:       10 * time.Second,
+		Messages:         20,
+		ElevatedMessages: 100,
+		MessageWindow:    30 * time.Second,
+		QueueSize:        1000,
+	}
+}
+
+// VerifiedBotLimits are the higher limits Twitch grants verified bots.
+func VerifiedBotLimits() Limits {
+	l := DefaultLimits()
+	l.Joins = 2000
+	l.Messages = 7500
+	l.ElevatedMessages = 7500
+	return l
+}
+
+type class int
+
+const (
+	classPriority class = iota // PONG and other keepalive/auth lines, never limited
+	classOther
+	classJoin
+	classMessage
+	numClasses
+)
+
+func (c class) String() string {
+	switch c {
+	case classPriority:
+		return "priority"
+	case classJoin:
+		return "join"
+	case classMessage:
+		return "message"
+	default:
+		return "other"
+	}
+}
+
+var (
+	linesSent = metrics.NewCounterVec("irc_outbound_lines_total",
+		"Lines written to the IRC socket.", "class")
+	linesThrottled = metrics.NewCounterVec("irc_outbound_throttled_total",
+		"Lines that had to wait for a rate-limit window.", "class")
+	linesDropped = metrics.NewCounterVec("irc_outbound_dropped_total",
+		"Lines dropped because the outbound queue was full.", "class")
+	queueDepth = metrics.NewGaugeVec("irc_outbound_queue_depth",
+		"Lines waiting in the outbound limiter.", "class")
+)
+
+type queued struct {
+	line      string
+	channel   string // PRIVMSG target
+	text      string // PRIVMSG text
+	cost      int    // channels joined by a JOIN
+	throttled bool   // already counted as throttled
+}
+
+type Limiter struct {
+	limits   Limits
+	joins    *window
+	messages *window
+	elevated map[string]bool
+	queues   [numClasses][]queued
+	resets   chan struct{}
+	reports  []types.ChatSignal // PRIVMSGs sent or dropped, not yet reported
+	now      func() time.Time
+	lg       *slog.Logger
+}
+
+func New(limits Limits) *Limiter {
+	return &Limiter{
+		limits:   limits,
+		joins:    newWindow(limits.JoinWindow),
+		messages: newWindow(limits.MessageWindow),
+		elevated: make(map[string]bool),
+		resets:   make(chan struct{}, 1),
+		now:      time.Now,
+		lg:       observe.C("outbound"),
+	}
+}
+
+// Reset drops the queued JOINs and PRIVMSGs; call it when the connection
+// they were meant for is lost. The rectifier rejoins on the next one, and
+// each dropped PRIVMSG is reported to Run's chat channel. Safe to call
+// from any goroutine.
+func (l *Limiter) Reset() {
+	select {
+	case l.resets <- struct{}{}:
+	default:
+		// a reset is already pending
+	}
+}
+
+// Run moves lines from in to out, holding back JOINs and PRIVMSGs that
+// would exceed the limits. out should be unbuffered so that a PONG queued
+// behind other lines still goes first. Each PRIVMSG is reported on chat
+// as ChatSent once written or ChatUnsent if dropped. roles and chat may be
+// nil. Run returns when ctx is done or in is closed.
+func (l *Limiter) Run(ctx context.Context, in <-chan string, roles <-chan types.UserState, out chan<- string, chat chan<- types.ChatSignal) error {
+	l.lg.Info("outbound limiter starting",
+		"joins", l.limits.Joins, "join_window_s", l.limits.JoinWindow.Seconds(),
+		"messages", l.limits.Messages, "elevated_messages", l.limits.ElevatedMessages,
+		"message_window_s", l.limits.MessageWindow.Seconds())
+
+	for {
+		now := l.now()
+		c, i, wait := l.next(now)
+
+		var outCh chan<- string
+		var line string
+		if i >= 0 {
+			outCh = out
+			line = l.queues[c][i].line
+		}
+		var reportCh chan<- types.ChatSignal
+		var sig types.ChatSignal
+		if len(l.reports) > 0 {
+			reportCh = chat
+			sig = l.reports[0]
+		}
+		var timer *time.Timer
+		var wake <-chan time.Time
+		if i < 0 && wait > 0 {
+			timer = time.NewTimer(wait)
+			wake = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+			l.lg.Info("outbound limiter stopping")
+			return ctx.Err()
+
+		case s, ok := <-in:
+			if !ok {
+				l.lg.Info("outbound limiter stopping", "reason", "input_closed")
+				return nil
+			}
+			l.enqueue(s)
+
+		case st := <-roles:
+			l.elevated[strings.ToLower(st.Channel)] = st.Elevated()
+
+		case outCh <- line:
+			l.sent(c, i, l.now())
+
+		case <-l.resets:
+			l.reset()
+
+		case reportCh <- sig:
+			l.reports = l.reports[1:]
+
+		case <-wake:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if chat == nil {
+			l.reports = nil // nobody to tell
+		}
+	}
+}
+
+func (l *Limiter) reset() {
+	joins, msgs := len(l.queues[classJoin]), len(l.queues[classMessage])
+	for _, q := range l.queues[classMessage] {
+		l.reports = append(l.reports, types.ChatSignal{Kind: types.ChatUnsent, Channel: q.channel, Text: q.text})
+	}
+	for _, c := range []class{classJoin, classMessage} {
+		l.queues[c] = nil
+		queueDepth.With(c.String()).Set(0)
+	}
+	if joins+msgs > 0 {
+		l.lg.Info("connection lost; dropped queued lines", "joins", joins, "messages", msgs)
+	}
+}
+
+func (l *Limiter) enqueue(line string) {
+	q := classify(line)
+	c := q.class
+	if c != classPriority && len(l.queues[c]) >= l.limits.QueueSize {
+		linesDropped.With(c.String()).Inc()
+		l.lg.Warn("outbound queue full; dropping line", "class", c.String(), "command", command(line))
+		if c == classMessage {
+			l.reports = append(l.reports, types.ChatSignal{Kind: types.ChatUnsent, Channel: q.channel, Text: q.text})
+		}
+		return
+	}
+	l.queues[c] = append(l.queues[c], q.queued)
+	queueDepth.With(c.String()).Set(int64(len(l.queues[c])))
+}
+
+// next picks the line to offer to the socket: priority lines, then
+// unlimited ones, then JOINs and PRIVMSGs whose window has room. When
+// nothing can go yet it reports how long until something might.
+func (l *Limiter) next(now time.Time) (class, int, time.Duration) {
+	if len(l.queues[classPriority]) > 0 {
+		return classPriority, 0, 0
+	}
+	if len(l.queues[classOther]) > 0 {
+		return classOther, 0, 0
+	}
+
+	var wait time.Duration
+	consider := func(d time.Duration) {
+		if d > 0 && (wait == 0 || d < wait) {
+			wait = d
+		}
+	}
+
+	if q := l.queues[classJoin]; len(q) > 0 {
+		need := min(q[0].cost, l.limits.Joins)
+		d := l.joins.waitFor(now, need, l.limits.Joins)
+		if d == 0 {
+			return classJoin, 0, 0
+		}
+		l.markThrottled(classJoin, 0)
+		consider(d)
+	}
+
+	// Messages to channels where we are elevated may pass others that are
+	// waiting; order within a channel is kept because elevation is per
+	// channel.
+	for i, m := range l.queues[classMessage] {
+		limit := l.limits.Messages
+		if l.elevated[m.channel] {
+			limit = l.limits.ElevatedMessages
+		}
+		d := l.messages.waitFor(now, 1, limit)
+		if d == 0 {
+			return classMessage, i, 0
+		}
+		l.markThrottled(classMessage, i)
+		consider(d)
+	}
+	return 0, -1, wait
+}
+
+func (l *Limiter) markThrottled(c class, i int) {
+	if q := &l.queues[c][i]; !q.throttled {
+		q.throttled = true
+		linesThrottled.With(c.String()).Inc()
+	}
+}
+
+func (l *Limiter) sent(c class, i int, now time.Time) {
+	q := l.queues[c][i]
+	l.queues[c] = append(l.queues[c][:i], l.queues[c][i+1:]...)
+	queueDepth.With(c.String()).Set(int64(len(l.queues[c])))
+	linesSent.With(c.String()).Inc()
+	switch c {
+	case classJoin:
+		l.joins.add(now, q.cost)
+	case classMessage:
+		l.messages.add(now, 1)
+		l.reports = append(l.reports, types.ChatSignal{Kind: types.ChatSent, Channel: q.channel, Text: q.text})
+	}
+}
+
+type classified struct {
+	queued
+	class class
+}
+
+func classify(line string) classified {
+	cmd := command(line)
+	q := classified{queued: queued{line: line}}
+	line = stripTags(line)
+	switch cmd {
+	case "PONG", "PING", "PASS", "NICK", "CAP":
+		q.class = classPriority
+	case "JOIN":
+		q.class = classJoin
+		if f := strings.Fields(line); len(f) > 1 {
+			q.cost = strings.Count(f[1], ",") + 1
+		} else {
+			q.cost = 1
+		}
+	case "PRIVMSG":
+		q.class = classMessage
+		if f := strings.Fields(line); len(f) > 1 {
+			q.channel = strings.ToLower(f[1])
+		}
+		if i := strings.Index(line, " :"); i >= 0 {
+			q.text = strings.TrimRight(line[i+2:], "\r\n")
+		}
+	default:
+		q.class = classOther
+	}
+	return q
+}
+
+// command returns the IRC verb of an outbound line.
+func command(line string) string {
+	line = stripTags(line)
+	if i := strings.IndexAny(line, " \r\n"); i >= 0 {
+		line = line[:i]
+	}
+	return strings.ToUpper(line)
+}
+
+func stripTags(line string) string {
+	line = strings.TrimLeft(line, " ")
+	if strings.HasPrefix(line, "@") {
+		if i := strings.IndexByte(line, ' '); i >= 0 {
+			return strings.TrimLeft(line[i+1:], " ")
+		}
+	}
+	return line
+}
+
+// window is a sliding log of (time, cost) pairs.
+type window struct {
+	size  time.Duration
+	times []time.Time
+	costs []int
+	total int
+}
+
+func newWindow(size time.Duration) *window { return &window{size: size} }
+
+func (w *window) prune(now time.Time) {
+	cutoff := now.Add(-w.size)
+	n := 0
+	for n < len(w.times) && !w.times[n].After(cutoff) {
+		w.total -= w.costs[n]
+		n++
+	}
+	w.times = w.times[n:]
+	w.costs = w.costs[n:]
+}
+
+func (w *window) add(now time.Time, cost int) {
+	w.prune(now)
+	w.times = append(w.times, now)
+	w.costs = append(w.costs, cost)
+	w.total += cost
+}
+
+// waitFor reports how long until need more units fit under limit; zero
+// means now.
+func (w *window) waitFor(now time.Time, need, limit int) time.Duration {
+	w.prune(now)
+	excess := w.total + need - limit
+	if excess <= 0 {
+		return 0
+	}
+	freed := 0
+	for i, t := range w.times {
+		freed += w.costs[i]
+		if freed >= excess {
+			return t.Add(w.size).Sub(now) + time.Millisecond
+		}
+	}
+	return w.size
+}
@@ -0,0 +1,163 @@
+package outbound
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/types"
+)
+
+func drain(l *Limiter, now time.Time) (sent []string, wait time.Duration) {
+	for {
+		c, i, w := l.next(now)
+		if i < 0 {
+			return sent, w
+		}
+		sent = append(sent, l.queues[c][i].line)
+		l.sent(c, i, now)
+	}
+}
+
+func TestLimiter_JoinWindowAndPongPriority(t *testing.T) {
+	lim := DefaultLimits()
+	lim.Joins = 3
+	l := New(lim)
+	start := time.Unix(1_700_000_000, 0)
+
+	l.enqueue("JOIN #aaaa,#bbbb\r\n")
+	l.enqueue("JOIN #cccc\r\n")
+	l.enqueue("JOIN #dddd\r\n")
+	l.enqueue("PONG :tmi.twitch.tv\r\n")
+
+	sent, wait := drain(l, start)
+	if len(sent) != 3 || sent[0] != "PONG :tmi.twitch.tv\r\n" || sent[2] != "JOIN #cccc\r\n" {
+		t.Fatalf("sent = %q", sent)
+	}
+	if wait <= 0 || wait > lim.JoinWindow+time.Millisecond {
+		t.Fatalf("wait = %v, want within the join window", wait)
+	}
+
+	// Once the first JOIN (two channels) leaves the window, #dddd can go.
+	sent, _ = drain(l, start.Add(lim.JoinWindow+time.Millisecond))
+	if len(sent) != 1 || sent[0] != "JOIN #dddd\r\n" {
+		t.Fatalf("after window sent = %q", sent)
+	}
+}
+
+func TestLimiter_ElevatedChannelsUseHigherMessageLimit(t *testing.T) {
+	lim := DefaultLimits()
+	lim.Messages = 1
+	lim.ElevatedMessages = 3
+	l := New(lim)
+	l.elevated["#mine"] = true
+	now := time.Unix(1_700_000_000, 0)
+
+	l.enqueue("PRIVMSG #other :one\r\n")
+	l.enqueue("PRIVMSG #other :two\r\n")
+	l.enqueue("@client-nonce=x PRIVMSG #mine :three\r\n")
+	l.enqueue("PRIVMSG #mine :four\r\n")
+	l.enqueue("PRIVMSG #mine :five\r\n")
+
+	sent, _ := drain(l, now)
+	want := []string{"PRIVMSG #other :one\r\n", "@client-nonce=x PRIVMSG #mine :three\r\n", "PRIVMSG #mine :four\r\n"}
+	if len(sent) != len(want) {
+		t.Fatalf("sent = %q, want %q", sent, want)
+	}
+	for i := range want {
+		if sent[i] != want[i] {
+			t.Fatalf("sent = %q, want %q", sent, want)
+		}
+	}
+	if got := len(l.queues[classMessage]); got != 2 {
+		t.Fatalf("%d messages still queued, want 2", got)
+	}
+}
+
+func TestLimiter_ResetDropsJoinsAndReportsMessages(t *testing.T) {
+	lim := DefaultLimits()
+	lim.Joins, lim.Messages = 1, 1
+	l := New(lim)
+	in := make(chan string)
+	out := make(chan string)
+	chat := make(chan types.ChatSignal, 4)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = l.Run(ctx, in, nil, out, chat) }()
+
+	for _, line := range []string{
+		"JOIN #aaaa\r\n", "JOIN #bbbb\r\n",
+		"PRIVMSG #chess :one\r\n", "PRIVMSG #chess :two words\r\n",
+	} {
+		in <- line
+	}
+	// The first of each class fits its window; the rest wait.
+	for range 2 {
+		<-out
+	}
+
+	l.Reset()
+	for _, want := range []types.ChatSignal{
+		{Kind: types.ChatSent, Channel: "#chess", Text: "one"},
+		{Kind: types.ChatUnsent, Channel: "#chess", Text: "two words"},
+	} {
+		select {
+		case sig := <-chat:
+			if sig != want {
+				t.Fatalf("report = %+v, want %+v", sig, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s message not reported", want.Kind)
+		}
+	}
+
+	// Nothing from before the reset reaches the next socket.
+	in <- "PONG :tmi.twitch.tv\r\n"
+	if got := <-out; got != "PONG :tmi.twitch.tv\r\n" {
+		t.Fatalf("after reset sent %q", got)
+	}
+	select {
+	case got := <-out:
+		t.Fatalf("stale line replayed: %q", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestLimiter_ReportsFullQueueDropsAndStopsOnClose(t *testing.T) {
+	lim := DefaultLimits()
+	lim.Messages, lim.QueueSize = 1, 1
+	l := New(lim)
+	in := make(chan string)
+	out := make(chan string)
+	chat := make(chan types.ChatSignal, 4)
+	done := make(chan error, 1)
+	go func() { done <- l.Run(context.Background(), in, nil, out, chat) }()
+
+	in <- "PRIVMSG #chess :one\r\n"
+	<-out
+	in <- "PRIVMSG #chess :two\r\n"   // waits for the window
+	in <- "PRIVMSG #chess :three\r\n" // queue full
+	for _, want := range []types.ChatSignal{
+		{Kind: types.ChatSent, Channel: "#chess", Text: "one"},
+		{Kind: types.ChatUnsent, Channel: "#chess", Text: "three"},
+	} {
+		select {
+		case sig := <-chat:
+			if sig != want {
+				t.Fatalf("report = %+v, want %+v", sig, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s %q not reported", want.Kind, want.Text)
+		}
+	}
+
+	close(in)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Run = %v after its input closed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Run kept going after its input closed")
+	}
+}
@@ -0,0 +1,140 @@
+// Package rawarchive keeps every raw IRC line the collector receives, with
+// when and on which connection it arrived, so events can be re-derived
+// later by replaying the lines through the classifier.
+package rawarchive
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/metrics"
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/observe"
+)
+
+// Line is one archived line.
+type Line struct {
+	Received time.Time `json:"ts"`
+	ConnID   string    `json:"conn"` // one per websocket connection
+	// Seq orders lines that share a timestamp, such as the lines of one
+	// websocket frame. It increases across the process's lines.
+	Seq  uint64 `json:"seq,omitempty"`
+	Line string `json:"line"` // without "\r\n"
+}
+
+// Sink stores lines; Run calls it from a single goroutine.
+type Sink interface {
+	Write(ctx context.Context, l Line) error
+	Close() error
+}
+
+// Flusher is implemented by sinks that buffer; Run calls Flush every
+// flushInterval.
+type Flusher interface {
+	Flush() error
+}
+
+var (
+	archived = metrics.NewCounter("raw_archive_lines_total", "Raw lines written to the archive.")
+	dropped  = metrics.NewCounter("raw_archive_dropped_total",
+		"Raw lines lost because the archive fell behind or a sink write or flush failed.")
+)
+
+const flushInterval = 5 * time.Second
+
+// lostError is a sink failing to store lines it had already accepted, such
+// as a whole buffered batch.
+type lostError struct {
+	lines int
+	err   error
+}
+
+func (e *lostError) Error() string { return e.err.Error() }
+func (e *lostError) Unwrap() error { return e.err }
+
+// lost is how many lines a failed sink call took with it: what a
+// lostError reports, otherwise def.
+func lost(err error, def int) int64 {
+	var le *lostError
+	if errors.As(err, &le) {
+		return int64(le.lines)
+	}
+	return int64(def)
+}
+
+// Archive decouples the socket reader from the sink. A nil *Archive
+// archives nothing.
+type Archive struct {
+	ch  chan Line
+	seq atomic.Uint64
+	lg  *slog.Logger
+}
+
+// New returns an Archive that buffers up to buffer lines while the sink
+// catches up.
+func New(buffer int) *Archive {
+	return &Archive{ch: make(chan Line, max(buffer, 1)), lg: observe.C("rawarchive")}
+}
+
+// Record queues line for archiving. It never blocks the reader: when the
+// buffer is full the line is counted as dropped.
+func (a *Archive) Record(connID, line string, received time.Time) {
+	if a == nil {
+		return
+	}
+	select {
+	case a.ch <- Line{Received: received.UTC(), ConnID: connID, Seq: a.seq.Add(1), Line: line}:
+	default:
+		dropped.Inc()
+	}
+}
+
+// Run writes queued lines to sink until ctx ends, then writes what is
+// still buffered and closes the sink.
+func (a *Archive) Run(ctx context.Context, sink Sink) error {
+	a.lg.Info("raw archive starting", "buffer", cap(a.ch))
+	flusher, _ := sink.(Flusher)
+	tick := time.NewTicker(flushInterval)
+	defer tick.Stop()
+
+	write := func(ctx context.Context, l Line) {
+		if err := sink.Write(ctx, l); err != nil {
+			n := lost(err, 1)
+			dropped.Add(n)
+			a.lg.Warn("raw archive write failed", "err", err, "lines", n)
+			return
+		}
+		archived.Inc()
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			// the context is gone; sinks that need one get a short fresh one
+			drainCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			for {
+				select {
+				case l := <-a.ch:
+					write(drainCtx, l)
+				default:
+					a.lg.Info("raw archive stopping")
+					err := sink.Close()
+					dropped.Add(lost(err, 0))
+					return err
+				}
+			}
+		case l := <-a.ch:
+			write(ctx, l)
+		case <-tick.C:
+			if flusher != nil {
+				if err := flusher.Flush(); err != nil {
+					n := lost(err, 0)
+					dropped.Add(n)
+					a.lg.Warn("raw archive flush failed", "err", err, "lines", n)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package rawarchive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+)
+
+func TestSegmentSink_RotatesAndReadsBack(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := NewSegmentSink(dir, 200, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := time.Unix(1_700_000_000, 0)
+	sink.now = func() time.Time {
+		clock = clock.Add(time.Millisecond) // distinct segment names
+		return clock
+	}
+
+	now := time.Unix(1_700_000_000, 0)
+	a := New(100)
+	var want []Line
+	for i := 0; i < 10; i++ {
+		now = now.Add(time.Second)
+		l := fmt.Sprintf(":tmi.twitch.tv PRIVMSG #chess :line %d", i)
+		a.Record("c1", l, now)
+		want = append(want, Line{Received: now.UTC(), ConnID: "c1", Line: l})
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel() // Run drains the buffer and closes the sink
+	if err := a.Run(ctx, sink); err != nil {
+		t.Fatal(err)
+	}
+
+	paths, err := Segments(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) < 2 {
+		t.Fatalf("got %d segments, want rotation by size", len(paths))
+	}
+	if partial, _ := filepath.Glob(filepath.Join(dir, "*"+partialExt)); len(partial) != 0 {
+		t.Fatalf("unfinished segments left: %v", partial)
+	}
+
+	var got []Line
+	for _, p := range paths {
+		r, err := OpenSegment(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for {
+			l, err := r.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, l)
+		}
+		_ = r.Close()
+	}
+	if len(got) != len(want) {
+		t.Fatalf("read %d lines, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !got[i].Received.Equal(want[i].Received) || got[i].ConnID != want[i].ConnID || got[i].Line != want[i].Line {
+			t.Fatalf("line %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestSegmentSink_FlushFinishesAgedSegment(t *testing.T) {
+	dir := t.TempDir()
+	sink, _ := NewSegmentSink(dir, 0, time.Minute)
+	now := time.Unix(1_700_000_000, 0)
+	sink.now = func() time.Time { return now }
+
+	if err := sink.Write(context.Background(), Line{Received: now, ConnID: "c1", Line: "PING"}); err != nil {
+		t.Fatal(err)
+	}
+	if paths, _ := Segments(dir); len(paths) != 1 || !strings.HasSuffix(paths[0], partialExt) {
+		t.Fatalf("open segment = %v, want it listed as partial", paths)
+	}
+	now = now.Add(time.Minute)
+	if err := sink.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if paths, _ := Segments(dir); len(paths) != 1 || !strings.HasSuffix(paths[0], segmentExt) {
+		t.Fatalf("segments after age rotation = %v", paths)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type batchWriter struct{ batches [][]kafkago.Message }
+
+func (w *batchWriter) WriteMessages(_ context.Context, msgs ...kafkago.Message) error {
+	w.batches = append(w.batches, append([]kafkago.Message(nil), msgs...))
+	return nil
+}
+
+func (w *batchWriter) Close() error { return nil }
+
+func TestKafkaSink_Batches(t *testing.T) {
+	w := &batchWriter{}
+	sink := NewKafkaSink(w)
+	for i := 0; i < kafkaBatch+3; i++ {
+		if err := sink.Write(context.Background(), Line{ConnID: "c1", Line: "x"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(w.batches) != 1 || len(w.batches[0]) != kafkaBatch {
+		t.Fatalf("batches before close = %d", len(w.batches))
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.batches) != 2 || len(w.batches[1]) != 3 || string(w.batches[1][0].Key) != "c1" {
+		t.Fatalf("remainder not flushed on close: %d batches", len(w.batches))
+	}
+
+	var nilArchive *Archive
+	nilArchive.Record("c1", "x", time.Now()) // must not panic
+}
+
+func TestNewKafkaWriter_PartitionsByConnection(t *testing.T) {
+	w := NewKafkaWriter("localhost:9092", "raw")
+	if _, ok := w.Balancer.(*kafkago.Hash); !ok {
+		t.Fatalf("balancer = %T, want *kafka.Hash", w.Balancer)
+	}
+	partitions := []int{0, 1, 2, 3, 4, 5, 6, 7}
+	first := w.Balancer.Balance(kafkago.Message{Key: []byte("c1")}, partitions...)
+	for range 20 {
+		if p := w.Balancer.Balance(kafkago.Message{Key: []byte("c1")}, partitions...); p != first {
+			t.Fatalf("connection c1 went to partitions %d and %d", first, p)
+		}
+	}
+}
+
+type downWriter struct{}
+
+func (downWriter) WriteMessages(context.Context, ...kafkago.Message) error {
+	return errors.New("broker down")
+}
+func (downWriter) Close() error { return nil }
+
+func TestArchive_CountsEveryLostLine(t *testing.T) {
+	before := dropped.Value()
+	a := New(kafkaBatch + 50)
+	for i := 0; i < kafkaBatch+50; i++ {
+		a.Record("c1", "x", time.Now())
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := a.Run(ctx, NewKafkaSink(downWriter{})); err == nil {
+		t.Fatal("closing over a failed flush should report it")
+	}
+	// one failed batch from Write, the remainder from the final flush
+	if got := dropped.Value() - before; got != kafkaBatch+50 {
+		t.Fatalf("dropped %d lines, want %d", got, kafkaBatch+50)
+	}
+}
+
+func TestSegments_ReadsWhatACrashedSinkFlushed(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := NewSegmentSink(dir, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	write := func(from, to int) {
+		for i := from; i < to; i++ {
+			if err := sink.Write(context.Background(), Line{ConnID: "c1", Line: fmt.Sprint(i)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := sink.Flush(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(0, 5)
+	write(5, 8)
+	// The process dies: the segment is never finished, and the last frame
+	// only partly reached the disk.
+	name := sink.f.Name()
+	_ = sink.f.Close()
+	fi, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(name, fi.Size()-3); err != nil {
+		t.Fatal(err)
+	}
+	// and another one died before writing anything
+	empty := filepath.Join(dir, segmentPrefix+"20990101T000000.000000000Z"+segmentExt+partialExt)
+	if err := os.WriteFile(empty, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	paths, err := Segments(dir)
+	if err != nil || len(paths) != 2 || paths[0] != name || paths[1] != empty {
+		t.Fatalf("segments = %v, %v; want both partial ones, oldest first", paths, err)
+	}
+	var got []string
+	for _, p := range paths {
+		r, err := OpenSegment(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for {
+			l, err := r.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: %v", p, err)
+			}
+			got = append(got, l.Line)
+		}
+		_ = r.Close()
+	}
+	if strings.Join(got, ",") != "0,1,2,3,4" {
+		t.Fatalf("read %q, want the first flushed frame", got)
+	}
+}
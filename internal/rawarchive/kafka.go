@@ -0,0 +1,70 @@
+package rawarchive
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	kafkago "github.com/segmentio/kafka-go"
+
+	kstream "github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/kafka"
+)
+
+// kafkaBatch matches kafka-go's default BatchSize, so a full batch is sent
+// without waiting out the writer's BatchTimeout.
+const kafkaBatch = 100
+
+// KafkaSink produces each line as a JSON record, keyed by connection so a
+// connection's lines stay in order on one partition. Lines are sent in
+// batches; Run's periodic Flush sends a partial one.
+type KafkaSink struct {
+	w   kstream.MessageWriter
+	buf []kafkago.Message
+}
+
+// NewKafkaWriter is kstream.NewWriter partitioning by key, which the
+// per-connection ordering KafkaSink promises depends on.
+func NewKafkaWriter(brokersCSV, topic string) *kafkago.Writer {
+	w := kstream.NewWriter(brokersCSV, topic)
+	w.Balancer = &kafkago.Hash{}
+	return w
+}
+
+func NewKafkaSink(w kstream.MessageWriter) *KafkaSink {
+	return &KafkaSink{w: w, buf: make([]kafkago.Message, 0, kafkaBatch)}
+}
+
+func (s *KafkaSink) Write(ctx context.Context, l Line) error {
+	value, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	s.buf = append(s.buf, kafkago.Message{Key: []byte(l.ConnID), Value: value, Time: l.Received})
+	if len(s.buf) < kafkaBatch {
+		return nil
+	}
+	return s.send(ctx)
+}
+
+func (s *KafkaSink) Flush() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return s.send(ctx)
+}
+
+func (s *KafkaSink) Close() error {
+	return errors.Join(s.Flush(), s.w.Close())
+}
+
+func (s *KafkaSink) send(ctx context.Context) error {
+	if len(s.buf) == 0 {
+		return nil
+	}
+	err := s.w.WriteMessages(ctx, s.buf...)
+	if err != nil {
+		err = &lostError{lines: len(s.buf), err: err}
+	}
+	s.buf = s.buf[:0] // a failed batch is lost either way; don't resend it forever
+	return err
+}
@@ -0,0 +1,188 @@
+package rawarchive
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	segmentPrefix = "raw-"
+	segmentExt    = ".jsonl.zst"
+	partialExt    = ".partial" // appended while a segment is being written
+	segmentTime   = "20060102T150405.000000000Z"
+)
+
+// SegmentSink writes lines as zstd-compressed JSON lines into segment
+// files in Dir, starting a new one once the current one holds MaxBytes of
+// uncompressed data or is MaxAge old. A segment is written under a
+// ".partial" name and renamed when complete, so a finished name is never
+// read half-written.
+type SegmentSink struct {
+	Dir      string
+	MaxBytes int64
+	MaxAge   time.Duration
+
+	now    func() time.Time
+	f      *os.File
+	enc    *zstd.Encoder
+	name   string
+	opened time.Time
+	size   int64
+}
+
+func NewSegmentSink(dir string, maxBytes int64, maxAge time.Duration) (*SegmentSink, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("rawarchive: %w", err)
+	}
+	return &SegmentSink{Dir: dir, MaxBytes: maxBytes, MaxAge: maxAge, now: time.Now}, nil
+}
+
+func (s *SegmentSink) Write(_ context.Context, l Line) error {
+	b, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	if s.enc != nil && s.full() {
+		if err := s.finish(); err != nil {
+			return err
+		}
+	}
+	if s.enc == nil {
+		if err := s.open(); err != nil {
+			return err
+		}
+	}
+	b = append(b, '\n')
+	n, err := s.enc.Write(b)
+	s.size += int64(n)
+	return err
+}
+
+func (s *SegmentSink) full() bool {
+	return s.MaxBytes > 0 && s.size >= s.MaxBytes ||
+		s.MaxAge > 0 && s.now().Sub(s.opened) >= s.MaxAge
+}
+
+// Flush pushes buffered data to the file and finishes a segment that has
+// aged out while the connection was quiet.
+func (s *SegmentSink) Flush() error {
+	if s.enc == nil {
+		return nil
+	}
+	if s.full() {
+		return s.finish()
+	}
+	return s.enc.Flush()
+}
+
+func (s *SegmentSink) Close() error { return s.finish() }
+
+func (s *SegmentSink) open() error {
+	s.opened = s.now()
+	s.name = filepath.Join(s.Dir, segmentPrefix+s.opened.UTC().Format(segmentTime)+segmentExt)
+	f, err := os.OpenFile(s.name+partialExt, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return fmt.Errorf("rawarchive: %w", err)
+	}
+	enc, err := zstd.NewWriter(f)
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("rawarchive: %w", err)
+	}
+	s.f, s.enc, s.size = f, enc, 0
+	return nil
+}
+
+func (s *SegmentSink) finish() error {
+	if s.enc == nil {
+		return nil
+	}
+	err := errors.Join(s.enc.Close(), s.f.Close())
+	s.f, s.enc = nil, nil
+	if err != nil {
+		return fmt.Errorf("rawarchive: %w", err)
+	}
+	return os.Rename(s.name+partialExt, s.name)
+}
+
+// Segments lists the segments in dir, oldest first. That includes
+// ".partial" ones: the segment still being written, and any left behind by
+// a collector that died before finishing it.
+func Segments(dir string) ([]string, error) {
+	var paths []string
+	for _, ext := range []string{segmentExt, segmentExt + partialExt} {
+		found, err := filepath.Glob(filepath.Join(dir, segmentPrefix+"*"+ext))
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, found...)
+	}
+	// names sort by start time
+	sort.Slice(paths, func(i, j int) bool {
+		return strings.TrimSuffix(paths[i], partialExt) < strings.TrimSuffix(paths[j], partialExt)
+	})
+	return paths, nil
+}
+
+// SegmentReader reads the lines of one segment in order.
+type SegmentReader struct {
+	f       *os.File
+	dec     *zstd.Decoder
+	sc      *bufio.Scanner
+	partial bool // unfinished; may end mid-frame or mid-line
+}
+
+// OpenSegment opens a finished or ".partial" segment. A partial one reads
+// up to its last complete line.
+func OpenSegment(path string) (*SegmentReader, error) {
+	partial := strings.HasSuffix(path, segmentExt+partialExt)
+	if !partial && !strings.HasSuffix(path, segmentExt) {
+		return nil, fmt.Errorf("rawarchive: %s is not a segment", path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	dec, err := zstd.NewReader(f, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	sc := bufio.NewScanner(dec)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	return &SegmentReader{f: f, dec: dec, sc: sc, partial: partial}, nil
+}
+
+// Next returns the next line, or io.EOF after the last.
+func (r *SegmentReader) Next() (Line, error) {
+	var l Line
+	if !r.sc.Scan() {
+		if err := r.sc.Err(); err != nil && !r.partial {
+			return l, err
+		}
+		return l, io.EOF // a partial segment ends where its last flush did
+	}
+	if err := json.Unmarshal(r.sc.Bytes(), &l); err != nil {
+		if r.partial && r.sc.Err() != nil {
+			return Line{}, io.EOF // the line the writer was cut off in
+		}
+		return l, fmt.Errorf("rawarchive: %w", err)
+	}
+	return l, nil
+}
+
+func (r *SegmentReader) Close() error {
+	r.dec.Close()
+	return r.f.Close()
+}
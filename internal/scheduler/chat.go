@@ -0,0 +1,190 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/types"
+)
+
+const (
+	// duplicateWindow is how long Twitch refuses an identical message in the
+	// same channel from a regular user.
+	duplicateWindow = 30 * time.Second
+	// confirmTimeout bounds how long a PRIVMSG waits for USERSTATE or a
+	// NOTICE once the outbound limiter has written it, and how long a JOIN
+	// may shadow confirmations.
+	confirmTimeout = 10 * time.Second
+	// queueTimeout bounds how long a PRIVMSG may wait for the limiter to
+	// write or drop it; the limiter reports one or the other, so this only
+	// matters when nothing is listening.
+	queueTimeout = 5 * time.Minute
+)
+
+var (
+	ErrDuplicateMessage = errors.New("identical message sent to this channel within 30s")
+	// ErrUnconfirmed means the message was written but the server neither
+	// confirmed nor rejected it in time.
+	ErrUnconfirmed = errors.New("message sent but not confirmed by the server")
+	// ErrNotSent means the outbound limiter dropped the message before
+	// writing it, because the connection was lost or its queue was full; it
+	// is safe to send again.
+	ErrNotSent = errors.New("message dropped before it was sent")
+)
+
+// SlowModeError refuses a message that would break the channel's slow mode.
+type SlowModeError struct {
+	RetryAfter time.Duration
+}
+
+func (e *SlowModeError) Error() string {
+	return fmt.Sprintf("channel is in slow mode; retry in %s", e.RetryAfter.Round(time.Second))
+}
+
+// NoticeError is Twitch rejecting a message with NOTICE msg-id=msg_*.
+type NoticeError struct {
+	MsgID string
+	Text  string
+}
+
+func (e *NoticeError) Error() string {
+	return "rejected by twitch: " + e.MsgID + ": " + e.Text
+}
+
+type chatChannel struct {
+	slow     time.Duration
+	elevated bool
+	lastSent time.Time
+	lastText string
+	pending  []pendingMsg // oldest first
+	// joinUntil is set while a JOIN is in flight: Twitch answers it with a
+	// USERSTATE too, which must not confirm a pending message.
+	joinUntil time.Time
+}
+
+type pendingMsg struct {
+	cmd      types.IRCCommand
+	sent     bool // written to the socket; the confirmation clock is running
+	deadline time.Time
+}
+
+type chatState struct {
+	chans map[string]*chatChannel
+}
+
+func newChatState() *chatState {
+	return &chatState{chans: make(map[string]*chatChannel)}
+}
+
+func (s *chatState) get(ch string) *chatChannel {
+	c, ok := s.chans[ch]
+	if !ok {
+		c = &chatChannel{}
+		s.chans[ch] = c
+	}
+	return c
+}
+
+// admit applies the per-channel rules. Broadcasters, moderators and VIPs
+// are exempt from both.
+func (s *chatState) admit(ch, text string, now time.Time) error {
+	c := s.get(ch)
+	if c.elevated || c.lastSent.IsZero() {
+		return nil
+	}
+	if c.slow > 0 {
+		if wait := c.lastSent.Add(c.slow).Sub(now); wait > 0 {
+			return &SlowModeError{RetryAfter: wait}
+		}
+	}
+	if text == c.lastText && now.Sub(c.lastSent) < duplicateWindow {
+		return ErrDuplicateMessage
+	}
+	return nil
+}
+
+func (s *chatState) await(ch string, cmd types.IRCCommand, now time.Time) {
+	c := s.get(ch)
+	c.lastSent = now
+	c.lastText = cmd.Text
+	c.pending = append(c.pending, pendingMsg{cmd: cmd, deadline: now.Add(queueTimeout)})
+}
+
+func (s *chatState) joining(ch string, now time.Time) {
+	s.get(ch).joinUntil = now.Add(confirmTimeout)
+}
+
+func (s *chatState) observe(sig types.ChatSignal, now time.Time) {
+	c := s.get(strings.ToLower(sig.Channel))
+	switch sig.Kind {
+	case types.ChatRoomState:
+		if sig.SlowSeconds >= 0 {
+			c.slow = time.Duration(sig.SlowSeconds) * time.Second
+		}
+	case types.ChatUserState:
+		c.elevated = sig.Elevated
+		if !c.joinUntil.IsZero() {
+			c.joinUntil = time.Time{} // the JOIN's, not a message's
+			return
+		}
+		// Twitch answers each accepted PRIVMSG with a USERSTATE.
+		if len(c.pending) > 0 {
+			reply(c.pending[0].cmd, nil)
+			c.pending = c.pending[1:]
+		}
+	case types.ChatNotice:
+		if !strings.HasPrefix(sig.MsgID, "msg_") || len(c.pending) == 0 {
+			return
+		}
+		if !c.joinUntil.IsZero() {
+			return // may be the JOIN's refusal, which is the rectifier's business
+		}
+		reply(c.pending[0].cmd, &NoticeError{MsgID: sig.MsgID, Text: sig.Text})
+		c.pending = c.pending[1:]
+		// the message never landed, so it doesn't count for slow mode
+		// or duplicates
+		c.lastSent = time.Time{}
+		c.lastText = ""
+	case types.ChatSent:
+		// The limiter keeps a channel's messages in order, so this is the
+		// oldest one still waiting with that text.
+		for i := range c.pending {
+			if p := &c.pending[i]; !p.sent && p.cmd.Text == sig.Text {
+				p.sent = true
+				p.deadline = now.Add(confirmTimeout)
+				return
+			}
+		}
+	case types.ChatUnsent:
+		for i, p := range c.pending {
+			if p.cmd.Text != sig.Text {
+				continue
+			}
+			reply(p.cmd, ErrNotSent)
+			c.pending = append(c.pending[:i], c.pending[i+1:]...)
+			if c.lastText == sig.Text {
+				c.lastSent = time.Time{}
+				c.lastText = ""
+			}
+			return
+		}
+	}
+}
+
+// expire returns pending messages past their deadline and forgets JOINs
+// that were never answered.
+func (s *chatState) expire(now time.Time) []types.IRCCommand {
+	var out []types.IRCCommand
+	for _, c := range s.chans {
+		if !c.joinUntil.IsZero() && now.After(c.joinUntil) {
+			c.joinUntil = time.Time{}
+		}
+		for len(c.pending) > 0 && now.After(c.pending[0].deadline) {
+			out = append(out, c.pending[0].cmd)
+			c.pending = c.pending[1:]
+		}
+	}
+	return out
+}
@@ -0,0 +1,199 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/types"
+)
+
+func TestChatState_SlowModeAndDuplicates(t *testing.T) {
+	s := newChatState()
+	now := time.Unix(1_700_000_000, 0)
+
+	s.observe(types.ChatSignal{Kind: types.ChatRoomState, Channel: "#chess", SlowSeconds: 10}, now)
+	if err := s.admit("#chess", "hello", now); err != nil {
+		t.Fatalf("first message refused: %v", err)
+	}
+	s.await("#chess", types.IRCCommand{Text: "hello"}, now)
+
+	var slow *SlowModeError
+	if err := s.admit("#chess", "again", now.Add(4*time.Second)); !errors.As(err, &slow) || slow.RetryAfter != 6*time.Second {
+		t.Fatalf("err = %v, want slow mode with 6s", err)
+	}
+	if err := s.admit("#chess", "hello", now.Add(15*time.Second)); !errors.Is(err, ErrDuplicateMessage) {
+		t.Fatalf("err = %v, want duplicate", err)
+	}
+	if err := s.admit("#chess", "hello", now.Add(31*time.Second)); err != nil {
+		t.Fatalf("duplicate after 30s refused: %v", err)
+	}
+
+	// a partial ROOMSTATE leaves slow mode as it was
+	s.observe(types.ChatSignal{Kind: types.ChatRoomState, Channel: "#chess", SlowSeconds: -1}, now)
+	if s.get("#chess").slow != 10*time.Second {
+		t.Fatal("partial ROOMSTATE cleared slow mode")
+	}
+
+	// moderators are exempt
+	s.observe(types.ChatSignal{Kind: types.ChatUserState, Channel: "#chess", Elevated: true}, now)
+	if err := s.admit("#chess", "hello", now.Add(time.Second)); err != nil {
+		t.Fatalf("elevated message refused: %v", err)
+	}
+}
+
+func TestControlScheduler_PrivmsgOutcome(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	in := make(chan types.IRCCommand)
+	out := make(chan string, 4)
+	signals := make(chan types.ChatSignal)
+	go ControlScheduler(ctx, in, out, signals)
+
+	say := func(text string) chan types.CommandResult {
+		res := make(chan types.CommandResult, 1)
+		in <- types.IRCCommand{Op: "PRIVMSG", Channel: "#Chess", Text: text, Result: res}
+		return res
+	}
+	result := func(res chan types.CommandResult) error {
+		select {
+		case r := <-res:
+			return r.Err
+		case <-time.After(2 * time.Second):
+			t.Fatal("no result")
+			return nil
+		}
+	}
+
+	res := say("hi there")
+	if line := <-out; line != "PRIVMSG #chess :hi there\r\n" {
+		t.Fatalf("line = %q", line)
+	}
+	signals <- types.ChatSignal{Kind: types.ChatUserState, Channel: "#chess"}
+	if err := result(res); err != nil {
+		t.Fatalf("confirmed message err = %v", err)
+	}
+
+	res = say("hi there")
+	if err := result(res); !errors.Is(err, ErrDuplicateMessage) {
+		t.Fatalf("err = %v, want duplicate", err)
+	}
+
+	res = say("something else")
+	<-out
+	signals <- types.ChatSignal{Kind: types.ChatNotice, Channel: "#chess", MsgID: "msg_followersonly", Text: "followers only"}
+	var notice *NoticeError
+	if err := result(res); !errors.As(err, &notice) || notice.MsgID != "msg_followersonly" {
+		t.Fatalf("err = %v, want notice msg_followersonly", err)
+	}
+
+	// a rejected message does not count as sent
+	res = say("something else")
+	<-out
+	signals <- types.ChatSignal{Kind: types.ChatUserState, Channel: "#chess"}
+	if err := result(res); err != nil {
+		t.Fatalf("retry after rejection err = %v", err)
+	}
+}
+
+func TestChatState_RejoinDoesNotConfirm(t *testing.T) {
+	s := newChatState()
+	now := time.Unix(1_700_000_000, 0)
+	res := make(chan types.CommandResult, 1)
+	s.await("#chess", types.IRCCommand{Text: "hello", Result: res}, now)
+	s.observe(types.ChatSignal{Kind: types.ChatSent, Channel: "#chess", Text: "hello"}, now)
+
+	// RECONNECT: the message may have died with the old socket, and the
+	// rejoin's USERSTATE says nothing about it.
+	s.joining("#chess", now.Add(time.Second))
+	s.observe(types.ChatSignal{Kind: types.ChatUserState, Channel: "#chess"}, now)
+	if len(res) != 0 {
+		t.Fatalf("rejoin USERSTATE confirmed the message: %+v", <-res)
+	}
+	if got := s.expire(now.Add(confirmTimeout + time.Second)); len(got) != 1 || got[0].Text != "hello" {
+		t.Fatalf("expired = %+v, want the unconfirmed message", got)
+	}
+
+	// Once the JOIN is answered, USERSTATE confirms messages again.
+	s.await("#chess", types.IRCCommand{Text: "again", Result: res}, now.Add(20*time.Second))
+	s.observe(types.ChatSignal{Kind: types.ChatUserState, Channel: "#chess"}, now)
+	if r := <-res; r.Err != nil {
+		t.Fatalf("confirmation err = %v", r.Err)
+	}
+
+	// A JOIN that is never answered stops shadowing confirmations.
+	s.joining("#chess", now.Add(30*time.Second))
+	s.expire(now.Add(30*time.Second + confirmTimeout + time.Second))
+	s.await("#chess", types.IRCCommand{Text: "third", Result: res}, now.Add(45*time.Second))
+	s.observe(types.ChatSignal{Kind: types.ChatUserState, Channel: "#chess"}, now)
+	if len(res) != 1 {
+		t.Fatal("USERSTATE after a refused JOIN did not confirm")
+	}
+}
+
+func TestChatState_UnsentFailsItsMessage(t *testing.T) {
+	s := newChatState()
+	now := time.Unix(1_700_000_000, 0)
+	first := make(chan types.CommandResult, 1)
+	second := make(chan types.CommandResult, 1)
+	s.get("#chess").elevated = true // no slow mode between the two
+	s.await("#chess", types.IRCCommand{Text: "one", Result: first}, now)
+	s.await("#chess", types.IRCCommand{Text: "two", Result: second}, now)
+
+	s.observe(types.ChatSignal{Kind: types.ChatUnsent, Channel: "#chess", Text: "two"}, now)
+	if r := <-second; !errors.Is(r.Err, ErrNotSent) {
+		t.Fatalf("err = %v, want ErrNotSent", r.Err)
+	}
+	if len(first) != 0 || len(s.get("#chess").pending) != 1 {
+		t.Fatal("unsent signal touched another message")
+	}
+	// it was never written, so repeating it is not a duplicate
+	if c := s.get("#chess"); c.lastText != "" || !c.lastSent.IsZero() {
+		t.Fatalf("last sent = %q at %v", c.lastText, c.lastSent)
+	}
+}
+
+func TestChatState_ConfirmationClockStartsWhenSent(t *testing.T) {
+	s := newChatState()
+	now := time.Unix(1_700_000_000, 0)
+	first := make(chan types.CommandResult, 1)
+	second := make(chan types.CommandResult, 1)
+	s.get("#chess").elevated = true
+	s.await("#chess", types.IRCCommand{Text: "one", Result: first}, now)
+	s.await("#chess", types.IRCCommand{Text: "two", Result: second}, now)
+
+	// The limiter holds both for longer than confirmTimeout.
+	if got := s.expire(now.Add(25 * time.Second)); len(got) != 0 {
+		t.Fatalf("expired while queued: %+v", got)
+	}
+	s.observe(types.ChatSignal{Kind: types.ChatSent, Channel: "#chess", Text: "one"}, now.Add(25*time.Second))
+	s.observe(types.ChatSignal{Kind: types.ChatUserState, Channel: "#chess"}, now.Add(26*time.Second))
+	if r := <-first; r.Err != nil {
+		t.Fatalf("first err = %v", r.Err)
+	}
+	if len(second) != 0 {
+		t.Fatal("USERSTATE for the first message confirmed the second")
+	}
+
+	s.observe(types.ChatSignal{Kind: types.ChatSent, Channel: "#chess", Text: "two"}, now.Add(28*time.Second))
+	if got := s.expire(now.Add(28*time.Second + confirmTimeout - time.Second)); len(got) != 0 {
+		t.Fatalf("expired before its confirmation window: %+v", got)
+	}
+	if got := s.expire(now.Add(28*time.Second + confirmTimeout + time.Second)); len(got) != 1 || got[0].Text != "two" {
+		t.Fatalf("expired = %+v, want the second message", got)
+	}
+}
+
+func TestChatState_NoticeDuringJoinLeavesMessagesAlone(t *testing.T) {
+	s := newChatState()
+	now := time.Unix(1_700_000_000, 0)
+	res := make(chan types.CommandResult, 1)
+	s.await("#chess", types.IRCCommand{Text: "hello", Result: res}, now)
+	s.joining("#chess", now)
+
+	s.observe(types.ChatSignal{Kind: types.ChatNotice, Channel: "#chess", MsgID: "msg_channel_suspended", Text: "suspended"}, now)
+	if len(res) != 0 || len(s.get("#chess").pending) != 1 {
+		t.Fatal("a NOTICE during a JOIN failed a pending message")
+	}
+}
@@ -3,13 +3,23 @@ package scheduler
 import (
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/observe"
 	"github.com/Jamie-38/twitch-irc-ingest-pipeline/internal/types"
 )
 
-func ControlScheduler(ctx context.Context, controlCh <-chan types.IRCCommand, writerCh chan<- string) {
+// ControlScheduler turns commands into IRC lines on writerCh. JOIN and
+// PART are forwarded as is; PRIVMSG is checked against the channel's slow
+// mode and Twitch's duplicate-message rule first, and its outcome is
+// reported on cmd.Result once the server confirms (USERSTATE) or rejects
+// (NOTICE msg_*) it, or the outbound limiter reports it unsent. The wait
+// for the server starts when the limiter reports the message sent. signals
+// may be nil, in which case messages are never confirmed.
+func ControlScheduler(ctx context.Context, controlCh <-chan types.IRCCommand, writerCh chan<- string, signals <-chan types.ChatSignal) {
 	lg := observe.C("scheduler")
+	chat := newChatState()
 
 	send := func(line string, channel string) {
 		select {
@@ -20,6 +30,9 @@ func ControlScheduler(ctx context.Context, controlCh <-chan types.IRCCommand, wr
 		}
 	}
 
+	tick := time.NewTicker(time.Second)
+	defer tick.Stop()
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -36,14 +49,46 @@ func ControlScheduler(ctx context.Context, controlCh <-chan types.IRCCommand, wr
 			case "JOIN":
 				lg.Debug("forwarded JOIN", "channel", cmd.Channel)
 				send(fmt.Sprintf("JOIN %s\r\n", cmd.Channel), cmd.Channel)
+				chat.joining(strings.ToLower(cmd.Channel), time.Now())
 
 			case "PART":
 				lg.Debug("forwarded PART", "channel", cmd.Channel)
 				send(fmt.Sprintf("PART %s\r\n", cmd.Channel), cmd.Channel)
 
+			case "PRIVMSG":
+				ch := strings.ToLower(cmd.Channel)
+				if err := chat.admit(ch, cmd.Text, time.Now()); err != nil {
+					lg.Info("PRIVMSG refused", "channel", ch, "err", err, "principal", cmd.Principal)
+					reply(cmd, err)
+					continue
+				}
+				lg.Info("forwarded PRIVMSG", "channel", ch, "len", len(cmd.Text), "principal", cmd.Principal)
+				send(fmt.Sprintf("PRIVMSG %s :%s\r\n", ch, cmd.Text), ch)
+				chat.await(ch, cmd, time.Now())
+
 			default:
 				lg.Warn("unknown IRC command", "op", cmd.Op, "channel", cmd.Channel)
 			}
+
+		case sig := <-signals:
+			chat.observe(sig, time.Now())
+
+		case now := <-tick.C:
+			for _, p := range chat.expire(now) {
+				lg.Info("PRIVMSG unconfirmed", "channel", p.Channel)
+				reply(p, ErrUnconfirmed)
+			}
 		}
 	}
 }
+
+func reply(cmd types.IRCCommand, err error) {
+	if cmd.Result == nil {
+		return
+	}
+	select {
+	case cmd.Result <- types.CommandResult{Err: err}:
+	default:
+		// caller must provide a buffered channel; never block the scheduler
+	}
+}
@@ -0,0 +1,14 @@
+package types
+
+import "time"
+
+// AuditEntry is one line of the desired-state audit log.
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	Principal string    `json:"principal,omitempty"`
+	Source    string    `json:"source"`
+	Command   string    `json:"command"` // "JOIN", "PART", "REPLACE", ...
+	Op        string    `json:"op"`      // "add" or "remove"
+	Channel   string    `json:"channel"`
+	Version   uint64    `json:"version"` // snapshot version the change landed in
+}
@@ -1,6 +1,19 @@
 package types
 
+import "time"
+
 type MembershipEvent struct {
-	Op      string // "JOIN", "PART", "ROOMSTATE", etc.
+	Op      string // "JOIN", "PART", "NOTICE"; "RESET" when the connection was lost, "CLEAR" from an operator
 	Channel string // e.g., "#chess"
+	Reason  string // NOTICE msg-id
+}
+
+// ChannelStatus is the rectifier's latest view of one channel.
+type ChannelStatus struct {
+	Channel   string    `json:"channel"`
+	Phase     string    `json:"phase"` // "Idle", "Joining", "Joined", "Parting", "Error"
+	Reason    string    `json:"reason,omitempty"`
+	Terminal  bool      `json:"terminal,omitempty"` // Error that is not retried until cleared
+	UpdatedAt time.Time `json:"updated_at"`
+	Seq       uint64    `json:"seq"` // board-wide sequence of the last change
 }
@@ -1,12 +1,76 @@
 package types
 
 import (
+	"encoding/json"
 	"time"
 )
 
+// ChannelsSchema is the current channels.json schema. Version 1 stored
+// channels as bare strings; version 2 stores ChannelEntry objects.
+const ChannelsSchema = 2
+
 type Channels struct {
-	Schema    int       `json:"schema"`
-	Account   string    `json:"account"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Channels  []string  `json:"channels"`
+	Schema    int            `json:"schema"`
+	Account   string         `json:"account"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	Channels  []ChannelEntry `json:"channels"`
+}
+
+// ChannelMeta is operator-supplied metadata for a desired channel.
+type ChannelMeta struct {
+	Tags      []string   `json:"tags,omitempty"`
+	Priority  int        `json:"priority,omitempty"` // higher joins first
+	Owner     string     `json:"owner,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Schedule  *Schedule  `json:"schedule,omitempty"`
+}
+
+// Schedule limits when a desired channel is actually joined. The channel is
+// active inside [Start, End) and, when Cron is set, only during the
+// Duration-long windows that open at each Cron match.
+type Schedule struct {
+	Start    *time.Time `json:"start,omitempty"`
+	End      *time.Time `json:"end,omitempty"`
+	Cron     string     `json:"cron,omitempty"`     // 5-field "min hour dom month dow"
+	Duration string     `json:"duration,omitempty"` // window length, e.g. "2h"
+	TZ       string     `json:"tz,omitempty"`       // IANA zone for Cron; default UTC
+
+	// Window is Cron/Duration/TZ compiled when the entry is admitted, so
+	// checking a schedule doesn't reparse it or reload its zone.
+	Window ScheduleWindow `json:"-"`
+}
+
+// ScheduleWindow reports whether a recurring window is open at t.
+type ScheduleWindow interface {
+	Open(t time.Time) bool
+}
+
+type ChannelEntry struct {
+	Name string `json:"name"` // e.g., "#chess"
+	ChannelMeta
+}
+
+// UnmarshalJSON accepts both the v2 object form and a bare v1 string.
+func (e *ChannelEntry) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err == nil {
+		*e = ChannelEntry{Name: name}
+		return nil
+	}
+	type plain ChannelEntry
+	var p plain
+	if err := json.Unmarshal(b, &p); err != nil {
+		return err
+	}
+	*e = ChannelEntry(p)
+	return nil
+}
+
+func (m ChannelMeta) HasTag(tag string) bool {
+	for _, t := range m.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,24 @@
+package types
+
+// ChatSignal carries the server replies the scheduler needs to send chat
+// safely: room settings, confirmations and rejections. The outbound
+// limiter adds ChatSent when it writes a message to the socket and
+// ChatUnsent for messages it dropped before writing them.
+type ChatSignal struct {
+	Kind    string // ChatRoomState, ChatUserState, ChatNotice, ChatSent or ChatUnsent
+	Channel string // "#name"
+
+	SlowSeconds int  // ChatRoomState: slow-mode delay; -1 when the update doesn't mention it
+	Elevated    bool // ChatUserState: we are broadcaster, moderator or VIP here
+
+	MsgID string // ChatNotice: msg-id tag, e.g. "msg_duplicate"
+	Text  string // ChatNotice: human-readable message; ChatSent, ChatUnsent: the message text
+}
+
+const (
+	ChatRoomState = "roomstate"
+	ChatUserState = "userstate"
+	ChatNotice    = "notice"
+	ChatSent      = "sent"
+	ChatUnsent    = "unsent"
+)
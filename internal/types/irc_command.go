@@ -1,6 +1,38 @@
 package types
 
 type IRCCommand struct {
-	Op      string // "JOIN", "PART", etc.
-	Channel string // e.g., "#chess"
+	Op      string         // "JOIN", "PART", "REPLACE", "PRIVMSG", etc.
+	Channel string         // e.g., "#chess"
+	Meta    *ChannelMeta   // optional metadata for "JOIN"; replaces any existing
+	Entries []ChannelEntry // full desired set for "REPLACE"
+	Text    string         // message body for "PRIVMSG"
+
+	Source    string // who issued it: SourceHTTP, SourceAPI, SourceFile
+	Principal string // authenticated caller, when known
+
+	// ExpectedVersion makes the command conditional on the controller's
+	// current snapshot version; 0 means unconditional.
+	ExpectedVersion uint64
+	// Result, when non-nil, receives exactly one outcome once the
+	// controller has applied (or refused) the command, or once the
+	// scheduler knows whether a PRIVMSG was accepted.
+	Result chan<- CommandResult
 }
+
+type CommandResult struct {
+	Version  uint64 // snapshot version after the command was handled
+	Conflict bool   // ExpectedVersion did not match
+	Err      error
+}
+
+const (
+	SourceHTTP = "http"
+	SourceAPI  = "api"
+	SourceFile = "file"
+	// SourceExpiry marks removals made by the controller when ExpiresAt passes.
+	SourceExpiry = "expiry"
+	// SourceSchedule marks schedule windows opening and closing.
+	SourceSchedule = "schedule"
+	// SourceDiscovery marks channels added by raid/host auto-discovery.
+	SourceDiscovery = "discovery"
+)
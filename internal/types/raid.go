@@ -0,0 +1,9 @@
+package types
+
+// RaidEvent links two channels through a raid (or legacy host) seen on IRC.
+type RaidEvent struct {
+	Kind    string // "raid" or "host"
+	From    string // raiding/hosting channel, e.g. "#alice"
+	To      string // raided/hosted channel, e.g. "#bob"
+	Viewers int
+}
@@ -0,0 +1,15 @@
+package types
+
+// UserState is the collector's own standing in a channel, taken from the
+// USERSTATE Twitch sends after a JOIN or a PRIVMSG.
+type UserState struct {
+	Channel     string // "#name"
+	Broadcaster bool
+	Moderator   bool
+	VIP         bool
+}
+
+// Elevated reports whether the higher message rate limit applies.
+func (u UserState) Elevated() bool {
+	return u.Broadcaster || u.Moderator || u.VIP
+}